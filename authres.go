@@ -0,0 +1,254 @@
+package enmime
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// AuthResult is the result of one authentication method of an
+// Authentication-Results header, like "dkim=pass header.d=example.com".
+type AuthResult struct {
+	Method     string            // Method, like spf, dkim, dmarc or arc
+	Result     string            // Result, like pass, fail or none
+	Reason     string            // Text of the reason property
+	Properties map[string]string // Properties by ptype.property, like smtp.mailfrom
+}
+
+// AuthenticationResults is a parsed RFC 8601 Authentication-Results header.
+type AuthenticationResults struct {
+	AuthServID string // Host that performed the checks
+	Version    int    // Version after the authserv-id, 1 if missing
+	Results    []AuthResult
+}
+
+// ARCSet is one instance of the ARC header sets of RFC 8617.
+type ARCSet struct {
+	Instance                 int
+	Seal                     map[string]string // Tags of ARC-Seal
+	MessageSignature         map[string]string // Tags of ARC-Message-Signature
+	AuthenticationResults    *AuthenticationResults
+	RawSeal                  string
+	RawMessageSignature      string
+	RawAuthenticationResults string
+}
+
+// ParseAuthenticationResults parses the value of an Authentication-Results
+// header.  A result of "none" without any method yields no Results.
+func ParseAuthenticationResults(value string) (*AuthenticationResults, error) {
+	tokens := authResTokens(unfoldHeader(value))
+	if len(tokens) == 0 || tokens[0] == ";" || tokens[0] == "=" {
+		return nil, fmt.Errorf("Missing authserv-id in %q", value)
+	}
+	ar := &AuthenticationResults{AuthServID: tokens[0], Version: 1}
+	i := 1
+	if i < len(tokens) && isAllDigits(tokens[i]) {
+		ar.Version, _ = strconv.Atoi(tokens[i])
+		i++
+	}
+
+	var cur *AuthResult
+	for ; i < len(tokens); i++ {
+		tok := tokens[i]
+		if tok == ";" {
+			cur = nil
+			continue
+		}
+		if i+2 >= len(tokens) || tokens[i+1] != "=" {
+			// "none" or garbage
+			continue
+		}
+		key, val := tok, tokens[i+2]
+		i += 2
+		switch {
+		case cur == nil:
+			name := strings.ToLower(key)
+			if j := strings.IndexByte(name, '/'); j >= 0 {
+				// Method version
+				name = name[:j]
+			}
+			ar.Results = append(ar.Results, AuthResult{
+				Method:     name,
+				Result:     strings.ToLower(val),
+				Properties: make(map[string]string),
+			})
+			cur = &ar.Results[len(ar.Results)-1]
+		case strings.EqualFold(key, "reason"):
+			cur.Reason = val
+		default:
+			cur.Properties[strings.ToLower(key)] = val
+		}
+	}
+	return ar, nil
+}
+
+// Result returns the first result for method, or nil.
+func (ar *AuthenticationResults) Result(method string) *AuthResult {
+	for i := range ar.Results {
+		if strings.EqualFold(ar.Results[i].Method, method) {
+			return &ar.Results[i]
+		}
+	}
+	return nil
+}
+
+// AuthenticationResults parses the Authentication-Results headers of the
+// message, topmost first.  Headers that fail to parse are skipped.  When
+// authServID is not empty only the headers added by that host are returned,
+// as headers of other hosts may be forged.
+func (m *MIMEBody) AuthenticationResults(authServID string) []*AuthenticationResults {
+	var results []*AuthenticationResults
+	for _, v := range m.header["Authentication-Results"] {
+		ar, err := ParseAuthenticationResults(v)
+		if err != nil {
+			continue
+		}
+		if authServID == "" || strings.EqualFold(ar.AuthServID, authServID) {
+			results = append(results, ar)
+		}
+	}
+	return results
+}
+
+// ARCSets groups the ARC-Seal, ARC-Message-Signature and
+// ARC-Authentication-Results headers of the message by their instance
+// number, in ascending order.  Headers without valid instance are ignored.
+func (m *MIMEBody) ARCSets() []*ARCSet {
+	sets := make(map[int]*ARCSet)
+	get := func(i int) *ARCSet {
+		s := sets[i]
+		if s == nil {
+			s = &ARCSet{Instance: i}
+			sets[i] = s
+		}
+		return s
+	}
+	for _, v := range m.header["Arc-Seal"] {
+		tags := ParseTagList(v)
+		if i, err := strconv.Atoi(tags["i"]); err == nil && i > 0 {
+			s := get(i)
+			s.Seal, s.RawSeal = tags, v
+		}
+	}
+	for _, v := range m.header["Arc-Message-Signature"] {
+		tags := ParseTagList(v)
+		if i, err := strconv.Atoi(tags["i"]); err == nil && i > 0 {
+			s := get(i)
+			s.MessageSignature, s.RawMessageSignature = tags, v
+		}
+	}
+	for _, v := range m.header["Arc-Authentication-Results"] {
+		// i=1; authserv-id; results
+		v = unfoldHeader(v)
+		semi := strings.IndexByte(v, ';')
+		if semi < 0 {
+			continue
+		}
+		tag := strings.TrimSpace(v[:semi])
+		if !strings.HasPrefix(tag, "i=") {
+			continue
+		}
+		i, err := strconv.Atoi(strings.TrimSpace(tag[2:]))
+		if err != nil || i <= 0 {
+			continue
+		}
+		if ar, err := ParseAuthenticationResults(v[semi+1:]); err == nil {
+			s := get(i)
+			s.AuthenticationResults, s.RawAuthenticationResults = ar, v
+		}
+	}
+
+	var result []*ARCSet
+	for _, s := range sets {
+		result = append(result, s)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Instance < result[j].Instance })
+	return result
+}
+
+// ParseTagList parses a DKIM style tag=value list, separated by semicolons.
+// White space inside values is removed.
+func ParseTagList(value string) map[string]string {
+	tags := make(map[string]string)
+	for _, spec := range strings.Split(value, ";") {
+		eq := strings.IndexByte(spec, '=')
+		if eq < 0 {
+			continue
+		}
+		name := strings.TrimSpace(spec[:eq])
+		if name == "" {
+			continue
+		}
+		tags[name] = strings.Join(strings.Fields(spec[eq+1:]), "")
+	}
+	return tags
+}
+
+// authResTokens splits an Authentication-Results value into words, quoted
+// strings, "=" and ";", skipping comments.
+func authResTokens(s string) []string {
+	var tokens []string
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case c == '(':
+			depth := 0
+			for ; i < len(s); i++ {
+				if s[i] == '\\' {
+					i++
+				} else if s[i] == '(' {
+					depth++
+				} else if s[i] == ')' {
+					depth--
+					if depth == 0 {
+						i++
+						break
+					}
+				}
+			}
+		case c == '"':
+			var b strings.Builder
+			for i++; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				b.WriteByte(s[i])
+			}
+			i++
+			tokens = append(tokens, b.String())
+		case c == '=' || c == ';':
+			tokens = append(tokens, string(c))
+			i++
+		default:
+			stop := " \t\r\n()\"=;"
+			if len(tokens) > 0 && tokens[len(tokens)-1] == "=" {
+				// Values, like base64 in header.b, may hold "="
+				stop = " \t\r\n()\";"
+			}
+			j := i
+			for j < len(s) && !strings.ContainsRune(stop, rune(s[j])) {
+				j++
+			}
+			if j == i {
+				// A ")" without its "("
+				i++
+				continue
+			}
+			tokens = append(tokens, s[i:j])
+			i = j
+		}
+	}
+	return tokens
+}
+
+func isAllDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !isDigit(s[i]) {
+			return false
+		}
+	}
+	return s != ""
+}
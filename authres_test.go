@@ -0,0 +1,83 @@
+package enmime
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAuthenticationResults(t *testing.T) {
+	ar, err := ParseAuthenticationResults("mx.example.net;\r\n" +
+		" spf=pass (sender SPF authorized) smtp.mailfrom=bob@example.com;\r\n" +
+		" dkim=pass (2048-bit key) header.d=example.com header.i=@example.com header.b=AbC+d/e=;\r\n" +
+		" dmarc=fail reason=\"p=reject, failed alignment\" header.from=example.com;\r\n" +
+		" arc/1=none")
+	if assert.Nil(t, err) {
+		assert.Equal(t, "mx.example.net", ar.AuthServID)
+		assert.Equal(t, 1, ar.Version)
+		if assert.Equal(t, 4, len(ar.Results)) {
+			assert.Equal(t, AuthResult{"spf", "pass", "",
+				map[string]string{"smtp.mailfrom": "bob@example.com"}}, ar.Results[0])
+			assert.Equal(t, "example.com", ar.Results[1].Properties["header.d"])
+			assert.Equal(t, "@example.com", ar.Results[1].Properties["header.i"])
+			assert.Equal(t, "AbC+d/e=", ar.Results[1].Properties["header.b"])
+			assert.Equal(t, "fail", ar.Results[2].Result)
+			assert.Equal(t, "p=reject, failed alignment", ar.Results[2].Reason)
+			assert.Equal(t, "arc", ar.Results[3].Method)
+		}
+		assert.Equal(t, "pass", ar.Result("DKIM").Result)
+		assert.Nil(t, ar.Result("iprev"))
+	}
+
+	ar, err = ParseAuthenticationResults("example.org 1; none")
+	if assert.Nil(t, err) {
+		assert.Equal(t, "example.org", ar.AuthServID)
+		assert.Empty(t, ar.Results)
+	}
+
+	_, err = ParseAuthenticationResults(" ")
+	assert.NotNil(t, err)
+
+	// Unbalanced parentheses
+	ar, err = ParseAuthenticationResults("mx.example.com; spf=pass :) smtp.mailfrom=a@b; dkim=fail (bad ((key)")
+	if assert.Nil(t, err) && assert.Equal(t, 2, len(ar.Results)) {
+		assert.Equal(t, "a@b", ar.Results[0].Properties["smtp.mailfrom"])
+		assert.Equal(t, "fail", ar.Results[1].Result)
+	}
+}
+
+func TestMIMEBodyAuthenticationResults(t *testing.T) {
+	mime := parseHeaderOnly(t, "Authentication-Results: mx.example.net; spf=pass smtp.mailfrom=example.com\r\n"+
+		"Authentication-Results: forged.example; dkim=pass header.d=paypal.com")
+
+	assert.Equal(t, 2, len(mime.AuthenticationResults("")))
+	trusted := mime.AuthenticationResults("MX.example.net")
+	if assert.Equal(t, 1, len(trusted)) {
+		assert.Equal(t, "spf", trusted[0].Results[0].Method)
+	}
+}
+
+func TestARCSets(t *testing.T) {
+	mime := parseHeaderOnly(t, "ARC-Seal: i=2; a=rsa-sha256; cv=pass; d=relay.example; s=arc;\r\n"+
+		" b=dGVz\r\n dA==\r\n"+
+		"ARC-Message-Signature: i=2; a=rsa-sha256; c=relaxed/relaxed; d=relay.example;\r\n"+
+		" s=arc; h=from:to:subject; bh=aGFzaA==; b=c2ln\r\n"+
+		"ARC-Authentication-Results: i=2; relay.example; dkim=pass header.d=example.com\r\n"+
+		"ARC-Seal: i=1; a=rsa-sha256; cv=none; d=example.com; s=arc; b=Zmlyc3Q=\r\n"+
+		"ARC-Authentication-Results: i=1; mx.example.com; spf=pass smtp.mailfrom=example.com\r\n"+
+		"ARC-Seal: i=x; b=broken")
+
+	sets := mime.ARCSets()
+	if assert.Equal(t, 2, len(sets)) {
+		assert.Equal(t, 1, sets[0].Instance)
+		assert.Equal(t, "none", sets[0].Seal["cv"])
+		assert.Nil(t, sets[0].MessageSignature)
+		assert.Equal(t, "mx.example.com", sets[0].AuthenticationResults.AuthServID)
+
+		assert.Equal(t, 2, sets[1].Instance)
+		assert.Equal(t, "pass", sets[1].Seal["cv"])
+		assert.Equal(t, "dGVzdA==", sets[1].Seal["b"])
+		assert.Equal(t, "from:to:subject", sets[1].MessageSignature["h"])
+		assert.Equal(t, "pass", sets[1].AuthenticationResults.Result("dkim").Result)
+	}
+}
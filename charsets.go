@@ -8,6 +8,8 @@ import (
 	"io/ioutil"
 	"regexp"
 	"strings"
+	"sync"
+	"unicode/utf8"
 
 	"github.com/cention-sany/utf7"
 	"golang.org/x/text/encoding"
@@ -20,11 +22,14 @@ import (
 	"golang.org/x/text/transform"
 )
 
-/* copy from golang.org/x/net/html/charset/table.go */
-var encodings = map[string]struct {
+// charsetEntry is an encoding together with its canonical charset name.
+type charsetEntry struct {
 	e    encoding.Encoding
 	name string
-}{
+}
+
+/* copy from golang.org/x/net/html/charset/table.go */
+var encodings = map[string]charsetEntry{
 	"unicode-1-1-utf-8":   {encoding.Nop, "utf-8"},
 	"utf-8":               {encoding.Nop, "utf-8"},
 	"utf8":                {encoding.Nop, "utf-8"},
@@ -34,6 +39,10 @@ var encodings = map[string]struct {
 	"cp-850":              {charmap.CodePage850, "ibm850"},
 	"cp850":               {charmap.CodePage850, "ibm850"},
 	"ibm850":              {charmap.CodePage850, "ibm850"},
+	"cp1125":              {cp1125, "cp1125"},
+	"ibm1125":             {cp1125, "cp1125"},
+	"x-cp1125":            {cp1125, "cp1125"},
+	"ruscii":              {cp1125, "cp1125"},
 	"866":                 {charmap.CodePage866, "ibm866"},
 	"cp866":               {charmap.CodePage866, "ibm866"},
 	"csibm866":            {charmap.CodePage866, "ibm866"},
@@ -242,29 +251,164 @@ var encodings = map[string]struct {
 	"ksc5601":             {korean.EUCKR, "euc-kr"},
 	"ksc_5601":            {korean.EUCKR, "euc-kr"},
 	"windows-949":         {korean.EUCKR, "euc-kr"},
-	"csiso2022kr":         {encoding.Replacement, "replacement"},
-	"iso-2022-kr":         {encoding.Replacement, "replacement"},
-	"iso-2022-cn":         {encoding.Replacement, "replacement"},
-	"iso-2022-cn-ext":     {encoding.Replacement, "replacement"},
+	"csiso2022kr":         {iso2022KR, "iso-2022-kr"},
+	"iso-2022-kr":         {iso2022KR, "iso-2022-kr"},
+	"iso-2022-cn":         {iso2022CN, "iso-2022-cn"},
+	"iso-2022-cn-ext":     {iso2022CNExt, "iso-2022-cn-ext"},
 	"utf-16be":            {unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM), "utf-16be"},
 	"utf-16":              {unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM), "utf-16le"},
 	"utf-16le":            {unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM), "utf-16le"},
 	"x-user-defined":      {charmap.XUserDefined, "x-user-defined"},
+	// vendor labels seen in the wild, not part of the WHATWG table
+	"cp437":       {charmap.CodePage437, "ibm437"},
+	"ibm437":      {charmap.CodePage437, "ibm437"},
+	"cp936":       {simplifiedchinese.GBK, "gbk"},
+	"windows-936": {simplifiedchinese.GBK, "gbk"},
+	"cp949":       {korean.EUCKR, "euc-kr"},
+	"cp950":       {traditionalchinese.Big5, "big5"},
+	"windows-950": {traditionalchinese.Big5, "big5"},
 }
 
 var charsetRegexp *regexp.Regexp
 var errParsingCharset = errors.New("Could not find a valid charset in the HTML body")
 
+var (
+	// encodingsMu guards encodings and looseEncodings against concurrent
+	// registrations.
+	encodingsMu sync.RWMutex
+	// looseEncodings indexes encodings by looseCharsetLabel, to find labels
+	// with vendor specific punctuation such as "UTF_8" or "iso8859 1".
+	looseEncodings = make(map[string]charsetEntry)
+)
+
+func init() {
+	for label, entry := range encodings {
+		addLooseLabel(label, entry)
+	}
+}
+
+// RegisterCharset makes the encoding e available under the canonical charset
+// name and any additional aliases, replacing previous registrations of the
+// same labels.  Labels are matched case-insensitively.
+func RegisterCharset(name string, e encoding.Encoding, aliases ...string) error {
+	name = normalizeCharsetLabel(name)
+	if name == "" {
+		return errors.New("Empty charset name")
+	}
+	if e == nil {
+		return fmt.Errorf("Nil encoding for charset %s", name)
+	}
+	entry := charsetEntry{e, name}
+	encodingsMu.Lock()
+	defer encodingsMu.Unlock()
+	for _, label := range append([]string{name}, aliases...) {
+		label = normalizeCharsetLabel(label)
+		if label == "" {
+			continue
+		}
+		encodings[label] = entry
+		looseEncodings[looseCharsetLabel(label)] = entry
+	}
+	return nil
+}
+
+// RegisterCharsetAlias makes alias refer to the same encoding as the already
+// supported charset label.
+func RegisterCharsetAlias(alias, label string) error {
+	alias = normalizeCharsetLabel(alias)
+	if alias == "" {
+		return errors.New("Empty charset alias")
+	}
+	encodingsMu.Lock()
+	defer encodingsMu.Unlock()
+	entry, ok := lookupCharsetLocked(label)
+	if !ok {
+		return fmt.Errorf("Unsupported charset %s", label)
+	}
+	encodings[alias] = entry
+	looseEncodings[looseCharsetLabel(alias)] = entry
+	return nil
+}
+
+// IsCharsetSupported returns true if the charset label can be decoded by
+// ConvertToUTF8String, NewCharsetReader and DecodeHeader.
+func IsCharsetSupported(label string) bool {
+	_, ok := lookupCharset(label)
+	return ok
+}
+
+// CanonicalCharset maps a charset label to its canonical name, e.g. "latin1"
+// to "windows-1252".  It returns an empty string for unsupported labels.
+func CanonicalCharset(label string) string {
+	entry, ok := lookupCharset(label)
+	if !ok {
+		return ""
+	}
+	return entry.name
+}
+
+// CharsetEncoding returns the encoding registered for the charset label, or
+// nil for unsupported labels.
+func CharsetEncoding(label string) encoding.Encoding {
+	entry, ok := lookupCharset(label)
+	if !ok {
+		return nil
+	}
+	return entry.e
+}
+
+func lookupCharset(label string) (charsetEntry, bool) {
+	encodingsMu.RLock()
+	defer encodingsMu.RUnlock()
+	return lookupCharsetLocked(label)
+}
+
+func lookupCharsetLocked(label string) (charsetEntry, bool) {
+	label = normalizeCharsetLabel(label)
+	if entry, ok := encodings[label]; ok {
+		return entry, true
+	}
+	if strings.IndexFunc(label, func(r rune) bool { return r < ' ' || r == 0x7f }) >= 0 {
+		// Never guess the meaning of a label holding control characters
+		return charsetEntry{}, false
+	}
+	entry, ok := looseEncodings[looseCharsetLabel(label)]
+	return entry, ok
+}
+
+func addLooseLabel(label string, entry charsetEntry) {
+	loose := looseCharsetLabel(label)
+	if _, ok := looseEncodings[loose]; !ok || label == entry.name {
+		looseEncodings[loose] = entry
+	}
+}
+
+// normalizeCharsetLabel lower-cases a label and strips the whitespace and
+// quotes found around charset parameters in the wild.
+func normalizeCharsetLabel(label string) string {
+	return strings.ToLower(strings.Trim(label, " \t\r\n\"'"))
+}
+
+// looseCharsetLabel keeps only the letters and digits of a normalized label.
+func looseCharsetLabel(label string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return -1
+	}, label)
+}
+
 // ConvertToUTF8String uses the provided charset to decode a slice of bytes into a normal
 // UTF-8 string.
 func ConvertToUTF8String(charset string, textBytes []byte) (string, error) {
-	if strings.ToLower(charset) == "utf-8" {
-		return string(textBytes), nil
-	}
-	csentry, ok := encodings[strings.ToLower(charset)]
+	csentry, ok := lookupCharset(charset)
 	if !ok {
 		return string(textBytes), fmt.Errorf("Unsupport charset %s", charset)
 	}
+	if csentry.e == encoding.Nop {
+		return string(textBytes), nil
+	}
 	input := bytes.NewReader(textBytes)
 	reader := transform.NewReader(input, csentry.e.NewDecoder())
 	output, err := ioutil.ReadAll(reader)
@@ -280,16 +424,71 @@ func ConvertToUTF8String(charset string, textBytes []byte) (string, error) {
 //
 // This function is similar to: https://godoc.org/golang.org/x/net/html/charset#NewReaderLabel
 func NewCharsetReader(charset string, input io.Reader) (io.Reader, error) {
-	if strings.ToLower(charset) == "utf-8" {
-		return input, nil
-	}
-	csentry, ok := encodings[strings.ToLower(charset)]
+	csentry, ok := lookupCharset(charset)
 	if !ok {
 		return nil, fmt.Errorf("Unsupported charset %s", charset)
 	}
+	if csentry.e == encoding.Nop {
+		return input, nil
+	}
 	return transform.NewReader(input, csentry.e.NewDecoder()), nil
 }
 
+// decodeToUTF8 converts text declared to be in charset to UTF-8, and returns
+// the charset actually used.  When no charset is declared, or the declared one
+// is unsupported or decodes to invalid text, the charset is detected instead.
+// Text declared as UTF-8 is only second guessed when it is not valid UTF-8,
+// as latin-1 text mislabeled utf-8.  Damaged UTF-8, still holding some valid
+// multibyte sequences, is kept.
+func decodeToUTF8(charset string, textBytes []byte) (string, string, error) {
+	if charset == "" {
+		if isASCIIOrUTF8(textBytes) {
+			return string(textBytes), "", nil
+		}
+		if guess := detectCharset(textBytes); guess != "" {
+			if s, err := ConvertToUTF8String(guess, textBytes); err == nil {
+				return s, guess, nil
+			}
+		}
+		return string(textBytes), "", nil
+	}
+	s, err := ConvertToUTF8String(charset, textBytes)
+	if CanonicalCharset(charset) == "utf-8" {
+		if utf8.Valid(textBytes) || hasUTF8Sequences(textBytes) {
+			return s, charset, err
+		}
+	} else if err == nil && decodeValidity(s) == 1 {
+		return s, charset, err
+	}
+	if guess := detectCharset(textBytes); guess != "" && guess != charset {
+		if gs, gerr := ConvertToUTF8String(guess, textBytes); gerr == nil && decodeValidity(gs) == 1 {
+			return gs, guess, nil
+		}
+	}
+	return s, charset, err
+}
+
+// hasUTF8Sequences tells whether b holds a valid multibyte UTF-8 sequence.
+func hasUTF8Sequences(b []byte) bool {
+	for len(b) > 0 {
+		r, size := utf8.DecodeRune(b)
+		if size > 1 && r != utf8.RuneError {
+			return true
+		}
+		b = b[size:]
+	}
+	return false
+}
+
+func isASCIIOrUTF8(b []byte) bool {
+	for _, c := range b {
+		if c >= 0x80 {
+			return utf8.Valid(b)
+		}
+	}
+	return true
+}
+
 // Look for charset in the html meta tag (v4.01 and v5)
 func charsetFromHTMLString(htmlString string) (string, error) {
 	if charsetRegexp == nil {
@@ -7,6 +7,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/encoding/charmap"
 )
 
 // Test an invalid character set with the CharsetReader
@@ -39,3 +40,70 @@ func TestCharsetReader(t *testing.T) {
 			"Expected %q, got %q for input %q", tt.expect, result, tt.input)
 	}
 }
+
+// Test label normalization and canonical names
+func TestCanonicalCharset(t *testing.T) {
+	var testTable = []struct {
+		label, expect string
+	}{
+		{"utf-8", "utf-8"},
+		{"UTF8", "utf-8"},
+		{"UTF_8", "utf-8"},
+		{` "Latin1" `, "windows-1252"},
+		{"ISO_8859_2", "iso-8859-2"},
+		{"x-mac-cyrillic", "x-mac-cyrillic"},
+		{"CP936", "gbk"},
+		{"CP-1125", "cp1125"},
+		{"RUSCII", "cp1125"},
+		{"INVALIDcharsetZZZ", ""},
+	}
+
+	for _, tt := range testTable {
+		assert.Equal(t, tt.expect, CanonicalCharset(tt.label), "Label %q", tt.label)
+		assert.Equal(t, tt.expect != "", IsCharsetSupported(tt.label), "Label %q", tt.label)
+	}
+	assert.Nil(t, CharsetEncoding("INVALIDcharsetZZZ"))
+	assert.Equal(t, charmap.Windows1250, CharsetEncoding("cp1250"))
+}
+
+func TestCP1125(t *testing.T) {
+	result, err := ConvertToUTF8String("cp1125", []byte{0xf2, 0xf7, 0xf8, 0xaf, 0xf0, 0x41})
+	assert.Nil(t, err)
+	assert.Equal(t, "ҐіЇпЁA", result)
+
+	out, err := CharsetEncoding("cp1125").NewEncoder().String("ҐіЇпЁA")
+	assert.Nil(t, err)
+	assert.Equal(t, "\xf2\xf7\xf8\xaf\xf0A", out)
+
+	_, err = CharsetEncoding("cp1125").NewEncoder().String("Ў")
+	assert.NotNil(t, err, "Belarusian Ў is not in CP1125")
+}
+
+// Test registering new charsets and aliases
+func TestRegisterCharset(t *testing.T) {
+	assert.False(t, IsCharsetSupported("x-test-ibm866"))
+	_, err := ConvertToUTF8String("x-test-ibm866", []byte{0xaf})
+	assert.NotNil(t, err, "Unregistered charset should fail")
+
+	err = RegisterCharset("X-Test-IBM866", charmap.CodePage866, "x-test-dos-cyrillic")
+	assert.Nil(t, err)
+	assert.Equal(t, "x-test-ibm866", CanonicalCharset("x-test-dos-cyrillic"))
+
+	result, err := ConvertToUTF8String("x-test-ibm866", []byte{0xaf})
+	assert.Nil(t, err)
+	assert.Equal(t, "п", result)
+
+	reader, err := NewCharsetReader("X_TEST_DOS_CYRILLIC", bytes.NewReader([]byte{0xaf}))
+	assert.Nil(t, err)
+	out, err := ioutil.ReadAll(reader)
+	assert.Nil(t, err)
+	assert.Equal(t, "п", string(out))
+
+	assert.Nil(t, RegisterCharsetAlias("x-test-win-cyr", "cp1251"))
+	assert.Equal(t, "windows-1251", CanonicalCharset("x-test-win-cyr"))
+	assert.Equal(t, "Ж", DecodeHeader("=?x-test-win-cyr?q?=C6?="))
+
+	assert.NotNil(t, RegisterCharsetAlias("x-test-bogus", "INVALIDcharsetZZZ"))
+	assert.NotNil(t, RegisterCharset("", charmap.CodePage866))
+	assert.NotNil(t, RegisterCharset("x-test-nil", nil))
+}
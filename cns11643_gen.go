@@ -0,0 +1,104 @@
+//go:build ignore
+// +build ignore
+
+// This program generates cns11643.go from the EUC-TW converter of the GNU C
+// Library.  Run it with "go generate", it requires a glibc iconv binary.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"log"
+	"os/exec"
+	"strings"
+	"unicode"
+)
+
+// Number of planes of CNS 11643-1992 reached by ISO-2022-CN-EXT
+const planes = 7
+
+func main() {
+	var in bytes.Buffer
+	for plane := 1; plane <= planes; plane++ {
+		for row := 0x21; row <= 0x7e; row++ {
+			for col := 0x21; col <= 0x7e; col++ {
+				if plane > 1 {
+					in.Write([]byte{0x8e, byte(0xa0 + plane)})
+				}
+				in.Write([]byte{byte(row | 0x80), byte(col | 0x80), '\n'})
+			}
+		}
+	}
+	cmd := exec.Command("iconv", "-c", "-f", "EUC-TW", "-t", "UTF-8")
+	cmd.Stdin = &in
+	out, err := cmd.Output()
+	if err != nil {
+		log.Fatal(err)
+	}
+	cells := strings.Split(string(out), "\n")
+	if len(cells) != planes*94*94+1 {
+		log.Fatalf("iconv returned %d cells", len(cells))
+	}
+	// iconv -c skips the SS2 byte of an invalid cell of planes 2 to 7, and
+	// reads the next two bytes as a plane 1 character.  Check the cells that
+	// decoded to that character on their own.
+	for plane := 2; plane <= planes; plane++ {
+		for row := 0x21; row <= 0x7e; row++ {
+			skipped := cells[(0x20+plane-0x21)*94+row-0x21]
+			for col := 0x21; col <= 0x7e; col++ {
+				i := ((plane-1)*94+row-0x21)*94 + col - 0x21
+				if cells[i] != skipped {
+					continue
+				}
+				cmd := exec.Command("iconv", "-f", "EUC-TW", "-t", "UTF-8")
+				cmd.Stdin = bytes.NewReader([]byte{0x8e, byte(0xa0 + plane), byte(row | 0x80), byte(col | 0x80)})
+				if out, err := cmd.Output(); err != nil {
+					cells[i] = ""
+				} else {
+					cells[i] = string(out)
+				}
+			}
+		}
+	}
+
+	var b bytes.Buffer
+	b.WriteString("// Code generated by cns11643_gen.go; DO NOT EDIT.\n\n")
+	b.WriteString("package enmime\n\n")
+	b.WriteString("// cns11643Planes holds the planes 1 to 7 of CNS 11643-1992, one row of 94\n")
+	b.WriteString("// characters per line, from row 0x21 to 0x7E.  Unassigned cells are U+FFFD.\n")
+	fmt.Fprintf(&b, "var cns11643Planes = [%d]string{\n", planes)
+	for plane := 0; plane < planes; plane++ {
+		fmt.Fprintf(&b, "// Plane %d\n", plane+1)
+		for row := 0; row < 94; row++ {
+			b.WriteByte('"')
+			for col := 0; col < 94; col++ {
+				cell := []rune(cells[(plane*94+row)*94+col])
+				switch {
+				case len(cell) != 1:
+					b.WriteString(`\ufffd`)
+				case unicode.IsPrint(cell[0]) && !unicode.IsSpace(cell[0]) &&
+					!unicode.Is(unicode.Mn, cell[0]) && cell[0] != '"' && cell[0] != '\\':
+					b.WriteRune(cell[0])
+				default:
+					fmt.Fprintf(&b, `\u%04x`, cell[0])
+				}
+			}
+			if row < 93 {
+				b.WriteString("\" +\n")
+			} else {
+				b.WriteString("\",\n")
+			}
+		}
+	}
+	b.WriteString("}\n")
+
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile("cns11643.go", src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,100 @@
+package enmime
+
+import (
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/transform"
+)
+
+// CP1125, also known as RUSCII, the Ukrainian DOS code page.  It is IBM 866
+// with the Ukrainian letters in place of the Belarusian ones at 0xF2-0xF9.
+var cp1125 encoding.Encoding = newCodePage("IBM CP1125", charmap.CodePage866, map[byte]rune{
+	0xf2: 'Ґ', 0xf3: 'ґ', 0xf4: 'Є', 0xf5: 'є',
+	0xf6: 'І', 0xf7: 'і', 0xf8: 'Ї', 0xf9: 'ї',
+})
+
+// codePage is a single byte charset derived from a charmap.Charmap.
+type codePage struct {
+	name   string
+	decode [256]rune
+	encode map[rune]byte
+}
+
+// newCodePage returns the charset of base with the bytes of changes mapped to
+// other runes.
+func newCodePage(name string, base *charmap.Charmap, changes map[byte]rune) *codePage {
+	cp := &codePage{name: name, encode: make(map[rune]byte, 256)}
+	for i := 255; i >= 0; i-- {
+		r, ok := changes[byte(i)]
+		if !ok {
+			r = base.DecodeByte(byte(i))
+		}
+		cp.decode[i] = r
+		cp.encode[r] = byte(i)
+	}
+	return cp
+}
+
+func (cp *codePage) NewDecoder() *encoding.Decoder {
+	return &encoding.Decoder{Transformer: codePageDecoder{cp}}
+}
+
+func (cp *codePage) NewEncoder() *encoding.Encoder {
+	return &encoding.Encoder{Transformer: codePageEncoder{cp}}
+}
+
+func (cp *codePage) String() string { return cp.name }
+
+type codePageDecoder struct{ cp *codePage }
+
+func (d codePageDecoder) Reset() {}
+
+func (d codePageDecoder) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error) {
+	for ; nSrc < len(src); nSrc++ {
+		r := d.cp.decode[src[nSrc]]
+		if nDst+utf8.RuneLen(r) > len(dst) {
+			return nDst, nSrc, transform.ErrShortDst
+		}
+		nDst += utf8.EncodeRune(dst[nDst:], r)
+	}
+	return nDst, nSrc, nil
+}
+
+// repertoireError is returned by the encoders of this package for runes the
+// charset cannot represent, so encoding.ReplaceUnsupported can replace them.
+type repertoireError byte
+
+func (e repertoireError) Error() string {
+	return "encoding: rune not supported by encoding."
+}
+
+func (e repertoireError) Replacement() byte { return byte(e) }
+
+type codePageEncoder struct{ cp *codePage }
+
+func (e codePageEncoder) Reset() {}
+
+func (e codePageEncoder) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error) {
+	for nSrc < len(src) {
+		r, size := rune(src[nSrc]), 1
+		if r >= utf8.RuneSelf {
+			if !atEOF && !utf8.FullRune(src[nSrc:]) {
+				return nDst, nSrc, transform.ErrShortSrc
+			}
+			r, size = utf8.DecodeRune(src[nSrc:])
+		}
+		b, ok := e.cp.encode[r]
+		if !ok {
+			return nDst, nSrc, repertoireError(0x1a)
+		}
+		if nDst >= len(dst) {
+			return nDst, nSrc, transform.ErrShortDst
+		}
+		dst[nDst] = b
+		nDst++
+		nSrc += size
+	}
+	return nDst, nSrc, nil
+}
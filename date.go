@@ -0,0 +1,315 @@
+package enmime
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cention-sany/net/mail"
+)
+
+// Offsets of the zone names seen in Date headers, in seconds east of UTC
+var dateZones = map[string]int{
+	"UT": 0, "UTC": 0, "GMT": 0, "Z": 0, "WET": 0,
+	"EST": -5 * 3600, "EDT": -4 * 3600,
+	"CST": -6 * 3600, "CDT": -5 * 3600,
+	"MST": -7 * 3600, "MDT": -6 * 3600,
+	"PST": -8 * 3600, "PDT": -7 * 3600,
+	"AKST": -9 * 3600, "AKDT": -8 * 3600,
+	"HST": -10 * 3600,
+	"BST": 3600, "IST": 19800, "CET": 3600, "MET": 3600, "MEZ": 3600, "WEST": 3600,
+	"CEST": 2 * 3600, "MEST": 2 * 3600, "MESZ": 2 * 3600, "EET": 2 * 3600,
+	"EEST": 3 * 3600, "MSK": 3 * 3600,
+	"CCT": 8 * 3600, "HKT": 8 * 3600, "SGT": 8 * 3600, "AWST": 8 * 3600,
+	"JST": 9 * 3600, "KST": 9 * 3600,
+	"AEST": 10 * 3600, "AEDT": 11 * 3600, "NZST": 12 * 3600, "NZDT": 13 * 3600,
+}
+
+var dateMonths = map[string]time.Month{
+	"jan": time.January, "feb": time.February, "mar": time.March, "apr": time.April,
+	"may": time.May, "jun": time.June, "jul": time.July, "aug": time.August,
+	"sep": time.September, "oct": time.October, "nov": time.November, "dec": time.December,
+}
+
+// ParseDate parses the value of a Date header, or the date of a Received
+// header.  Besides RFC 5322 dates it accepts what broken clients send:
+// missing day names or seconds, asctime and ISO 8601 layouts, named or
+// missing zones, two-digit years and trailing garbage.  Dates without zone
+// are taken as UTC.
+func ParseDate(value string) (time.Time, error) {
+	var (
+		day, year  = -1, -1
+		month      time.Month
+		hour, min  = -1, 0
+		sec, nsec  int
+		pm, am     bool
+		offset     int
+		zoneName   string
+		hasZone    bool
+		yearDigits int
+	)
+
+	tokens := dateTokens(stripComments(value))
+	for i := 0; i < len(tokens); i++ {
+		tok := tokens[i]
+		if len(tok) == 0 {
+			continue
+		}
+		lower := strings.ToLower(tok)
+		switch {
+		case hour < 0 && strings.Count(tok, ":") >= 1 && isDigit(tok[0]):
+			if !parseClock(tok, &hour, &min, &sec, &nsec) {
+				return time.Time{}, fmt.Errorf("Invalid time %q in date %q", tok, value)
+			}
+			// An ISO 8601 zone may be glued to the time
+			if z := clockZone(tok); z != "" {
+				if o, ok := parseZoneOffset(z); ok {
+					offset, hasZone = o, true
+				}
+			}
+		case strings.Count(tok, "-") == 2 && year < 0 && isDigit(tok[0]) || strings.Count(tok, "/") == 2:
+			parseNumericDate(tok, &year, &month, &day, &yearDigits)
+		case (tok[0] == '+' || tok[0] == '-') && len(tok) > 1 && isDigit(tok[1]):
+			if o, ok := parseZoneOffset(tok); ok && !hasZone {
+				offset, hasZone = o, true
+			}
+		case lower == "am" || lower == "a.m.":
+			am = true
+		case lower == "pm" || lower == "p.m.":
+			pm = true
+		case isDigit(tok[0]):
+			n, err := strconv.Atoi(strings.TrimRight(tok, "."))
+			switch {
+			case err != nil:
+				// Garbage
+			case day < 0 && len(tok) <= 2 && n >= 1 && n <= 31 && (month == 0 || year < 0):
+				day = n
+			case year < 0:
+				year, yearDigits = n, len(tok)
+			}
+		default:
+			if m, ok := dateMonths[lowerPrefix(lower, 3)]; ok && month == 0 && isMonthName(lower) {
+				month = m
+				continue
+			}
+			if o, ok := dateZones[strings.ToUpper(tok)]; ok && !hasZone {
+				offset, hasZone, zoneName = o, true, strings.ToUpper(tok)
+				continue
+			}
+			// Day names and garbage
+		}
+	}
+
+	if day < 0 || month == 0 || year < 0 {
+		return time.Time{}, fmt.Errorf("Unable to parse date %q", value)
+	}
+	switch {
+	case yearDigits <= 2 && year < 50:
+		year += 2000
+	case yearDigits <= 2, yearDigits == 3:
+		year += 1900
+	}
+	if hour < 0 {
+		hour = 0
+	}
+	if pm && hour < 12 {
+		hour += 12
+	} else if am && hour == 12 {
+		hour = 0
+	}
+	if sec == 60 {
+		// Leap second
+		sec = 59
+	}
+	if hour > 23 || min > 59 || sec > 59 {
+		return time.Time{}, fmt.Errorf("Invalid time in date %q", value)
+	}
+
+	loc := time.UTC
+	if hasZone {
+		if zoneName == "" && offset != 0 {
+			loc = time.FixedZone("", offset)
+		} else if zoneName != "" {
+			loc = time.FixedZone(zoneName, offset)
+		}
+	}
+	t := time.Date(year, month, day, hour, min, sec, nsec, loc)
+	if t.Day() != day {
+		return time.Time{}, fmt.Errorf("Invalid day in date %q", value)
+	}
+	return t, nil
+}
+
+// Date parses the Date header of the message with ParseDate.
+func (m *MIMEBody) Date() (time.Time, error) {
+	value := m.header.Get("Date")
+	if value == "" {
+		return time.Time{}, mail.ErrHeaderNotPresent
+	}
+	return ParseDate(value)
+}
+
+// stripComments removes RFC 5322 comments, which may nest.
+func stripComments(s string) string {
+	if !strings.Contains(s, "(") {
+		return s
+	}
+	var b strings.Builder
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\' && depth > 0:
+			i++
+		case c == '(':
+			depth++
+			b.WriteByte(' ')
+		case c == ')' && depth > 0:
+			depth--
+		case depth == 0:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// dateTokens splits a date at white space and commas.  Day-month-year dates
+// with month names, like 01-Jul-2003, are split at the dashes too.
+func dateTokens(s string) []string {
+	var tokens []string
+	for _, f := range strings.FieldsFunc(s, func(r rune) bool {
+		return r == ' ' || r == '\t' || r == '\r' || r == '\n' || r == ','
+	}) {
+		if parts := strings.Split(f, "-"); len(parts) == 3 && len(parts[1]) >= 3 &&
+			!isDigit(parts[1][0]) && isDigit(f[0]) {
+			for _, p := range parts {
+				if p != "" {
+					tokens = append(tokens, p)
+				}
+			}
+			continue
+		}
+		// ISO 8601 date and time
+		if i := strings.IndexAny(f, "Tt"); i == 10 && strings.Count(f[:i], "-") == 2 {
+			tokens = append(tokens, f[:i])
+			if i+1 < len(f) {
+				tokens = append(tokens, f[i+1:])
+			}
+			continue
+		}
+		tokens = append(tokens, f)
+	}
+	return tokens
+}
+
+// parseClock parses hh:mm, hh:mm:ss or hh:mm:ss.fraction, ignoring any zone
+// that follows.
+func parseClock(tok string, hour, min, sec, nsec *int) bool {
+	tok = strings.TrimSuffix(tok, clockZone(tok))
+	frac := ""
+	if i := strings.IndexByte(tok, '.'); i >= 0 {
+		tok, frac = tok[:i], tok[i+1:]
+	}
+	parts := strings.Split(tok, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return false
+	}
+	var vals [3]int
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || len(p) > 2 {
+			return false
+		}
+		vals[i] = n
+	}
+	*hour, *min, *sec = vals[0], vals[1], vals[2]
+	if frac != "" {
+		if n, err := strconv.Atoi((frac + "000000000")[:9]); err == nil {
+			*nsec = n
+		}
+	}
+	return true
+}
+
+// clockZone returns the ISO 8601 zone suffix of a time like 10:52:37+02:00.
+func clockZone(tok string) string {
+	if i := strings.IndexAny(tok, "+-Zz"); i > 0 {
+		return tok[i:]
+	}
+	return ""
+}
+
+// parseZoneOffset parses +hhmm, -hh:mm, +hh or Z.
+func parseZoneOffset(z string) (int, bool) {
+	if z == "Z" || z == "z" {
+		return 0, true
+	}
+	if len(z) < 3 || (z[0] != '+' && z[0] != '-') {
+		return 0, false
+	}
+	digits := strings.Replace(z[1:], ":", "", 1)
+	if len(digits) == 2 {
+		digits += "00"
+	}
+	if len(digits) != 4 {
+		return 0, false
+	}
+	n, err := strconv.Atoi(digits)
+	if err != nil || n/100 > 14 || n%100 > 59 {
+		return 0, false
+	}
+	offset := (n/100)*3600 + (n%100)*60
+	if z[0] == '-' {
+		offset = -offset
+	}
+	return offset, true
+}
+
+// parseNumericDate parses yyyy-mm-dd, yyyy/mm/dd and dd/mm/yyyy.
+func parseNumericDate(tok string, year *int, month *time.Month, day *int, yearDigits *int) bool {
+	parts := strings.FieldsFunc(tok, func(r rune) bool { return r == '-' || r == '/' })
+	if len(parts) != 3 {
+		return false
+	}
+	var vals [3]int
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return false
+		}
+		vals[i] = n
+	}
+	y, m, d, digits := vals[0], vals[1], vals[2], len(parts[0])
+	if len(parts[0]) <= 2 {
+		y, d, digits = vals[2], vals[0], len(parts[2])
+	}
+	if m < 1 || m > 12 || d < 1 || d > 31 {
+		return false
+	}
+	*year, *month, *day, *yearDigits = y, time.Month(m), d, digits
+	return true
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+func lowerPrefix(s string, n int) string {
+	if len(s) < n {
+		return s
+	}
+	return s[:n]
+}
+
+// isMonthName accepts the abbreviated and full month names.
+func isMonthName(lower string) bool {
+	lower = strings.TrimSuffix(lower, ".")
+	if len(lower) == 3 {
+		return true
+	}
+	for _, name := range []string{"january", "february", "march", "april", "may", "june",
+		"july", "august", "september", "sept", "october", "november", "december"} {
+		if lower == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,66 @@
+package enmime
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDate(t *testing.T) {
+	cest := time.FixedZone("", 2*3600)
+	expect := time.Date(2003, time.July, 1, 10, 52, 37, 0, cest)
+	var testTable = []struct {
+		input  string
+		expect time.Time
+	}{
+		{"Tue, 1 Jul 2003 10:52:37 +0200", expect},
+		{"Tue, 01 Jul 2003 10:52:37 +0200 (CEST)", expect},
+		{"1 Jul 2003 10:52:37 +0200", expect},
+		{"Tuesday, 1 July 2003 10:52:37 +0200", expect},
+		{"Tue,1 Jul 2003 10:52:37 +0200", expect},
+		{"Tue, 1 Jul 03 10:52:37 +0200", expect},
+		{"Tue, 1 Jul 2003 10:52:37 +02:00", expect},
+		{"Tue, 1 Jul 2003 08:52:37 GMT", expect},
+		{"Tue, 1 Jul 2003 01:52:37 PDT", expect},
+		{"Tue, 1 Jul 2003 10:52:37 CEST", expect},
+		{"Tue, 1 Jul 2003 10:52:37 +0200 garbage 123", expect},
+		{"Tue Jul  1 08:52:37 2003", expect},
+		{"01-Jul-2003 10:52:37 +0200", expect},
+		{"2003-07-01T10:52:37+02:00", expect},
+		{"2003-07-01 08:52:37Z", expect},
+		{"Tue, 1 Jul 2003 10:52 PM +0200", time.Date(2003, time.July, 1, 22, 52, 0, 0, cest)},
+		{"Tue, 1 Jul 2003 10:52 +0200", time.Date(2003, time.July, 1, 10, 52, 0, 0, cest)},
+		{"1 Jul 99 10:52:37 +0200", time.Date(1999, time.July, 1, 10, 52, 37, 0, cest)},
+		{"1 Jul 103 10:52:37 +0200", expect},
+		{"Tue, 1 Jul 2003", time.Date(2003, time.July, 1, 0, 0, 0, 0, time.UTC)},
+		{"2003-07-01T", time.Date(2003, time.July, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range testTable {
+		result, err := ParseDate(tt.input)
+		if assert.Nil(t, err, "Input %q", tt.input) {
+			assert.True(t, tt.expect.Equal(result), "Expected %v, got %v for input %q",
+				tt.expect, result, tt.input)
+		}
+	}
+
+	for _, input := range []string{"", "yesterday", "Tue, 31 Feb 2003 10:52:37 +0200",
+		"Tue, 1 Jul 2003 25:52:37 +0200", "Jul 2003", "01-Jul- 12:00", "-- , T"} {
+		_, err := ParseDate(input)
+		assert.NotNil(t, err, "Input %q", input)
+	}
+}
+
+func TestMIMEBodyDate(t *testing.T) {
+	mime := parseHeaderOnly(t, "Date: Tue, 1 Jul 2003 10:52:37 +0200 (CEST)")
+	date, err := mime.Date()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1057049557), date.Unix())
+	_, offset := date.Zone()
+	assert.Equal(t, 7200, offset)
+
+	mime = parseHeaderOnly(t, "Subject: no date")
+	_, err = mime.Date()
+	assert.NotNil(t, err)
+}
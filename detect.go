@@ -0,0 +1,369 @@
+package enmime
+
+import (
+	"bytes"
+	"sort"
+	"unicode"
+	"unicode/utf8"
+)
+
+// CharsetGuess is a candidate charset reported by DetectCharset.
+type CharsetGuess struct {
+	Charset    string  // Charset label usable with ConvertToUTF8String
+	Confidence float64 // Between 0 (no idea) and 1 (certain)
+}
+
+// minDetectConfidence is the confidence a guess needs before enmime uses it to
+// decode text of an unknown or wrongly declared charset.
+const minDetectConfidence = 0.3
+
+// charsetModel scores how plausible the output of decoding with charset is.
+type charsetModel struct {
+	charset string
+	prior   float64 // Preference among charsets decoding alike
+	score   func(s string) float64
+}
+
+var charsetModels = []charsetModel{
+	{"windows-1252", 1.0, scoreWesternLatin},
+	{"windows-1250", 0.9, scoreCentralLatin},
+	{"windows-1251", 1.0, scoreCyrillic},
+	{"koi8-r", 1.0, scoreCyrillic},
+	{"iso-8859-5", 0.9, scoreCyrillic},
+	{"ibm866", 0.9, scoreCyrillic},
+	{"x-mac-cyrillic", 0.8, scoreCyrillic},
+	{"shift_jis", 1.0, scoreJapanese},
+	{"euc-jp", 1.0, scoreJapanese},
+	{"gb18030", 1.0, scoreChinese},
+	{"big5", 1.0, scoreChinese},
+	{"euc-kr", 1.0, scoreKorean},
+}
+
+// DetectCharset guesses the charset of unlabeled text from the byte patterns
+// and the character frequencies each candidate charset decodes it into.
+// Guesses are returned best first; pure ASCII input returns "us-ascii" and
+// valid UTF-8 returns "utf-8" with a high confidence.
+func DetectCharset(data []byte) []CharsetGuess {
+	if len(data) == 0 {
+		return nil
+	}
+	switch {
+	case bytes.HasPrefix(data, []byte{0xef, 0xbb, 0xbf}):
+		return []CharsetGuess{{"utf-8", 1}}
+	case bytes.HasPrefix(data, []byte{0xfe, 0xff}):
+		return []CharsetGuess{{"utf-16be", 1}}
+	case bytes.HasPrefix(data, []byte{0xff, 0xfe}):
+		return []CharsetGuess{{"utf-16le", 1}}
+	}
+
+	highBytes := 0
+	for _, b := range data {
+		if b >= 0x80 {
+			highBytes++
+		}
+	}
+	if highBytes == 0 {
+		if cs := detectEscapeCharset(data); cs != "" {
+			return []CharsetGuess{{cs, 0.95}}
+		}
+		return []CharsetGuess{{"us-ascii", 1}}
+	}
+
+	var guesses []CharsetGuess
+	if utf8.Valid(data) {
+		// Legacy 8-bit text is very rarely valid UTF-8 by accident
+		conf := 0.8
+		if highBytes >= 4 {
+			conf = 1
+		}
+		guesses = append(guesses, CharsetGuess{"utf-8", conf})
+	}
+	for _, m := range charsetModels {
+		e := CharsetEncoding(m.charset)
+		if e == nil {
+			continue
+		}
+		s, err := e.NewDecoder().String(string(data))
+		if err != nil {
+			continue
+		}
+		conf := m.prior * decodeValidity(s) * m.score(s) * evidence(highBytes)
+		if conf > 0 {
+			guesses = append(guesses, CharsetGuess{m.charset, conf})
+		}
+	}
+	sort.SliceStable(guesses, func(i, j int) bool {
+		return guesses[i].Confidence > guesses[j].Confidence
+	})
+	return guesses
+}
+
+// detectCharset returns the best guess of DetectCharset if it is confident
+// enough, or an empty string.
+func detectCharset(data []byte) string {
+	guesses := DetectCharset(data)
+	if len(guesses) == 0 || guesses[0].Confidence < minDetectConfidence {
+		return ""
+	}
+	return guesses[0].Charset
+}
+
+// detectEscapeCharset recognizes 7-bit charsets by their escape sequences.
+func detectEscapeCharset(data []byte) string {
+	if bytes.IndexByte(data, 0x1b) < 0 {
+		return ""
+	}
+	for _, esc := range []string{"\x1b$B", "\x1b$@", "\x1b(J", "\x1b(I"} {
+		if bytes.Contains(data, []byte(esc)) {
+			return "iso-2022-jp"
+		}
+	}
+	switch {
+	case bytes.Contains(data, []byte("\x1b$)C")):
+		return "iso-2022-kr"
+	case bytes.Contains(data, []byte("\x1b$+")):
+		return "iso-2022-cn-ext"
+	case bytes.Contains(data, []byte("\x1b$)A")), bytes.Contains(data, []byte("\x1b$)G")),
+		bytes.Contains(data, []byte("\x1b$)E")), bytes.Contains(data, []byte("\x1b$*H")):
+		return "iso-2022-cn"
+	}
+	return ""
+}
+
+// decodeValidity penalizes decoded text holding replacement characters or C1
+// controls, which means the bytes were not valid in the decoded charset.
+func decodeValidity(s string) float64 {
+	var n, invalid float64
+	for _, r := range s {
+		if r < 0x80 {
+			continue
+		}
+		n++
+		if r == utf8.RuneError || (r >= 0x80 && r <= 0x9f) {
+			invalid++
+		}
+	}
+	if n == 0 {
+		return 1
+	}
+	v := 1 - 3*invalid/n
+	if v < 0 {
+		return 0
+	}
+	return v
+}
+
+// evidence lowers the confidence for inputs with only a few 8-bit bytes.
+func evidence(highBytes int) float64 {
+	e := float64(highBytes) / 24
+	if e > 1 {
+		e = 1
+	}
+	return 0.6 + 0.4*e
+}
+
+// textStats counts the character classes of decoded text.
+type textStats struct {
+	letters      float64 // All letters, including ASCII
+	nonASCII     float64 // Runes above U+007F
+	nonASCIILtrs float64 // Letters above U+007F
+}
+
+func statsOf(s string) textStats {
+	var st textStats
+	for _, r := range s {
+		if unicode.IsLetter(r) {
+			st.letters++
+		}
+		if r >= 0x80 {
+			st.nonASCII++
+			if unicode.IsLetter(r) {
+				st.nonASCIILtrs++
+			}
+		}
+	}
+	return st
+}
+
+// scoreLatin rates text in a Latin script: the non-ASCII characters should be
+// common accented letters or punctuation, and a minority among the letters.
+func scoreLatin(s string, common map[rune]float64) float64 {
+	st := statsOf(s)
+	if st.nonASCII == 0 || st.letters == 0 {
+		return 0
+	}
+	var good float64
+	for _, r := range s {
+		if r >= 0x80 {
+			good += common[r]
+		}
+	}
+	density := 1.0
+	if ratio := st.nonASCIILtrs / st.letters; ratio > 0.2 {
+		density = 1 - (ratio-0.2)/0.3
+		if density < 0 {
+			density = 0
+		}
+	}
+	return good / st.nonASCII * density
+}
+
+func scoreWesternLatin(s string) float64 {
+	return scoreLatin(s, westernLatin)
+}
+
+func scoreCentralLatin(s string) float64 {
+	return scoreLatin(s, centralLatin)
+}
+
+// scoreCyrillic rates text in Cyrillic: most letters should be lower case
+// Cyrillic and follow the Russian and Ukrainian letter frequencies.
+func scoreCyrillic(s string) float64 {
+	st := statsOf(s)
+	var cyr, weight float64
+	for _, r := range s {
+		if !unicode.Is(unicode.Cyrillic, r) {
+			continue
+		}
+		cyr++
+		lr := unicode.ToLower(r)
+		f := cyrillicFrequency[lr]
+		if lr != r {
+			f *= 0.3
+		}
+		weight += f
+	}
+	if cyr == 0 {
+		return 0
+	}
+	freq := weight / cyr / 5.5
+	if freq > 1 {
+		freq = 1
+	}
+	density := cyr / st.letters / 0.5
+	if density > 1 {
+		density = 1
+	}
+	return freq * density * cyr / st.nonASCII
+}
+
+// cjkStats counts the character classes of decoded CJK text.
+type cjkStats struct {
+	n, kana, halfKana, han, commonHan, hangul, commonHangul, punct float64
+}
+
+func cjkStatsOf(s string) cjkStats {
+	var st cjkStats
+	for _, r := range s {
+		if r < 0x80 {
+			continue
+		}
+		st.n++
+		switch {
+		case r >= 0x3040 && r <= 0x30ff:
+			st.kana++
+		case r >= 0xff61 && r <= 0xff9f:
+			st.halfKana++
+		case unicode.Is(unicode.Han, r):
+			st.han++
+			if commonHan[r] {
+				st.commonHan++
+			}
+		case unicode.Is(unicode.Hangul, r):
+			st.hangul++
+			if commonHangul[r] {
+				st.commonHangul++
+			}
+		case (r >= 0x3000 && r <= 0x303f) || (r >= 0xff01 && r <= 0xff5e) ||
+			(r >= 0x2010 && r <= 0x203b):
+			st.punct++
+		}
+	}
+	return st
+}
+
+func scoreJapanese(s string) float64 {
+	st := cjkStatsOf(s)
+	if st.n == 0 {
+		return 0
+	}
+	score := (st.kana + st.punct + st.commonHan + 0.4*(st.han-st.commonHan) +
+		0.2*st.halfKana) / st.n
+	if st.kana/st.n < 0.05 {
+		// Japanese prose without any kana is unusual
+		score *= 0.5
+	}
+	return score
+}
+
+func scoreChinese(s string) float64 {
+	st := cjkStatsOf(s)
+	if st.n == 0 {
+		return 0
+	}
+	score := (st.commonHan + 0.3*(st.han-st.commonHan) + st.punct) / st.n
+	if (st.kana+st.halfKana)/st.n > 0.1 {
+		score *= 0.5
+	}
+	return score
+}
+
+func scoreKorean(s string) float64 {
+	st := cjkStatsOf(s)
+	if st.n == 0 {
+		return 0
+	}
+	return (st.commonHangul + 0.5*(st.hangul-st.commonHangul) + st.punct + 0.2*st.han) / st.n
+}
+
+func runeSet(s string) map[rune]bool {
+	m := make(map[rune]bool)
+	for _, r := range s {
+		m[r] = true
+	}
+	return m
+}
+
+func runeWeights(weights map[float64]string) map[rune]float64 {
+	m := make(map[rune]float64)
+	for w, s := range weights {
+		for _, r := range s {
+			m[r] = w
+		}
+	}
+	return m
+}
+
+// Typographic punctuation common in any Latin text
+const latinPunctuation = "‘’“”–—…•€ «»°©®¿¡§£"
+
+var westernLatin = runeWeights(map[float64]string{
+	1.0: "àáâãäåæçèéêëíîïñòóôõöøùúûüßÀÁÂÃÄÅÆÇÈÉÊËÍÎÑÓÔÕÖØÚÜœŒ" + latinPunctuation,
+	0.5: "ìýÿðþÌÏÒÙÛÝÐÞªº·",
+})
+
+var centralLatin = runeWeights(map[float64]string{
+	1.0: "ąćęłńóśźżčďěňřšťůžáéíýúőűöüäôĺľŕçĄĆĘŁŃÓŚŹŻČĎĚŇŘŠŤŮŽÁÉÍÝÚŐŰÖÜÄÔ" + latinPunctuation,
+	0.5: "âîăşţÂÎĂŞŢ",
+})
+
+// Approximate letter frequencies of Russian text in percent, with the
+// additional Ukrainian and Belarusian letters.
+var cyrillicFrequency = map[rune]float64{
+	'о': 10.97, 'е': 8.45, 'а': 8.01, 'и': 7.35, 'н': 6.70, 'т': 6.26, 'с': 5.47,
+	'р': 4.73, 'в': 4.54, 'л': 4.40, 'к': 3.49, 'м': 3.21, 'д': 2.98, 'п': 2.81,
+	'у': 2.62, 'я': 2.01, 'ы': 1.90, 'ь': 1.74, 'г': 1.70, 'з': 1.65, 'б': 1.59,
+	'ч': 1.44, 'й': 1.21, 'х': 0.97, 'ж': 0.94, 'ш': 0.73, 'ю': 0.64, 'ц': 0.48,
+	'щ': 0.36, 'э': 0.32, 'ф': 0.26, 'ъ': 0.04, 'ё': 0.04,
+	'і': 5.0, 'ї': 0.8, 'є': 0.8, 'ґ': 0.1, 'ў': 1.0,
+}
+
+// Frequently used Han characters of simplified Chinese, traditional Chinese
+// and Japanese.
+var commonHan = runeSet(
+	"的一是不了在人有我他这个们中来上大为和国地到以说时要就出会可也你对生能而子那得于着下自之年过发后作里用道行所然家种事成方多经么去法学如都同现当没动面起看定天分还进好小部其些主样理心她本前开但因只从想实日军者意无力它与长把机十民第公此已工使情明性知全三又关点正业外将两高间由问很最重并物手应战向头文体政美相见被利什二等产或新己制身果加西斯月话合回特代内信表化老给世位次度门任常先海通教儿原东声提立及比员解水名真论处走义各入几口认条平系气题活尔更别打女变四神总何电数安少报才结反受目太量再感建务做接必场件计管期市直德资命山金指克许统区保至队形社便空决治展马科司五基眼书非则听白却界达光放强即像难且权思王象完设式色路记南品住告类求据程北边死张该交规万取拉格望觉术领共确传师观清今切院让识候带导争运笑飞风步改收根干造言联持组每济车亲极林服快办议往元英士证近失转夫令准布始怎呢存未远叫台单影具罗字爱击流备兵连调深商算质团集百需价花党华城石级整府离况亚请技际约示复病息究线似官火断精满支视消越器容照须九增研写称企八功吗包片史委乎查轻易早曾除农找装广显吧阿李标谈吃图念六引历首医局突专费号尽另周较注语仅考落青随选列武红响虽推势参希古众构房半节土投某案黑维革划敌致陈律足态护七兴派孩验责营星够章音跟志底站严巴例防族供效续施留讲型料终答紧黄绝奇察母京段依批群项故按河米围江织害斗双境客纪采举杀攻父苏密低朝友诉止细愿千值仍男钱破网热助倒育属坐帝限船脸职速刻乐否刚威毛状率甚独球般普怕弹校苦创假久错承印晚兰试股拿脑预谁益阳若哪微尼继送急血惊伤素药适波夜省初喜卫源食险待述陆习置居劳财环排福纳欢雷警获模充负云停木游龙树疑层冷洲冲射略范竟句室异激汉村哈策演简卡罪判担州静退既衣您宗积余痛检差富灵协角占配征修皮挥胜降阶审沉坚善妈刘读啊超免压银买皇养伊怀执副乱抗犯追帮宣佛岁航优怪香著田铁控税左右份穿艺背阵草脚概恶块顿敢守酒岛托央户烈洋哥索胡款靠评版宝座释景顾弟登货互付伯慢欧换闻危忙核暗姐介坏讨丽良序升监临亮露永呼味野架域沙掉括舰鱼杂误湾吉减编楚肯测败屋跑梦散温困剑渐封救贵枪缺楼县尚毫移娘朋画班智亦耳恩短掌恐遗固席松秘谢鲁遇康虑幸均销钟诗藏赶剧票损忽巨炮旧端探湖录叶春乡附吸予礼港雨呀板庭妇归睛饭额含顺输摇招婚脱补谓督毒油疗旅泽材灭逐莫笔亡鲜词圣择寻厂睡博勒烟授诺伦岸奥唐卖俄炸载洛健堂旁宫喝借君禁阴园谋宋避抓荣姑孙逃牙束跳顶玉镇雪午练迫爷篇肉嘴馆遍凡础洞卷坦牛宁纸诸训私庄祖丝翻暴森塔默握戏隐熟骨访弱蒙歌店鬼软典欲萨伙遭盘爸扩盖弄雄稳忘亿刺拥徒姆杨齐赛趣曲刀床迎冰虚玩析窗醒妻透购替塞努休虎扬途侵刑绿兄迅套贸毕唯谷轮库迹尤竞街促延震弃甲伟麻川申缓潜闪售灯针哲络抵朱埃抱鼓植纯夏忍页杰筑折郑贝尊吴秀混臣雅振染盛怒舞圆搞狂措姓残秋培迷诚宽宇猛摆梅毁伸摩盟末乃悲拍丁赵侧唱嘛幕" +
+		"這個們來為國過發後裡種經麼學現當動們對時說會樣還進從實軍與長機開關點業將兩間問應戰頭體產話內給門東聲員別變總電數報結務場計許統區隊決書聽卻達難權設記類據邊張該規萬覺術領確傳師觀讓識帶導爭運飛聯組濟車親極辦議轉準遠單羅愛擊備連調質團價黨華級離況亞請際約復線斷滿視須研寫稱嗎輕顯圖歷醫專費號盡較語僅隨響雖勢參眾構節維劃敵陳態護興驗責營夠嚴終緊絕圍織鬥雙紀採舉殺蘇訴細願錢網熱屬臉職樂剛狀獨彈創錯蘭誰陽繼驚傷藥適衛險陸習勞財環納歡獲雲龍樹層衝範異漢簡擔靜積餘檢靈協徵揮勝階審堅媽劉讀壓銀買養懷執亂幫歲優鐵稅藝陣腳惡塊頓島戶評寶釋顧貨歐換聞壞討麗監臨艦魚雜誤灣減測敗夢溫劍漸貴槍樓縣畫遺謝慮銷鐘詩趕劇損舊錄葉鄉禮婦歸飯額順輸搖脫補謂療澤滅筆鮮詞聖擇尋廠諾倫賣載陰謀榮孫頂鎮練爺館礎寧紙諸訓莊絲戲隱訪軟薩夥盤擴蓋穩億擁楊齊賽虛購揚綠貿畢輪庫跡競棄偉緩潛閃燈絡純頁傑築鄭貝吳圓殘誠寬擺毀趙側" +
+		"本日円会社気私駅様込売帰読書話語続変届営検験際図県働辺広枚歳両単関係払経済薬鉄")
+
+// Frequently used Hangul syllables
+var commonHangul = runeSet("이다는의에가을하고지기서로한들사리자어나도를은시수정있것대인일니아게습으부요제해라만주보우내그상전동성면적과여중러거생원연마소화문경장계신실방국미관학구공회발없운세저와물개선조치모두무비되오분할했같많더또말입금까음터때감용결식통안드법진체업명합련후함교반간람심현산행각님께드립니다감사합니다안녕하세요확인부탁드리메일첨부파일참고바랍니다")
@@ -0,0 +1,174 @@
+package enmime
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cention-sany/net/mail"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+)
+
+const (
+	sampleRussian = "Здравствуйте, Ирина! Спасибо за ваше письмо. Мы получили заказ и " +
+		"отправим его завтра утром. Если у вас есть вопросы, пожалуйста, напишите нам."
+	sampleFrench = "Bonjour Hélène, merci pour votre réponse rapide. Nous avons reçu la " +
+		"commande et elle sera expédiée demain matin à l'adresse indiquée."
+	sampleGerman = "Sehr geehrte Damen und Herren, vielen Dank für Ihre Nachricht. Die " +
+		"Lieferung erfolgt voraussichtlich übermorgen. Mit freundlichen Grüßen"
+	samplePolish = "Dzień dobry, dziękujemy za wiadomość. Zamówienie zostało wysłane " +
+		"i powinno dotrzeć w ciągu dwóch dni roboczych. Pozdrawiamy serdecznie, Łukasz"
+	sampleJapanese = "お問い合わせいただきありがとうございます。ご注文の商品は明日発送いたします。" +
+		"何かご不明な点がございましたら、お気軽にご連絡ください。"
+	sampleChinese = "您好，感谢您的来信。我们已经收到您的订单，将在明天发货。" +
+		"如果您有任何问题，请随时与我们联系。"
+	sampleTraditional = "您好，感謝您的來信。我們已經收到您的訂單，將在明天發貨。" +
+		"如果您有任何問題，請隨時與我們聯繫。"
+	sampleKorean = "안녕하세요. 문의해 주셔서 감사합니다. 주문하신 상품은 내일 발송될 " +
+		"예정입니다. 궁금하신 점이 있으시면 언제든지 연락 주시기 바랍니다."
+)
+
+func encodeSample(t *testing.T, e encoding.Encoding, s string) []byte {
+	b, err := e.NewEncoder().Bytes([]byte(s))
+	if err != nil {
+		t.Fatalf("Failed to encode sample: %v", err)
+	}
+	return b
+}
+
+func TestDetectCharset(t *testing.T) {
+	var testTable = []struct {
+		sample string
+		e      encoding.Encoding
+		expect string
+	}{
+		{sampleRussian, charmap.KOI8R, "koi8-r"},
+		{sampleRussian, charmap.Windows1251, "windows-1251"},
+		{sampleRussian, charmap.CodePage866, "ibm866"},
+		{sampleRussian, charmap.ISO8859_5, "iso-8859-5"},
+		{sampleFrench, charmap.Windows1252, "windows-1252"},
+		{sampleGerman, charmap.Windows1252, "windows-1252"},
+		{samplePolish, charmap.Windows1250, "windows-1250"},
+		{sampleJapanese, japanese.ShiftJIS, "shift_jis"},
+		{sampleJapanese, japanese.EUCJP, "euc-jp"},
+		{sampleJapanese, japanese.ISO2022JP, "iso-2022-jp"},
+		{sampleChinese, simplifiedchinese.GBK, "gb18030"},
+		{sampleTraditional, traditionalchinese.Big5, "big5"},
+		{sampleKorean, korean.EUCKR, "euc-kr"},
+		{sampleRussian, encoding.Nop, "utf-8"},
+		{"Plain old ASCII", encoding.Nop, "us-ascii"},
+	}
+
+	for _, tt := range testTable {
+		data := encodeSample(t, tt.e, tt.sample)
+		guesses := DetectCharset(data)
+		if assert.NotEmpty(t, guesses, "Expected guesses for %v", tt.expect) {
+			assert.Equal(t, tt.expect, guesses[0].Charset, "Guesses: %v", guesses)
+			assert.True(t, guesses[0].Confidence >= minDetectConfidence,
+				"Confidence for %v too low: %v", tt.expect, guesses[0].Confidence)
+			result, err := ConvertToUTF8String(guesses[0].Charset, data)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.sample, result)
+		}
+	}
+	assert.Empty(t, DetectCharset(nil))
+}
+
+func TestDetectCharsetShortText(t *testing.T) {
+	data := encodeSample(t, charmap.KOI8R, "Привет")
+	assert.Equal(t, "koi8-r", detectCharset(data))
+	data = encodeSample(t, japanese.ShiftJIS, "お知らせ")
+	assert.Equal(t, "shift_jis", detectCharset(data))
+}
+
+func TestDecodeToUTF8(t *testing.T) {
+	// Missing charset
+	data := encodeSample(t, charmap.Windows1251, sampleRussian)
+	result, cs, err := decodeToUTF8("", data)
+	assert.Nil(t, err)
+	assert.Equal(t, "windows-1251", cs)
+	assert.Equal(t, sampleRussian, result)
+
+	// Unsupported charset
+	result, cs, err = decodeToUTF8("x-unknown-charset", data)
+	assert.Nil(t, err)
+	assert.Equal(t, "windows-1251", cs)
+	assert.Equal(t, sampleRussian, result)
+
+	// Declared charset producing invalid output
+	data = encodeSample(t, japanese.ShiftJIS, sampleJapanese)
+	result, cs, err = decodeToUTF8("euc-jp", data)
+	assert.Nil(t, err)
+	assert.Equal(t, "shift_jis", cs)
+	assert.Equal(t, sampleJapanese, result)
+
+	// Declared charset is trusted when it decodes cleanly
+	data = encodeSample(t, charmap.Windows1252, sampleFrench)
+	result, cs, err = decodeToUTF8("iso-8859-15", data)
+	assert.Nil(t, err)
+	assert.Equal(t, "iso-8859-15", cs)
+	assert.Equal(t, sampleFrench, result)
+
+	// Declared UTF-8 is trusted when valid
+	result, cs, err = decodeToUTF8("utf-8", []byte(sampleFrench))
+	assert.Nil(t, err)
+	assert.Equal(t, "utf-8", cs)
+	assert.Equal(t, sampleFrench, result)
+
+	// Declared UTF-8 holding windows-1252 text
+	data = encodeSample(t, charmap.Windows1252, sampleFrench)
+	result, cs, err = decodeToUTF8("UTF-8", data)
+	assert.Nil(t, err)
+	assert.Equal(t, "windows-1252", cs)
+	assert.Equal(t, sampleFrench, result)
+
+	// Damaged UTF-8 is kept
+	result, cs, err = decodeToUTF8("utf-8", []byte("Hélène \xff"))
+	assert.Nil(t, err)
+	assert.Equal(t, "utf-8", cs)
+	assert.Equal(t, "Hélène \xff", result)
+}
+
+func TestParseUnlabeledText(t *testing.T) {
+	raw := "From: a@example.com\r\nSubject: " + string(encodeSample(t, charmap.KOI8R, "Заказ")) +
+		"\r\nContent-Type: text/plain\r\n\r\n" + string(encodeSample(t, charmap.KOI8R, sampleRussian))
+	msg, err := mail.ReadMessage(strings.NewReader(raw))
+	if err != nil {
+		t.Fatalf("Failed to read message: %v", err)
+	}
+	mime, err := ParseMIMEBody(msg)
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+
+	assert.Equal(t, sampleRussian, mime.Text)
+	assert.Equal(t, "koi8-r", mime.TextCharset)
+	assert.Equal(t, "Заказ", mime.GetHeader("Subject"))
+}
+
+func TestParseUnlabeledMultipart(t *testing.T) {
+	raw := "From: a@example.com\r\nContent-Type: multipart/alternative; boundary=XX\r\n\r\n" +
+		"--XX\r\nContent-Type: text/plain\r\n\r\n" +
+		string(encodeSample(t, japanese.ShiftJIS, sampleJapanese)) + "\r\n" +
+		"--XX\r\nContent-Type: text/html; charset=gb2312\r\n\r\n" +
+		string(encodeSample(t, traditionalchinese.Big5, sampleTraditional)) + "\r\n" +
+		"--XX--\r\n"
+	msg, err := mail.ReadMessage(strings.NewReader(raw))
+	if err != nil {
+		t.Fatalf("Failed to read message: %v", err)
+	}
+	mime, err := ParseMIMEBody(msg)
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+
+	assert.Equal(t, sampleJapanese, mime.Text)
+	assert.Equal(t, "shift_jis", mime.TextCharset)
+	assert.Equal(t, sampleTraditional, mime.HTML)
+	assert.Equal(t, "big5", mime.HTMLCharset)
+}
@@ -0,0 +1,524 @@
+package enmime
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DKIMKeyResolver returns the TXT records published at name, which is
+// selector._domainkey.domain.  net.LookupTXT is a DKIMKeyResolver; tests and
+// offline checks can answer from a map instead.
+type DKIMKeyResolver func(name string) ([]string, error)
+
+// DKIMStatus is the outcome of a DKIM signature check, named as in RFC 8601.
+type DKIMStatus string
+
+// Outcomes of VerifyDKIM
+const (
+	DKIMPass      DKIMStatus = "pass"      // Signature verified
+	DKIMFail      DKIMStatus = "fail"      // Signature or body hash did not verify
+	DKIMNeutral   DKIMStatus = "neutral"   // Signature could not be interpreted
+	DKIMTempError DKIMStatus = "temperror" // Key lookup failed, may work later
+	DKIMPermError DKIMStatus = "permerror" // Missing or unusable key or algorithm
+)
+
+// DKIMResult is the result of checking one DKIM-Signature header.
+type DKIMResult struct {
+	Status    DKIMStatus
+	Domain    string   // d= tag
+	Selector  string   // s= tag
+	Identity  string   // i= tag, "@" + Domain if missing
+	Algorithm string   // a= tag
+	Headers   []string // h= tag
+	Err       error    // Reason for any status but pass
+}
+
+// errNoRawMessage is returned by the checks that need the original message.
+var errNoRawMessage = errors.New("Original message not kept, parse it with ReadMIMEBody")
+
+// VerifyDKIM checks the DKIM-Signature headers of the message, see VerifyDKIM.
+func (m *MIMEBody) VerifyDKIM(resolve DKIMKeyResolver) ([]DKIMResult, error) {
+	if m.raw == nil {
+		return nil, errNoRawMessage
+	}
+	return VerifyDKIM(m.raw, resolve)
+}
+
+// VerifyDKIM checks every DKIM-Signature header of the raw message per RFC
+// 6376, with the rsa-sha256 and ed25519-sha256 algorithms of RFC 8463.  Keys
+// are fetched with resolve.  There is one result per signature, in header
+// order; an error is only returned if the message has no header section.
+func VerifyDKIM(raw []byte, resolve DKIMKeyResolver) ([]DKIMResult, error) {
+	headers, body, err := splitRawMessage(raw)
+	if err != nil {
+		return nil, err
+	}
+	var results []DKIMResult
+	for _, h := range headers {
+		if !strings.EqualFold(h.name, "DKIM-Signature") {
+			continue
+		}
+		results = append(results, verifyDKIMSignature(h, headers, body, resolve))
+	}
+	return results, nil
+}
+
+// rawHeader is a header field as found in the message, with its folding
+// and the trailing CRLF.
+type rawHeader struct {
+	name  string
+	field string
+}
+
+// splitRawMessage splits a message into header fields and body, converting
+// bare LF line endings to CRLF as they would be on the wire.
+func splitRawMessage(raw []byte) ([]rawHeader, []byte, error) {
+	if bytes.IndexByte(raw, '\n') >= 0 && !bytes.Contains(raw, []byte("\r\n")) {
+		raw = bytes.Replace(raw, []byte("\n"), []byte("\r\n"), -1)
+	}
+	var headers []rawHeader
+	rest := raw
+	for {
+		if len(rest) == 0 {
+			return headers, nil, nil
+		}
+		if bytes.HasPrefix(rest, []byte("\r\n")) {
+			return headers, rest[2:], nil
+		}
+		// A field ends at a CRLF not followed by white space
+		end := 0
+		for {
+			i := bytes.Index(rest[end:], []byte("\r\n"))
+			if i < 0 {
+				end = len(rest)
+				break
+			}
+			end += i + 2
+			if end >= len(rest) || (rest[end] != ' ' && rest[end] != '\t') {
+				break
+			}
+		}
+		field := string(rest[:end])
+		colon := strings.IndexByte(field, ':')
+		if colon <= 0 {
+			if len(headers) == 0 {
+				return nil, nil, errors.New("Message has no header section")
+			}
+			// Not a header field, RFC 5322 says the body starts here
+			return headers, rest, nil
+		}
+		headers = append(headers, rawHeader{
+			name:  strings.TrimRight(field[:colon], " \t"),
+			field: field,
+		})
+		rest = rest[end:]
+	}
+}
+
+func verifyDKIMSignature(sig rawHeader, headers []rawHeader, body []byte,
+	resolve DKIMKeyResolver) DKIMResult {
+	tags := ParseTagList(sig.field[strings.IndexByte(sig.field, ':')+1:])
+	r := DKIMResult{
+		Domain:    tags["d"],
+		Selector:  tags["s"],
+		Identity:  tags["i"],
+		Algorithm: strings.ToLower(tags["a"]),
+	}
+	if r.Identity == "" {
+		r.Identity = "@" + r.Domain
+	}
+	for _, h := range strings.Split(tags["h"], ":") {
+		if h = strings.TrimSpace(h); h != "" {
+			r.Headers = append(r.Headers, h)
+		}
+	}
+	fail := func(status DKIMStatus, format string, args ...interface{}) DKIMResult {
+		r.Status, r.Err = status, fmt.Errorf(format, args...)
+		return r
+	}
+
+	// Required tags
+	if tags["v"] != "1" {
+		return fail(DKIMNeutral, "Unsupported DKIM version %q", tags["v"])
+	}
+	for _, name := range []string{"a", "b", "bh", "d", "h", "s"} {
+		if tags[name] == "" {
+			return fail(DKIMNeutral, "DKIM signature misses the %s= tag", name)
+		}
+	}
+	if r.Algorithm != "rsa-sha256" && r.Algorithm != "ed25519-sha256" {
+		return fail(DKIMPermError, "Unsupported DKIM algorithm %q", r.Algorithm)
+	}
+	if !containsFold(r.Headers, "From") {
+		return fail(DKIMNeutral, "DKIM signature does not cover From")
+	}
+	if at := strings.LastIndexByte(r.Identity, '@'); at < 0 || !isSubdomain(r.Identity[at+1:], r.Domain) {
+		return fail(DKIMNeutral, "DKIM identity %q is not in domain %q", r.Identity, r.Domain)
+	}
+	headerCanon, bodyCanon, err := parseDKIMCanonicalization(tags["c"])
+	if err != nil {
+		return fail(DKIMNeutral, "%v", err)
+	}
+	if x := tags["x"]; x != "" {
+		expiry, err := strconv.ParseInt(x, 10, 64)
+		if err != nil {
+			return fail(DKIMNeutral, "Invalid DKIM expiration %q", x)
+		}
+		if time.Now().Unix() > expiry {
+			return fail(DKIMFail, "DKIM signature expired")
+		}
+	}
+
+	// Body hash
+	cbody := canonicalizeDKIMBody(body, bodyCanon)
+	if l := tags["l"]; l != "" {
+		n, err := strconv.ParseInt(l, 10, 64)
+		if err != nil || n < 0 {
+			return fail(DKIMNeutral, "Invalid DKIM body length %q", l)
+		}
+		if n > int64(len(cbody)) {
+			return fail(DKIMFail, "DKIM body length %d exceeds the body", n)
+		}
+		cbody = cbody[:n]
+	}
+	bh := sha256.Sum256(cbody)
+	if wanted, err := base64.StdEncoding.DecodeString(tags["bh"]); err != nil || !bytes.Equal(wanted, bh[:]) {
+		return fail(DKIMFail, "DKIM body hash did not verify")
+	}
+
+	// Key
+	key, err := lookupDKIMKey(r.Selector, r.Domain, r.Algorithm, resolve)
+	if err != nil {
+		if _, ok := err.(dkimTempError); ok {
+			return fail(DKIMTempError, "%v", err)
+		}
+		return fail(DKIMPermError, "%v", err)
+	}
+
+	// Header hash
+	signature, err := base64.StdEncoding.DecodeString(tags["b"])
+	if err != nil {
+		return fail(DKIMNeutral, "Invalid DKIM signature encoding")
+	}
+	hash := dkimHeaderHash(headers, r.Headers, sig, headerCanon)
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		err = rsa.VerifyPKCS1v15(k, crypto.SHA256, hash, signature)
+	case ed25519.PublicKey:
+		if !ed25519.Verify(k, hash, signature) {
+			err = errors.New("ed25519: verification error")
+		}
+	}
+	if err != nil {
+		return fail(DKIMFail, "DKIM signature did not verify: %v", err)
+	}
+	r.Status = DKIMPass
+	return r
+}
+
+// dkimHeaderHash hashes the signed header fields and the signature field
+// itself, with an empty b= tag.
+func dkimHeaderHash(headers []rawHeader, signed []string, sig rawHeader, canon string) []byte {
+	h := sha256.New()
+	used := make(map[int]bool)
+	for _, name := range signed {
+		// Instances of a header are signed from the bottom up
+		for i := len(headers) - 1; i >= 0; i-- {
+			if !used[i] && strings.EqualFold(headers[i].name, name) {
+				used[i] = true
+				h.Write([]byte(canonicalizeDKIMHeader(headers[i].field, canon)))
+				break
+			}
+		}
+	}
+	field := dkimSignatureValueRegexp.ReplaceAllString(sig.field, "$1")
+	h.Write([]byte(strings.TrimSuffix(canonicalizeDKIMHeader(field, canon), "\r\n")))
+	return h.Sum(nil)
+}
+
+var dkimSignatureValueRegexp = regexp.MustCompile(`((?:^|[:;])[ \t\r\n]*b[ \t\r\n]*=)[^;]*`)
+
+// dkimTempError marks key lookup errors that may go away.
+type dkimTempError struct{ error }
+
+// lookupDKIMKey fetches and parses the public key of a selector.
+func lookupDKIMKey(selector, domain, algorithm string, resolve DKIMKeyResolver) (crypto.PublicKey, error) {
+	if resolve == nil {
+		return nil, dkimTempError{errors.New("No DKIM key resolver")}
+	}
+	txts, err := resolve(selector + "._domainkey." + domain)
+	if err != nil {
+		return nil, dkimTempError{fmt.Errorf("DKIM key lookup failed: %v", err)}
+	}
+	if len(txts) == 0 {
+		return nil, fmt.Errorf("No DKIM key for %s._domainkey.%s", selector, domain)
+	}
+	tags := ParseTagList(strings.Join(txts, ""))
+	if v, ok := tags["v"]; ok && v != "DKIM1" {
+		return nil, fmt.Errorf("Unsupported DKIM key version %q", v)
+	}
+	keyType := strings.ToLower(tags["k"])
+	if keyType == "" {
+		keyType = "rsa"
+	}
+	if !strings.HasPrefix(algorithm, keyType+"-") {
+		return nil, fmt.Errorf("DKIM key type %q does not match algorithm %q", keyType, algorithm)
+	}
+	if hashes, ok := tags["h"]; ok && !containsFold(strings.Split(hashes, ":"), "sha256") {
+		return nil, fmt.Errorf("DKIM key does not allow sha256")
+	}
+	if tags["p"] == "" {
+		return nil, errors.New("DKIM key revoked")
+	}
+	der, err := base64.StdEncoding.DecodeString(tags["p"])
+	if err != nil {
+		return nil, fmt.Errorf("Invalid DKIM key encoding: %v", err)
+	}
+	if keyType == "ed25519" {
+		if len(der) != ed25519.PublicKeySize {
+			return nil, errors.New("Invalid ed25519 DKIM key size")
+		}
+		return ed25519.PublicKey(der), nil
+	}
+	pub, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		// Some publish a bare PKCS #1 key
+		if rsaPub, err1 := x509.ParsePKCS1PublicKey(der); err1 == nil {
+			return rsaPub, nil
+		}
+		return nil, fmt.Errorf("Invalid DKIM key: %v", err)
+	}
+	rsaPub, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("DKIM key is not an RSA key")
+	}
+	return rsaPub, nil
+}
+
+func parseDKIMCanonicalization(c string) (header, body string, err error) {
+	header, body = "simple", "simple"
+	if c != "" {
+		parts := strings.SplitN(strings.ToLower(c), "/", 2)
+		header = parts[0]
+		if len(parts) == 2 {
+			body = parts[1]
+		}
+	}
+	for _, v := range []string{header, body} {
+		if v != "simple" && v != "relaxed" {
+			return "", "", fmt.Errorf("Unsupported DKIM canonicalization %q", c)
+		}
+	}
+	return header, body, nil
+}
+
+// canonicalizeDKIMHeader canonicalizes a header field with its trailing CRLF.
+func canonicalizeDKIMHeader(field, canon string) string {
+	if canon == "simple" {
+		if !strings.HasSuffix(field, "\r\n") {
+			field += "\r\n"
+		}
+		return field
+	}
+	colon := strings.IndexByte(field, ':')
+	name := strings.ToLower(strings.TrimRight(field[:colon], " \t"))
+	value := strings.Replace(field[colon+1:], "\r\n", "", -1)
+	value = strings.Join(strings.FieldsFunc(value, func(r rune) bool {
+		return r == ' ' || r == '\t'
+	}), " ")
+	return name + ":" + value + "\r\n"
+}
+
+// canonicalizeDKIMBody canonicalizes a body with CRLF line endings.
+func canonicalizeDKIMBody(body []byte, canon string) []byte {
+	var b bytes.Buffer
+	lines := bytes.Split(body, []byte("\r\n"))
+	if len(lines) > 0 && len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	if canon == "relaxed" {
+		for i, line := range lines {
+			line = bytes.TrimRight(line, " \t")
+			lines[i] = bytes.Join(bytes.FieldsFunc(line, func(r rune) bool {
+				return r == ' ' || r == '\t'
+			}), []byte(" "))
+			if len(line) > 0 && (line[0] == ' ' || line[0] == '\t') {
+				lines[i] = append([]byte(" "), lines[i]...)
+			}
+		}
+	}
+	// Trailing empty lines are ignored
+	for len(lines) > 0 && len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	for _, line := range lines {
+		b.Write(line)
+		b.WriteString("\r\n")
+	}
+	if b.Len() == 0 && canon == "simple" {
+		b.WriteString("\r\n")
+	}
+	return b.Bytes()
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(strings.TrimSpace(v), s) {
+			return true
+		}
+	}
+	return false
+}
+
+// isSubdomain reports whether domain equals parent or is below it.
+func isSubdomain(domain, parent string) bool {
+	domain, parent = strings.ToLower(domain), strings.ToLower(parent)
+	return domain == parent || strings.HasSuffix(domain, "."+parent)
+}
+
+// DKIMSignOptions configures SignDKIM.
+type DKIMSignOptions struct {
+	Domain   string        // d= tag
+	Selector string        // s= tag
+	Signer   crypto.Signer // An RSA or ed25519 private key
+	// Headers to sign.  DefaultDKIMHeaders present in the message are used
+	// if empty.  From is always required.
+	Headers []string
+	// Canonicalization as "header/body", "relaxed/relaxed" if empty
+	Canonicalization string
+	Identity         string        // i= tag, omitted if empty
+	Expiration       time.Duration // x= tag relative to the signing time, omitted if 0
+	BodyLength       bool          // Add an l= tag, so content appended later is ignored
+}
+
+// DefaultDKIMHeaders are the headers SignDKIM signs when present, unless told
+// otherwise.
+var DefaultDKIMHeaders = []string{"From", "Reply-To", "Subject", "Date", "To", "Cc",
+	"Message-ID", "In-Reply-To", "References", "MIME-Version", "Content-Type",
+	"Content-Transfer-Encoding", "List-Id", "List-Unsubscribe", "List-Unsubscribe-Post"}
+
+// SignDKIM signs the raw message per RFC 6376 and returns it with the
+// DKIM-Signature header prepended.  The algorithm, rsa-sha256 or
+// ed25519-sha256, follows from the type of the key.
+func SignDKIM(raw []byte, opts *DKIMSignOptions) ([]byte, error) {
+	if opts == nil || opts.Signer == nil || opts.Domain == "" || opts.Selector == "" {
+		return nil, errors.New("DKIM signing needs a key, a domain and a selector")
+	}
+	var algorithm string
+	var hashOpts crypto.SignerOpts
+	switch opts.Signer.Public().(type) {
+	case *rsa.PublicKey:
+		algorithm, hashOpts = "rsa-sha256", crypto.SHA256
+	case ed25519.PublicKey:
+		algorithm, hashOpts = "ed25519-sha256", crypto.Hash(0)
+	default:
+		return nil, fmt.Errorf("Unsupported DKIM key type %T", opts.Signer.Public())
+	}
+	canon := opts.Canonicalization
+	if canon == "" {
+		canon = "relaxed/relaxed"
+	}
+	headerCanon, bodyCanon, err := parseDKIMCanonicalization(canon)
+	if err != nil {
+		return nil, err
+	}
+	canon = headerCanon + "/" + bodyCanon
+
+	headers, body, err := splitRawMessage(raw)
+	if err != nil {
+		return nil, err
+	}
+	signed := opts.Headers
+	if len(signed) == 0 {
+		for _, name := range DefaultDKIMHeaders {
+			for _, h := range headers {
+				if strings.EqualFold(h.name, name) {
+					signed = append(signed, name)
+					break
+				}
+			}
+		}
+	}
+	if !containsFold(signed, "From") {
+		return nil, errors.New("DKIM signature must cover From")
+	}
+
+	cbody := canonicalizeDKIMBody(body, bodyCanon)
+	bh := sha256.Sum256(cbody)
+	now := time.Now().Unix()
+	tags := []string{"v=1", "a=" + algorithm, "c=" + canon, "d=" + opts.Domain,
+		"s=" + opts.Selector, "t=" + strconv.FormatInt(now, 10)}
+	if opts.Expiration > 0 {
+		tags = append(tags, "x="+strconv.FormatInt(now+int64(opts.Expiration/time.Second), 10))
+	}
+	if opts.BodyLength {
+		tags = append(tags, "l="+strconv.Itoa(len(cbody)))
+	}
+	if opts.Identity != "" {
+		tags = append(tags, "i="+opts.Identity)
+	}
+	lower := make([]string, len(signed))
+	for i, name := range signed {
+		lower[i] = strings.ToLower(name)
+	}
+	tags = append(tags, "h="+strings.Join(lower, ":"),
+		"bh="+base64.StdEncoding.EncodeToString(bh[:]), "b=")
+
+	// Fold between tags
+	field := "DKIM-Signature:"
+	col := len(field)
+	for i, tag := range tags {
+		if i < len(tags)-1 {
+			tag += ";"
+		}
+		if col+1+len(tag) > maxHeaderLineLen {
+			field += "\r\n\t"
+			col = 1
+		} else {
+			field += " "
+			col++
+		}
+		field += tag
+		col += len(tag)
+	}
+
+	hash := dkimHeaderHash(headers, signed, rawHeader{"DKIM-Signature", field + "\r\n"}, headerCanon)
+	sig, err := opts.Signer.Sign(rand.Reader, hash, hashOpts)
+	if err != nil {
+		return nil, fmt.Errorf("DKIM signing failed: %v", err)
+	}
+	b := base64.StdEncoding.EncodeToString(sig)
+	for len(b) > 0 {
+		n := maxHeaderLineLen - col
+		if n <= 0 {
+			field += "\r\n\t"
+			col = 1
+			continue
+		}
+		if n > len(b) {
+			n = len(b)
+		}
+		field += b[:n]
+		col += n
+		b = b[n:]
+	}
+
+	field += "\r\n"
+	if !bytes.Contains(raw, []byte("\r\n")) {
+		// Keep the line endings of the message
+		field = strings.Replace(field, "\r\n", "\n", -1)
+	}
+	return append([]byte(field), raw...), nil
+}
@@ -0,0 +1,304 @@
+package enmime
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const dkimTestMessage = "From: Joe SixPack <joe@football.example.com>\r\n" +
+	"To: Suzie Q <suzie@shopping.example.net>\r\n" +
+	"Subject: Is dinner ready?\r\n" +
+	"Date: Fri, 11 Jul 2003 21:00:37 -0700 (PDT)\r\n" +
+	"Message-ID: <20030712040037.46341.5F8J@football.example.com>\r\n" +
+	"\r\n" +
+	"Hi.\r\n" +
+	"\r\n" +
+	"We lost the game.  Are you hungry yet?\r\n" +
+	"\r\n" +
+	"Joe.\r\n" +
+	"\r\n" +
+	"\r\n"
+
+// testSignDKIM signs raw for the football.example.com test domain.
+func testSignDKIM(t *testing.T, raw string, opts DKIMSignOptions) string {
+	opts.Domain = "football.example.com"
+	if opts.Headers == nil {
+		opts.Headers = []string{"From", "To", "Subject", "Date", "Message-ID"}
+	}
+	signed, err := SignDKIM([]byte(raw), &opts)
+	if err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+	return string(signed)
+}
+
+type dkimTestKeys struct {
+	rsa     *rsa.PrivateKey
+	ed25519 ed25519.PrivateKey
+	records map[string][]string
+}
+
+func newDKIMTestKeys(t *testing.T) *dkimTestKeys {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	der, _ := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	return &dkimTestKeys{
+		rsa:     rsaKey,
+		ed25519: edKey,
+		records: map[string][]string{
+			"brisbane._domainkey.football.example.com": {"v=DKIM1; k=rsa; ",
+				"p=" + base64.StdEncoding.EncodeToString(der)},
+			"newengland._domainkey.football.example.com": {"v=DKIM1; k=ed25519; p=" +
+				base64.StdEncoding.EncodeToString(edPub)},
+		},
+	}
+}
+
+func (k *dkimTestKeys) resolve(name string) ([]string, error) {
+	if name == "broken._domainkey.football.example.com" {
+		return nil, errors.New("SERVFAIL")
+	}
+	return k.records[name], nil
+}
+
+func TestVerifyDKIM(t *testing.T) {
+	keys := newDKIMTestKeys(t)
+	signed := testSignDKIM(t, dkimTestMessage, DKIMSignOptions{Selector: "brisbane", Signer: keys.rsa})
+
+	results, err := VerifyDKIM([]byte(signed), keys.resolve)
+	assert.Nil(t, err)
+	if assert.Equal(t, 1, len(results)) {
+		assert.Equal(t, DKIMPass, results[0].Status, "Error: %v", results[0].Err)
+		assert.Equal(t, "football.example.com", results[0].Domain)
+		assert.Equal(t, "brisbane", results[0].Selector)
+		assert.Equal(t, "@football.example.com", results[0].Identity)
+		assert.Equal(t, []string{"from", "to", "subject", "date", "message-id"}, results[0].Headers)
+	}
+
+	// Relaxed canonicalization survives refolding and trailing blank lines
+	mangled := strings.Replace(signed, "Subject: Is dinner ready?", "Subject:  Is dinner\r\n\tready? ", 1)
+	mangled = strings.Replace(mangled, "We lost the game.  Are", "We lost the game. Are ", 1) + "\r\n\r\n"
+	results, _ = VerifyDKIM([]byte(mangled), keys.resolve)
+	assert.Equal(t, DKIMPass, results[0].Status, "Error: %v", results[0].Err)
+
+	// Bare LF line endings
+	results, _ = VerifyDKIM([]byte(strings.Replace(signed, "\r\n", "\n", -1)), keys.resolve)
+	assert.Equal(t, DKIMPass, results[0].Status, "Error: %v", results[0].Err)
+
+	// Tampering
+	results, _ = VerifyDKIM([]byte(strings.Replace(signed, "lost", "won", 1)), keys.resolve)
+	assert.Equal(t, DKIMFail, results[0].Status)
+	results, _ = VerifyDKIM([]byte(strings.Replace(signed, "dinner", "lunch", 1)), keys.resolve)
+	assert.Equal(t, DKIMFail, results[0].Status)
+	results, _ = VerifyDKIM([]byte(strings.Replace(signed, "\r\n\r\n",
+		"\r\nSubject: Added\r\n\r\n", 1)), keys.resolve)
+	assert.Equal(t, DKIMFail, results[0].Status, "Added instance of a signed header")
+}
+
+// The signed message of RFC 8463 Appendix A, with its keys
+const (
+	rfc8463Message = "DKIM-Signature: v=1; a=ed25519-sha256; c=relaxed/relaxed;\r\n" +
+		" d=football.example.com; i=@football.example.com;\r\n" +
+		" q=dns/txt; s=brisbane; t=1528637909; h=from : to :\r\n" +
+		" subject : date : message-id : from : subject : date;\r\n" +
+		" bh=2jUSOH9NhtVGCQWNr9BrIAPreKQjO6Sn7XIkfJVOzv8=;\r\n" +
+		" b=/gCrinpcQOoIfuHNQIbq4pgh9kyIK3AQUdt9OdqQehSwhEIug4D11Bus\r\n" +
+		" Fa3bT3FY5OsU7ZbnKELq+eXdp1Q1Dw==\r\n" +
+		"DKIM-Signature: v=1; a=rsa-sha256; c=relaxed/relaxed;\r\n" +
+		" d=football.example.com; i=@football.example.com;\r\n" +
+		" q=dns/txt; s=test; t=1528637909; h=from : to : subject :\r\n" +
+		" date : message-id : from : subject : date;\r\n" +
+		" bh=2jUSOH9NhtVGCQWNr9BrIAPreKQjO6Sn7XIkfJVOzv8=;\r\n" +
+		" b=F45dVWDfMbQDGHJFlXUNB2HKfbCeLRyhDXgFpEL8GwpsRe0IeIixNTe3\r\n" +
+		" DhCVlUrSjV4BwcVcOF6+FF3Zo9Rpo1tFOeS9mPYQTnGdaSGsgeefOsk2Jz\r\n" +
+		" dA+L10TeYt9BgDfQNZtKdN1WO//KgIqXP7OdEFE4LjFYNcUxZQ4FADY+8=\r\n" +
+		dkimTestMessage
+	rfc8463Ed25519Key = "v=DKIM1; k=ed25519; p=11qYAYKxCrfVS/7TyWQHOg7hcvPapiMlrwIaaPcHURo="
+	rfc8463RSAKey     = "v=DKIM1; k=rsa; p=MIGfMA0GCSqGSIb3DQEBAQUAA4GNADCBiQKBgQDkHlOQoBTzWR" +
+		"iGs5V6NpP3idY6Wk08a5qhdR6wy5bdOKb2jLQiY/J16JYi0Qvx/byYzCNb3W91y3FutAC" +
+		"DfzwQ/BC/e/8uBsCR+yz1Lxj+PL6lHvqMKrM3rG4hstT5QjvHO9PzoxZyVYLzBfO2EeC3" +
+		"Ip3G+2kryOTIKT+l/K4w3QIDAQAB"
+)
+
+// Verify signatures made by another implementation
+func TestVerifyDKIMRFC8463(t *testing.T) {
+	resolve := func(name string) ([]string, error) {
+		switch name {
+		case "brisbane._domainkey.football.example.com":
+			return []string{rfc8463Ed25519Key}, nil
+		case "test._domainkey.football.example.com":
+			return []string{rfc8463RSAKey}, nil
+		}
+		return nil, nil
+	}
+
+	results, err := VerifyDKIM([]byte(rfc8463Message), resolve)
+	assert.Nil(t, err)
+	if assert.Equal(t, 2, len(results)) {
+		assert.Equal(t, DKIMPass, results[0].Status, "Error: %v", results[0].Err)
+		assert.Equal(t, "ed25519-sha256", results[0].Algorithm)
+		assert.Equal(t, DKIMPass, results[1].Status, "Error: %v", results[1].Err)
+		assert.Equal(t, "rsa-sha256", results[1].Algorithm)
+	}
+
+	results, _ = VerifyDKIM([]byte(strings.Replace(rfc8463Message, "Is dinner", "Is lunch", 1)), resolve)
+	if assert.Equal(t, 2, len(results)) {
+		assert.Equal(t, DKIMFail, results[0].Status)
+		assert.Equal(t, DKIMFail, results[1].Status)
+	}
+}
+
+func TestVerifyDKIMSimpleEd25519(t *testing.T) {
+	keys := newDKIMTestKeys(t)
+	signed := testSignDKIM(t, dkimTestMessage, DKIMSignOptions{Selector: "newengland",
+		Signer: keys.ed25519, Canonicalization: "simple/simple"})
+
+	results, err := VerifyDKIM([]byte(signed), keys.resolve)
+	assert.Nil(t, err)
+	if assert.Equal(t, 1, len(results)) {
+		assert.Equal(t, DKIMPass, results[0].Status, "Error: %v", results[0].Err)
+	}
+
+	// Simple canonicalization does not allow refolding
+	mangled := strings.Replace(signed, "Subject: Is dinner ready?", "Subject:  Is dinner ready?", 1)
+	results, _ = VerifyDKIM([]byte(mangled), keys.resolve)
+	assert.Equal(t, DKIMFail, results[0].Status)
+}
+
+func TestVerifyDKIMBodyLength(t *testing.T) {
+	keys := newDKIMTestKeys(t)
+	signed := testSignDKIM(t, dkimTestMessage, DKIMSignOptions{Selector: "brisbane",
+		Signer: keys.rsa, Canonicalization: "simple/relaxed", BodyLength: true})
+
+	results, _ := VerifyDKIM([]byte(signed+"Appended by a mailing list\r\n"), keys.resolve)
+	assert.Equal(t, DKIMPass, results[0].Status, "Error: %v", results[0].Err)
+}
+
+func TestVerifyDKIMErrors(t *testing.T) {
+	keys := newDKIMTestKeys(t)
+	signed := testSignDKIM(t, dkimTestMessage, DKIMSignOptions{Selector: "brisbane",
+		Signer: keys.rsa, Canonicalization: "relaxed/simple"})
+
+	var testTable = []struct {
+		from, to string
+		expect   DKIMStatus
+	}{
+		{"s=brisbane", "s=unknown", DKIMPermError},
+		{"s=brisbane", "s=broken", DKIMTempError},
+		{"a=rsa-sha256", "a=rsa-sha1", DKIMPermError},
+		{"v=1", "v=2", DKIMNeutral},
+		{"h=from:", "h=", DKIMNeutral},
+		{"c=relaxed/simple", "c=fancy/simple", DKIMNeutral},
+		{"d=football.example.com;", "d=football.example.com; i=joe@evil.example;", DKIMNeutral},
+		{"d=football.example.com;", "d=football.example.com; x=1057982437;", DKIMFail},
+	}
+
+	for _, tt := range testTable {
+		results, _ := VerifyDKIM([]byte(strings.Replace(signed, tt.from, tt.to, 1)), keys.resolve)
+		if assert.Equal(t, 1, len(results)) {
+			assert.Equal(t, tt.expect, results[0].Status, "Replacing %q: %v", tt.from, results[0].Err)
+			assert.NotNil(t, results[0].Err)
+		}
+	}
+
+	// Revoked key
+	keys.records["brisbane._domainkey.football.example.com"] = []string{"v=DKIM1; p="}
+	results, _ := VerifyDKIM([]byte(signed), keys.resolve)
+	assert.Equal(t, DKIMPermError, results[0].Status)
+
+	results, err := VerifyDKIM([]byte(dkimTestMessage), keys.resolve)
+	assert.Nil(t, err)
+	assert.Empty(t, results)
+}
+
+func TestMIMEBodyVerifyDKIM(t *testing.T) {
+	keys := newDKIMTestKeys(t)
+	signed := testSignDKIM(t, dkimTestMessage, DKIMSignOptions{Selector: "brisbane", Signer: keys.rsa})
+
+	mime, err := ReadMIMEBody(bytes.NewReader([]byte(signed)))
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+	assert.Equal(t, "Is dinner ready?", mime.GetHeader("Subject"))
+	results, err := mime.VerifyDKIM(keys.resolve)
+	assert.Nil(t, err)
+	if assert.Equal(t, 1, len(results)) {
+		assert.Equal(t, DKIMPass, results[0].Status, "Error: %v", results[0].Err)
+	}
+
+	_, err = parseHeaderOnly(t, "Subject: no raw").VerifyDKIM(keys.resolve)
+	assert.NotNil(t, err)
+}
+
+func TestSignDKIM(t *testing.T) {
+	keys := newDKIMTestKeys(t)
+	var testTable = []struct {
+		selector string
+		signer   crypto.Signer
+		canon    string
+		message  string
+	}{
+		{"brisbane", keys.rsa, "", dkimTestMessage},
+		{"brisbane", keys.rsa, "simple/simple", dkimTestMessage},
+		{"newengland", keys.ed25519, "relaxed/simple", dkimTestMessage},
+		{"newengland", keys.ed25519, "simple/relaxed", strings.Replace(dkimTestMessage, "\r\n", "\n", -1)},
+	}
+
+	for _, tt := range testTable {
+		signed, err := SignDKIM([]byte(tt.message), &DKIMSignOptions{
+			Domain:           "football.example.com",
+			Selector:         tt.selector,
+			Signer:           tt.signer,
+			Canonicalization: tt.canon,
+			Identity:         "joe@football.example.com",
+			Expiration:       time.Hour,
+		})
+		if err != nil {
+			t.Fatalf("Failed to sign: %v", err)
+		}
+		assert.True(t, strings.HasSuffix(string(signed), tt.message), "Message must be kept as is")
+		header := string(signed[:len(signed)-len(tt.message)])
+		for _, line := range strings.Split(strings.TrimRight(header, "\r\n"), "\n") {
+			assert.True(t, len(strings.TrimSuffix(line, "\r")) <= 78, "Line too long: %q", line)
+		}
+
+		results, err := VerifyDKIM(signed, keys.resolve)
+		assert.Nil(t, err)
+		if assert.Equal(t, 1, len(results)) {
+			assert.Equal(t, DKIMPass, results[0].Status, "Canonicalization %q: %v", tt.canon, results[0].Err)
+			assert.Equal(t, "joe@football.example.com", results[0].Identity)
+			// Default headers present in the message
+			assert.Equal(t, []string{"from", "subject", "date", "to", "message-id"}, results[0].Headers)
+		}
+	}
+}
+
+func TestSignDKIMErrors(t *testing.T) {
+	keys := newDKIMTestKeys(t)
+	_, err := SignDKIM([]byte(dkimTestMessage), &DKIMSignOptions{Domain: "football.example.com",
+		Selector: "brisbane", Signer: keys.rsa, Headers: []string{"Subject"}})
+	assert.NotNil(t, err, "From must be signed")
+	_, err = SignDKIM([]byte(dkimTestMessage), &DKIMSignOptions{Domain: "football.example.com",
+		Selector: "brisbane"})
+	assert.NotNil(t, err, "Key is required")
+	_, err = SignDKIM([]byte(dkimTestMessage), &DKIMSignOptions{Domain: "football.example.com",
+		Selector: "brisbane", Signer: keys.rsa, Canonicalization: "fancy"})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,198 @@
+package enmime
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	errNotInMessage = errors.New("Part is not in the message")
+	errTopLevelPart = errors.New("Top-level part cannot be removed or replaced")
+)
+
+// RemovePart takes p, and the parts inside it, out of the message.  A nested
+// multipart left with a single part is replaced by that part, and one left
+// empty is removed in turn.  The top-level multipart is kept, whatever is left
+// in it.  Attachments, Inlines and OtherParts are updated, Text and HTML are
+// not.
+func (m *MIMEBody) RemovePart(p MIMEPart) error {
+	mp, err := m.treePart(p)
+	if err != nil {
+		return err
+	}
+	m.removePart(mp)
+	m.sortParts()
+	return nil
+}
+
+// ReplaceContent gives p new content, in the charset of the part for text.
+// The content is encoded by the Content-Transfer-Encoding of the part when the
+// message is written, which changes to quoted-printable for text or base64
+// for other types when the one in place cannot carry it.
+func (m *MIMEBody) ReplaceContent(p MIMEPart, content []byte) error {
+	mp, ok := p.(*memMIMEPart)
+	if !ok || !m.contains(mp) {
+		return errNotInMessage
+	}
+	if mp.firstChild != nil {
+		return fmt.Errorf("Cannot replace the content of %v", mp.contentType)
+	}
+	mp.content = content
+	mp.changed = true
+
+	// The header of the part of a single part message is the header of the
+	// message, see binMIME.
+	fields, setFields := mp.HeaderFields(), mp.SetHeaderFields
+	if mp.parent == nil {
+		fields, setFields = m.HeaderFields(), m.SetHeaderFields
+	}
+	cte := fields.Get("Content-Transfer-Encoding")
+	if enc := transferEncoding(cte, mp.contentType, content); enc != cte {
+		setFields(fields.Set("Content-Transfer-Encoding", enc))
+	}
+	return nil
+}
+
+// ReplaceWithPlaceholder puts a text/plain or text/html part holding text in
+// place of p, for example to tell that an attachment was removed.  The new
+// part is returned.  Attachments, Inlines and OtherParts are updated, Text and
+// HTML are not.
+func (m *MIMEBody) ReplaceWithPlaceholder(p MIMEPart, contentType, text string) (MIMEPart, error) {
+	if contentType != "text/plain" && contentType != "text/html" {
+		return nil, fmt.Errorf("Placeholder cannot be %v", contentType)
+	}
+	mp, err := m.treePart(p)
+	if err != nil {
+		return nil, err
+	}
+	content := []byte(text)
+	placeholder := NewMIMEPart(nil, contentType)
+	placeholder.content = content
+	placeholder.SetHeaderFields(HeaderFields{}.
+		Add("Content-Type", contentType+"; charset=utf-8").
+		Add("Content-Transfer-Encoding", transferEncoding("7bit", contentType, content)))
+	mp.parent.(*memMIMEPart).replaceChild(mp, placeholder)
+	m.sortParts()
+	return placeholder, nil
+}
+
+// treePart returns p if it is a part below the top-level multipart of the
+// message.
+func (m *MIMEBody) treePart(p MIMEPart) (*memMIMEPart, error) {
+	mp, ok := p.(*memMIMEPart)
+	if !ok || !m.contains(mp) {
+		return nil, errNotInMessage
+	}
+	if mp.parent == nil {
+		return nil, errTopLevelPart
+	}
+	return mp, nil
+}
+
+// contains tells whether p is the root, a part below it, or the part of a
+// single part message.
+func (m *MIMEBody) contains(p *memMIMEPart) bool {
+	var top MIMEPart = p
+	for top.Parent() != nil {
+		top = top.Parent()
+	}
+	if top == m.Root {
+		return true
+	}
+	for _, a := range m.Attachments {
+		if a == MIMEPart(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// removePart unlinks p from its parent, collapsing the nested multiparts it
+// leaves with one part or none.
+func (m *MIMEBody) removePart(p *memMIMEPart) {
+	parent := p.parent.(*memMIMEPart)
+	parent.replaceChild(p, nil)
+	if parent == m.Root || parent.parent == nil {
+		return
+	}
+	switch {
+	case parent.firstChild == nil:
+		m.removePart(parent)
+	case parent.firstChild.NextSibling() == nil:
+		parent.parent.(*memMIMEPart).replaceChild(parent, parent.firstChild.(*memMIMEPart))
+	}
+}
+
+// replaceChild puts part in place of the child old of p, or just unlinks old
+// when part is nil.
+func (p *memMIMEPart) replaceChild(old, part *memMIMEPart) {
+	next := old.nextSibling
+	if part != nil {
+		part.parent, part.nextSibling = p, next
+		next = part
+	}
+	if p.firstChild == MIMEPart(old) {
+		p.firstChild = next
+	} else {
+		for c := p.firstChild; c != nil; c = c.NextSibling() {
+			if cp := c.(*memMIMEPart); cp.nextSibling == MIMEPart(old) {
+				cp.nextSibling = next
+				break
+			}
+		}
+	}
+	old.parent, old.nextSibling = nil, nil
+	p.changed = true
+}
+
+// transferEncoding returns cte if it can carry content, or else the encoding
+// to use for a part of type mediatype.
+func transferEncoding(cte, mediatype string, content []byte) string {
+	switch strings.ToLower(strings.TrimSpace(cte)) {
+	case "base64", "quoted-printable", "binary":
+		return cte
+	case "8bit":
+		if !bytes.ContainsRune(content, 0) && !longLines(content) {
+			return cte
+		}
+	default:
+		if is7bit(content) && !longLines(content) {
+			return cte
+		}
+	}
+	if strings.HasPrefix(mediatype, "text/") {
+		return "quoted-printable"
+	}
+	return "base64"
+}
+
+// is7bit tells whether b is 7-bit text without NUL characters.
+func is7bit(b []byte) bool {
+	for _, c := range b {
+		if c == 0 || c >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// longLines tells whether b has lines longer than the 998 characters allowed
+// by RFC 5322.
+func longLines(b []byte) bool {
+	for len(b) > 0 {
+		i := bytes.IndexByte(b, '\n')
+		if i < 0 {
+			i = len(b)
+		}
+		if len(bytes.TrimSuffix(b[:i], []byte("\r"))) > 998 {
+			return true
+		}
+		if i == len(b) {
+			break
+		}
+		b = b[i+1:]
+	}
+	return false
+}
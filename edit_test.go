@@ -0,0 +1,213 @@
+package enmime
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const editTestMessage = "From: alice@example.com\r\n" +
+	"Subject: Parts\r\n" +
+	"Content-Type: multipart/mixed; boundary=mixed\r\n" +
+	"\r\n" +
+	"--mixed\r\n" +
+	"Content-Type: multipart/alternative; boundary=alt\r\n" +
+	"\r\n" +
+	"--alt\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"\r\n" +
+	"Plain\r\n" +
+	"--alt\r\n" +
+	"Content-Type: multipart/related; boundary=rel\r\n" +
+	"\r\n" +
+	"--rel\r\n" +
+	"Content-Type: text/html\r\n" +
+	"\r\n" +
+	"<p>HTML</p>\r\n" +
+	"--rel\r\n" +
+	"Content-Type: image/png\r\n" +
+	"Content-Disposition: inline\r\n" +
+	"Content-ID: <logo>\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"iVBORw==\r\n" +
+	"--rel--\r\n" +
+	"--alt--\r\n" +
+	"--mixed\r\n" +
+	"Content-Type: application/pdf\r\n" +
+	"Content-Disposition: attachment; filename=a.pdf\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"JVBERg==\r\n" +
+	"--mixed\r\n" +
+	"Content-Type: application/zip\r\n" +
+	"Content-Disposition: attachment; filename=b.zip\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"UEsDBA==\r\n" +
+	"--mixed--\r\n"
+
+func readEditTestMessage(t *testing.T) *MIMEBody {
+	m, err := ReadMIMEBody(strings.NewReader(editTestMessage))
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+	return m
+}
+
+func rewriteMessage(t *testing.T, m *MIMEBody) *MIMEBody {
+	b, err := m.Bytes()
+	if err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+	m, err = ReadMIMEBody(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+	return m
+}
+
+// partTypes lists the content types of the tree below p, nested multiparts in
+// parentheses.
+func partTypes(p MIMEPart) string {
+	var types []string
+	for c := p.FirstChild(); c != nil; c = c.NextSibling() {
+		if c.FirstChild() != nil {
+			types = append(types, c.ContentType()+"("+partTypes(c)+")")
+		} else {
+			types = append(types, c.ContentType())
+		}
+	}
+	return strings.Join(types, " ")
+}
+
+func TestRemovePart(t *testing.T) {
+	m := readEditTestMessage(t)
+	if !assert.Len(t, m.Inlines, 1) || !assert.Len(t, m.Attachments, 2) {
+		return
+	}
+
+	// multipart/related is left with the HTML only
+	assert.Nil(t, m.RemovePart(m.Inlines[0]))
+	assert.Len(t, m.Inlines, 0)
+	assert.Equal(t, "multipart/alternative(text/plain text/html) application/pdf application/zip",
+		partTypes(m.Root))
+
+	assert.Nil(t, m.RemovePart(m.Attachments[0]))
+	if assert.Len(t, m.Attachments, 1) {
+		assert.Equal(t, "b.zip", m.Attachments[0].FileName())
+	}
+
+	// multipart/alternative is left with the text only
+	assert.Nil(t, m.RemovePart(m.Root.FirstChild().FirstChild().NextSibling()))
+	assert.Equal(t, "text/plain application/zip", partTypes(m.Root))
+
+	m = rewriteMessage(t, m)
+	assert.Equal(t, "text/plain application/zip", partTypes(m.Root))
+	assert.Equal(t, "Plain", m.Text)
+	assert.Equal(t, "", m.HTML)
+	if assert.Len(t, m.Attachments, 1) {
+		assert.Equal(t, []byte("PK\x03\x04"), m.Attachments[0].Content())
+	}
+
+	// Removing the last parts empties nested multiparts in turn
+	m = readEditTestMessage(t)
+	related := m.Root.FirstChild().FirstChild().NextSibling()
+	assert.Nil(t, m.RemovePart(related.FirstChild()))
+	assert.Nil(t, m.RemovePart(m.Root.FirstChild().FirstChild()))
+	assert.Equal(t, "image/png application/pdf application/zip", partTypes(m.Root))
+	assert.Nil(t, m.RemovePart(m.Root.FirstChild()))
+	assert.Equal(t, "application/pdf application/zip", partTypes(m.Root))
+}
+
+func TestRemovePartErrors(t *testing.T) {
+	m := readEditTestMessage(t)
+	assert.Equal(t, errTopLevelPart, m.RemovePart(m.Root))
+	other := readEditTestMessage(t)
+	assert.Equal(t, errNotInMessage, m.RemovePart(other.Attachments[0]))
+	_, err := m.ReplaceWithPlaceholder(m.Attachments[0], "image/png", "")
+	assert.NotNil(t, err)
+	assert.NotNil(t, m.ReplaceContent(m.Root.FirstChild(), nil), "Multipart content cannot be replaced")
+}
+
+func TestReplaceWithPlaceholder(t *testing.T) {
+	m := readEditTestMessage(t)
+	zip := m.Attachments[1]
+	p, err := m.ReplaceWithPlaceholder(zip, "text/plain", "b.zip was removed – it was unsafe.")
+	if err != nil {
+		t.Fatalf("Failed to replace part: %v", err)
+	}
+	assert.Nil(t, zip.Parent())
+	assert.Equal(t, m.Root, p.Parent())
+	assert.Equal(t, "utf-8", p.Charset())
+	assert.Equal(t, "quoted-printable", p.Header().Get("Content-Transfer-Encoding"))
+	if assert.Len(t, m.Attachments, 1) {
+		assert.Equal(t, "a.pdf", m.Attachments[0].FileName())
+	}
+
+	b, err := m.Bytes()
+	if err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+	assert.Contains(t, string(b), "\r\n--mixed\r\nContent-Type: text/plain; charset=utf-8\r\n"+
+		"Content-Transfer-Encoding: quoted-printable\r\n\r\n"+
+		"b.zip was removed =E2=80=93 it was unsafe.\r\n--mixed--\r\n")
+	assert.Contains(t, string(b), "--alt\r\nContent-Type: text/plain\r\n\r\nPlain\r\n--alt\r\n",
+		"Unchanged parts should be copied")
+
+	m = rewriteMessage(t, m)
+	assert.Equal(t, "multipart/alternative(text/plain multipart/related(text/html image/png)) "+
+		"application/pdf text/plain", partTypes(m.Root))
+}
+
+func TestReplaceContent(t *testing.T) {
+	m := readEditTestMessage(t)
+	text := m.Root.FirstChild().FirstChild()
+	assert.Nil(t, m.ReplaceContent(text, []byte("Grüße")))
+	assert.Equal(t, "quoted-printable", text.Header().Get("Content-Transfer-Encoding"))
+	assert.Nil(t, m.ReplaceContent(m.Attachments[0], []byte("%PDF-1.7")))
+	assert.Equal(t, "base64", m.Attachments[0].Header().Get("Content-Transfer-Encoding"))
+
+	m = rewriteMessage(t, m)
+	assert.Equal(t, "Grüße", m.Text)
+	if assert.Len(t, m.Attachments, 2) {
+		assert.Equal(t, []byte("%PDF-1.7"), m.Attachments[0].Content())
+	}
+
+	// Single part message
+	m, err := ReadMIMEBody(strings.NewReader("Subject: PDF\n" +
+		"Content-Type: application/pdf\n" +
+		"Content-Disposition: attachment; filename=a.pdf\n" +
+		"\n" +
+		"%PDF-1.7\n"))
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+	assert.Nil(t, m.ReplaceContent(m.Attachments[0], []byte{0xff, 0}))
+	assert.Equal(t, "base64", m.GetHeader("Content-Transfer-Encoding"))
+	b, err := m.Bytes()
+	if err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+	assert.True(t, strings.HasSuffix(string(b), "Content-Transfer-Encoding: base64\n\n/wA="), string(b))
+}
+
+var transferEncodingTestTable = []struct {
+	cte, mediatype, content, want string
+}{
+	{"", "text/plain", "ascii\r\n", ""},
+	{"7bit", "text/plain", "Grüße", "quoted-printable"},
+	{"8bit", "text/plain", "Grüße", "8bit"},
+	{"8bit", "text/plain", strings.Repeat("x", 999), "quoted-printable"},
+	{"7bit", "image/png", "\x89PNG", "base64"},
+	{"Base64", "text/plain", "Grüße", "Base64"},
+}
+
+func TestTransferEncoding(t *testing.T) {
+	for _, tt := range transferEncodingTestTable {
+		got := transferEncoding(tt.cte, tt.mediatype, []byte(tt.content))
+		assert.Equal(t, tt.want, got, tt.cte+" "+tt.content)
+	}
+}
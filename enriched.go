@@ -0,0 +1,104 @@
+package enmime
+
+import (
+	"strings"
+)
+
+// EnrichedToText converts text/enriched text (RFC 1896) to plain text.  The
+// formatting commands are dropped along with their <param> arguments, "<<"
+// stands for '<', and line breaks follow the filling rules: a single line
+// break is a space and n line breaks in a row are n-1 of them, except inside
+// <nofill>.  Lines inside <excerpt> are quoted with "> ".
+func EnrichedToText(text string) string {
+	text = strings.Replace(text, "\r\n", "\n", -1)
+	var b strings.Builder
+	param, nofill, excerpt := 0, 0, 0
+	lineStart := true
+	write := func(s string) {
+		if param > 0 {
+			return
+		}
+		if lineStart {
+			b.WriteString(strings.Repeat("> ", excerpt))
+			lineStart = false
+		}
+		b.WriteString(s)
+	}
+	newline := func() {
+		if lineStart {
+			b.WriteString(strings.Repeat(">", excerpt))
+		}
+		b.WriteByte('\n')
+		lineStart = true
+	}
+
+	for i := 0; i < len(text); {
+		switch text[i] {
+		case '<':
+			if strings.HasPrefix(text[i:], "<<") {
+				write("<")
+				i += 2
+				continue
+			}
+			end := strings.IndexByte(text[i:], '>')
+			if end < 0 {
+				write(text[i:])
+				i = len(text)
+				continue
+			}
+			name := strings.ToLower(text[i+1 : i+end])
+			i += end + 1
+			d := 1
+			if strings.HasPrefix(name, "/") {
+				name, d = name[1:], -1
+			}
+			switch name {
+			case "param":
+				param = enrichedDepth(param, d)
+			case "nofill":
+				nofill = enrichedDepth(nofill, d)
+			case "excerpt":
+				if !lineStart && param == 0 {
+					newline()
+				}
+				excerpt = enrichedDepth(excerpt, d)
+			}
+		case '\n':
+			n := 0
+			for i < len(text) && text[i] == '\n' {
+				n++
+				i++
+			}
+			switch {
+			case param > 0:
+			case nofill > 0:
+				for ; n > 0; n-- {
+					newline()
+				}
+			case n == 1:
+				write(" ")
+			default:
+				for ; n > 1; n-- {
+					newline()
+				}
+			}
+		default:
+			end := strings.IndexAny(text[i:], "<\n")
+			if end < 0 {
+				end = len(text) - i
+			}
+			write(text[i : i+end])
+			i += end
+		}
+	}
+	return b.String()
+}
+
+// enrichedDepth returns the nesting depth of a command after adding d, never
+// below zero for unbalanced commands.
+func enrichedDepth(depth, d int) int {
+	if depth+d < 0 {
+		return 0
+	}
+	return depth + d
+}
@@ -0,0 +1,83 @@
+package enmime
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var enrichedTestTable = []struct {
+	name     string
+	enriched string
+	want     string
+}{
+	{
+		"filling",
+		"<bold>Now</bold> is the time for <italic>all</italic>\r\ngood men\r\n\r\n<smaller>(and <<women>)</smaller>",
+		"Now is the time for all good men\n(and <women>)",
+	},
+	{
+		"paragraphs",
+		"One\n\n\nTwo",
+		"One\n\nTwo",
+	},
+	{
+		"param",
+		"<color><param>red</param>Red</color> and <fontfamily><param>Times</param>serif</fontfamily>",
+		"Red and serif",
+	},
+	{
+		"nofill",
+		"<nofill>a\n  b\n\nc</nofill>",
+		"a\n  b\n\nc",
+	},
+	{
+		"excerpt",
+		"You wrote:\n\n<excerpt>Lunch\nat noon?\n\n\nOK</excerpt>Yes",
+		"You wrote:\n> Lunch at noon?\n>\n> OK\nYes",
+	},
+	{
+		"unclosed",
+		"a < b",
+		"a < b",
+	},
+}
+
+func TestEnrichedToText(t *testing.T) {
+	for _, tt := range enrichedTestTable {
+		assert.Equal(t, tt.want, EnrichedToText(tt.enriched), tt.name)
+	}
+}
+
+func TestParseEnriched(t *testing.T) {
+	// The body is converted, and binMIME still reports the missing
+	// Content-Disposition
+	m, err := ReadMIMEBody(strings.NewReader("Content-Type: text/enriched; charset=iso-8859-1\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n\r\n" +
+		"<bold>Caf=E9</bold>\r\nau lait\r\n"))
+	if m == nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+	assert.EqualError(t, err, "mime: no media type")
+	assert.Equal(t, "Café au lait ", m.Text)
+	assert.False(t, m.IsTextFromHTML)
+	assert.Equal(t, 1, len(m.Attachments))
+
+	m, err = ReadMIMEBody(strings.NewReader("Content-Type: multipart/alternative; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: text/enriched\r\n\r\n<bold>Rich</bold>\r\n" +
+		"--b\r\nContent-Type: text/plain\r\n\r\nPlain\r\n--b--\r\n"))
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+	assert.Equal(t, "Plain", m.Text)
+
+	m, err = ReadMIMEBody(strings.NewReader("Content-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: text/enriched\r\n\r\n<bold>Rich</bold> text\r\n" +
+		"--b\r\nContent-Type: text/enriched\r\nContent-Disposition: attachment\r\n\r\nOther\r\n--b--\r\n"))
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+	assert.Equal(t, "Rich text", m.Text)
+	assert.Equal(t, 1, len(m.OtherParts))
+}
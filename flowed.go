@@ -0,0 +1,179 @@
+package enmime
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/cention-sany/mime"
+)
+
+// flowedParams tells whether the Content-Type ctype is text/plain with
+// format=flowed, and whether it has delsp=yes.
+func flowedParams(ctype string) (flowed, delSp bool) {
+	mediatype, params, err := mime.ParseMediaType(ctype)
+	if err != nil && mime.IsOkPMTError(err) != nil {
+		return false, false
+	}
+	if mediatype != "text/plain" || !strings.EqualFold(params["format"], "flowed") {
+		return false, false
+	}
+	return true, strings.EqualFold(params["delsp"], "yes")
+}
+
+// unflowText decodes text of the Content-Type ctype when it is format=flowed,
+// unless opts keeps it as it is.
+func unflowText(ctype, text string, opts *ParseOptions) string {
+	if opts.KeepFlowed {
+		return text
+	}
+	if flowed, delSp := flowedParams(ctype); flowed {
+		return DecodeFlowed(text, delSp)
+	}
+	return text
+}
+
+// DecodeFlowed joins the lines of format=flowed text per RFC 3676.  A line
+// ending with a space flows into the next line of the same quote depth; with
+// delSp the space is deleted.  Space-stuffing is removed, and quoted lines get
+// their quote marks back followed by a space.  The line breaks of text are
+// kept, CRLF or LF.
+func DecodeFlowed(text string, delSp bool) string {
+	nl := "\n"
+	if strings.Contains(text, "\r\n") {
+		nl = "\r\n"
+	}
+	lines := strings.Split(strings.Replace(text, "\r\n", "\n", -1), "\n")
+	var out []string
+	var para strings.Builder
+	paraDepth, open := 0, false
+	flush := func() {
+		if open {
+			out = append(out, quotePrefix(paraDepth, para.String())+para.String())
+			para.Reset()
+			open = false
+		}
+	}
+	for i, l := range lines {
+		if i == len(lines)-1 && l == "" {
+			break
+		}
+		depth := 0
+		for depth < len(l) && l[depth] == '>' {
+			depth++
+		}
+		l = strings.TrimPrefix(l[depth:], " ")
+		if open && depth != paraDepth {
+			// A flowed line cannot flow into another quote depth
+			flush()
+		}
+		paraDepth, open = depth, true
+		if l == "-- " || !strings.HasSuffix(l, " ") {
+			para.WriteString(l)
+			flush()
+			continue
+		}
+		if delSp {
+			l = l[:len(l)-1]
+		}
+		para.WriteString(l)
+	}
+	flush()
+	decoded := strings.Join(out, nl)
+	if strings.HasSuffix(text, "\n") {
+		decoded += nl
+	}
+	return decoded
+}
+
+// EncodeFlowed formats text as format=flowed per RFC 3676, wrapping lines
+// longer than width characters at spaces, 78 if width is not positive.  Each
+// line of text is a paragraph; lines starting with '>' are quoted at the depth
+// of their quote marks.  Lines are space-stuffed when needed, and trailing
+// spaces of paragraphs are removed.  With delSp the soft line breaks get a
+// space of their own, for a Content-Type with delsp=yes.  Line breaks are
+// CRLF.
+func EncodeFlowed(text string, width int, delSp bool) string {
+	if text == "" {
+		return ""
+	}
+	if width <= 0 {
+		width = 78
+	}
+	lines := strings.Split(strings.Replace(text, "\r\n", "\n", -1), "\n")
+	if len(lines) > 1 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	var b strings.Builder
+	for _, l := range lines {
+		if l == "-- " {
+			b.WriteString(l + "\r\n")
+			continue
+		}
+		depth := 0
+		for depth < len(l) && l[depth] == '>' {
+			depth++
+		}
+		prefix := strings.Repeat(">", depth)
+		content := strings.TrimRight(l[depth:], " ")
+		if depth > 0 {
+			content = strings.TrimPrefix(content, " ")
+			if content != "" {
+				prefix += " "
+			}
+		}
+		room := width - utf8.RuneCountInString(prefix)
+		for {
+			line, rest := content, ""
+			if utf8.RuneCountInString(content) > room {
+				line, rest = wrapFlowed(content, room)
+			}
+			if depth == 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, ">") ||
+				strings.HasPrefix(line, "From ")) {
+				line = " " + line
+			}
+			if rest == "" {
+				b.WriteString(prefix + line + "\r\n")
+				break
+			}
+			if delSp {
+				line += " "
+			}
+			b.WriteString(prefix + line + "\r\n")
+			content = rest
+		}
+	}
+	return b.String()
+}
+
+// wrapFlowed splits content after the last space that keeps the first line
+// within room characters, or after the first space if there is none.  The
+// first line keeps the space, and is never "-- ", which decoders take for a
+// signature separator (RFC 3676 section 4.3).
+func wrapFlowed(content string, room int) (string, string) {
+	cut, n := -1, 0
+	for i, r := range content {
+		if n >= room && cut > 0 {
+			break
+		}
+		if r == ' ' && i > 0 && i+1 < len(content) && !(i == 2 && strings.HasPrefix(content, "-- ")) {
+			cut = i + 1
+		}
+		n++
+	}
+	if cut < 0 {
+		return content, ""
+	}
+	return content[:cut], content[cut:]
+}
+
+// quotePrefix returns the quote marks of a line at depth, followed by a space
+// when there is content.
+func quotePrefix(depth int, content string) string {
+	if depth == 0 {
+		return ""
+	}
+	if content == "" {
+		return strings.Repeat(">", depth)
+	}
+	return strings.Repeat(">", depth) + " "
+}
@@ -0,0 +1,104 @@
+package enmime
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var decodeFlowedTestTable = []struct {
+	text  string
+	delSp bool
+	want  string
+}{
+	{"Hello \r\nworld\r\n", false, "Hello world\r\n"},
+	{"Hello\nworld", false, "Hello\nworld"},
+	{"Hel\r\nlo \r\nworld\r\n", true, "Hel\r\nloworld\r\n"},
+	{"Hello  \r\nworld\r\n", true, "Hello world\r\n"},
+	{" From me \r\n >quoted\r\n", false, "From me >quoted\r\n"},
+	{"> Quoted \r\n> text\r\n>\r\nAnswer\r\n", false, "> Quoted text\r\n>\r\nAnswer\r\n"},
+	{">> Deep \r\n> shallow\r\n", false, ">> Deep \r\n> shallow\r\n"},
+	{"Text \r\n-- \r\nSig\r\n", false, "Text -- \r\nSig\r\n"},
+	{"-- \r\nSig\r\n", false, "-- \r\nSig\r\n"},
+	{"Trailing ", false, "Trailing "},
+}
+
+func TestDecodeFlowed(t *testing.T) {
+	for _, tt := range decodeFlowedTestTable {
+		assert.Equal(t, tt.want, DecodeFlowed(tt.text, tt.delSp), "%q", tt.text)
+	}
+}
+
+var encodeFlowedTestTable = []struct {
+	text  string
+	width int
+	delSp bool
+	want  string
+}{
+	{"", 0, false, ""},
+	{"Short line  \n", 0, false, "Short line\r\n"},
+	{"one two three four", 10, false, "one two \r\nthree four\r\n"},
+	{"one two three four", 9, true, "one two  \r\nthree  \r\nfour\r\n"},
+	{"unbreakable-word next", 5, false, "unbreakable-word \r\nnext\r\n"},
+	{"From here\n>quoted\n  indented", 0, false, " From here\r\n> quoted\r\n   indented\r\n"},
+	{">>quoted text here\n>\n-- \nsig", 12, false, ">> quoted \r\n>> text here\r\n>\r\n-- \r\nsig\r\n"},
+	{"Grüße aus Köln", 8, false, "Grüße \r\naus Köln\r\n"},
+	{"-- verylongwordhere and more", 20, false, "-- verylongwordhere \r\nand more\r\n"},
+	{"a b -- verylongwordhere", 4, false, "a b \r\n-- verylongwordhere\r\n"},
+}
+
+func TestEncodeFlowed(t *testing.T) {
+	for _, tt := range encodeFlowedTestTable {
+		assert.Equal(t, tt.want, EncodeFlowed(tt.text, tt.width, tt.delSp), "%q", tt.text)
+	}
+}
+
+func TestFlowedRoundTrip(t *testing.T) {
+	text := "A paragraph long enough to be wrapped over several lines when it is encoded.\r\n" +
+		"\r\n" +
+		"> A quoted paragraph, long enough to be wrapped too when it is encoded.\r\n" +
+		"From the start\r\n" +
+		"-- \r\n" +
+		"Signature\r\n"
+	for _, delSp := range []bool{false, true} {
+		encoded := EncodeFlowed(text, 30, delSp)
+		for _, l := range strings.Split(encoded, "\r\n") {
+			assert.True(t, len(l) <= 31, "%q is too long", l)
+		}
+		assert.Equal(t, text, DecodeFlowed(encoded, delSp))
+	}
+}
+
+func TestParseFlowed(t *testing.T) {
+	const message = "Content-Type: multipart/mixed; boundary=b\r\n" +
+		"\r\n" +
+		"--b\r\n" +
+		"Content-Type: text/plain; format=flowed; delsp=yes\r\n" +
+		"\r\n" +
+		"Hel \r\n" +
+		"lo \r\n" +
+		"world\r\n" +
+		"--b--\r\n"
+	m, err := ReadMIMEBody(strings.NewReader(message))
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+	assert.Equal(t, "Helloworld", m.Text)
+	assert.Equal(t, "Hel \r\nlo \r\nworld", string(m.Root.FirstChild().Content()))
+
+	m, err = ReadMIMEBodyWithOptions(strings.NewReader(message), &ParseOptions{KeepFlowed: true})
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+	assert.Equal(t, "Hel \r\nlo \r\nworld", m.Text)
+
+	m, err = ReadMIMEBody(strings.NewReader("Content-Type: text/plain; format=Flowed\r\n" +
+		"\r\n" +
+		"Hello \r\n" +
+		" world\r\n"))
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+	assert.Equal(t, "Hello world\r\n", m.Text)
+}
@@ -1,10 +1,13 @@
 package enmime
 
 import (
+	"encoding/base64"
 	"fmt"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/cention-sany/mime"
+	"github.com/cention-sany/net/mail"
 )
 
 func debug(format string, args ...interface{}) {
@@ -20,20 +23,60 @@ func debug(format string, args ...interface{}) {
 //  encoding: the character encoding type used for the encoded-text
 //  encoded-text: the text we are decoding
 
-// DecodeHeader (per RFC 2047) using Golang's mime.WordDecoder
+// DecodeHeader (per RFC 2047) using Golang's mime.WordDecoder.  Headers with
+// raw 8-bit text that is not valid UTF-8 are converted using the detected
+// charset.
 func DecodeHeader(input string) string {
-	if !strings.Contains(input, "=?") {
+	return DecodeHeaderFallback(input, "").Value
+}
+
+// DecodedHeader is a header value decoded by DecodeHeaderFallback.
+type DecodedHeader struct {
+	Value   string // The decoded UTF-8 value
+	Charset string // Charset raw 8-bit text was converted from, if any
+	Guessed bool   // Value holds raw 8-bit text converted from a guessed charset
+}
+
+// DecodeHeaderFallback decodes a header like DecodeHeader, but converts raw
+// 8-bit text that is not valid UTF-8 from the fallback charset, usually the
+// charset of the message body.  The charset is detected when fallback is empty,
+// unsupported or does not fit the text.  Headers never declare the charset of
+// raw text, so any such conversion is reported as Guessed.
+func DecodeHeaderFallback(input, fallback string) DecodedHeader {
+	result := DecodedHeader{Value: input}
+	if !isASCIIOrUTF8([]byte(input)) {
+		result.Value, result.Charset = decodeRawHeader(input, fallback)
+		result.Guessed = result.Charset != ""
+	}
+	if !strings.Contains(result.Value, "=?") {
 		// Don't scan if there is nothing to do here
-		return input
+		return result
 	}
 
 	dec := new(mime.WordDecoder)
 	dec.CharsetReader = NewCharsetReader
-	header, err := dec.DecodeHeader(input)
-	if err != nil {
-		return input
+	header, err := dec.DecodeHeader(result.Value)
+	if err == nil {
+		result.Value = header
 	}
-	return header
+	return result
+}
+
+// decodeRawHeader converts an unencoded header holding 8-bit text to UTF-8
+// using the fallback charset or the detected one.  It returns the header
+// unchanged and an empty charset if no charset fits.
+func decodeRawHeader(input, fallback string) (string, string) {
+	label := strings.ToLower(strings.TrimSpace(fallback))
+	if CanonicalCharset(label) == "utf-8" || label == "us-ascii" || label == "ascii" {
+		// Known not to fit 8-bit text that is not UTF-8
+		fallback = ""
+	}
+	// decodeToUTF8 falls back to detection itself
+	s, cs, err := decodeToUTF8(fallback, []byte(input))
+	if err != nil || cs == "" || decodeValidity(s) < 1 {
+		return input, ""
+	}
+	return s, cs
 }
 
 // DecodeToUTF8Base64Header decodes a MIME header per RFC 2047, reencoding to =?utf-8b?
@@ -86,3 +129,254 @@ func isWhiteSpaceRune(r rune) bool {
 		return false
 	}
 }
+
+const (
+	// maxEncodedWordLen is the RFC 2047 limit for a single encoded-word
+	maxEncodedWordLen = 75
+	// maxHeaderLineLen is the line length RFC 5322 recommends folding at
+	maxHeaderLineLen = 78
+)
+
+// EncodeHeader encodes the value of the header field name per RFC 2047 and
+// folds it at 78 columns, counting the "name: " prefix on the first line.
+// Only runs of words that need it are encoded, as UTF-8 using whichever of the
+// Q and B encodings is shorter.  Encoded-words are kept within 75 characters
+// and never split a character.  The result does not include the name.
+func EncodeHeader(name, value string) string {
+	f := newHeaderFolder(name)
+	f.writeText(unfoldHeader(value))
+	return f.String()
+}
+
+// EncodeAddressHeader formats addrs as the value of the header field name,
+// like EncodeHeader but only encoding the display names.  Plain display names
+// are quoted when needed, and addresses are never folded.
+func EncodeAddressHeader(name string, addrs []*mail.Address) string {
+	f := newHeaderFolder(name)
+	for i, a := range addrs {
+		if i > 0 {
+			f.appendToLast(",")
+		}
+		n := unfoldHeader(a.Name)
+		switch {
+		case n == "":
+			f.writeToken(a.Address)
+			continue
+		case needsEncoding(n):
+			f.writeEncoded(n)
+		case needsQuoting(n):
+			f.writeToken(quoteDisplayName(n))
+		default:
+			f.writeText(n)
+		}
+		f.writeToken("<" + a.Address + ">")
+	}
+	return f.String()
+}
+
+// headerFolder builds a folded header value from space separated tokens.
+type headerFolder struct {
+	b   strings.Builder
+	col int
+	any bool
+}
+
+func newHeaderFolder(name string) *headerFolder {
+	return &headerFolder{col: len(name) + len(": ")}
+}
+
+func (f *headerFolder) String() string { return f.b.String() }
+
+// writeToken writes a token, separated from the previous one by a space that
+// becomes a fold if the token would not fit on the current line.
+func (f *headerFolder) writeToken(token string) {
+	if f.any {
+		if f.col+1+len(token) > maxHeaderLineLen {
+			f.b.WriteString("\r\n")
+			f.col = 0
+		}
+		f.b.WriteByte(' ')
+		f.col++
+	}
+	f.b.WriteString(token)
+	f.col += len(token)
+	f.any = true
+}
+
+// appendToLast writes s directly after the last token.
+func (f *headerFolder) appendToLast(s string) {
+	f.b.WriteString(s)
+	f.col += len(s)
+}
+
+// writeText writes space separated words, encoding the runs of words that
+// need it.
+func (f *headerFolder) writeText(text string) {
+	words := strings.Split(text, " ")
+	for i := 0; i < len(words); i++ {
+		if !needsEncoding(words[i]) {
+			f.writeToken(words[i])
+			continue
+		}
+		// Spaces between encoded-words are ignored when decoding, so the
+		// whole run goes into the encoded text, with the runs of spaces and
+		// tabs between its words.
+		j := i + 1
+		for k := j; k < len(words); k++ {
+			if needsEncoding(words[k]) {
+				j = k + 1
+			} else if strings.Trim(words[k], "\t") != "" {
+				break
+			}
+		}
+		f.writeEncoded(strings.Join(words[i:j], " "))
+		i = j - 1
+	}
+}
+
+// writeEncoded writes s as one or more UTF-8 encoded-words, the first one
+// sized to fill the current line.
+func (f *headerFolder) writeEncoded(s string) {
+	first := maxHeaderLineLen - f.col
+	if f.any {
+		first--
+	}
+	if first < maxEncodedWordLen/3 {
+		// Rather start on a new line
+		first = maxEncodedWordLen
+	}
+	for _, w := range encodeWords(s, first) {
+		f.writeToken(w)
+	}
+}
+
+// encodeWords splits s into encoded-words, in the Q or B encoding, whichever
+// is shorter for the whole of s.  The first word is at most first characters
+// long and the others at most 75.
+func encodeWords(s string, first int) []string {
+	if first > maxEncodedWordLen {
+		first = maxEncodedWordLen
+	}
+	var qLen int
+	for i := 0; i < len(s); i++ {
+		qLen += qCharLen(s[i])
+	}
+	useQ := qLen <= base64Len(len(s))
+	prefix := "=?UTF-8?B?"
+	if useQ {
+		prefix = "=?UTF-8?Q?"
+	}
+	max := first - len(prefix) - len("?=")
+
+	var words []string
+	start, n := 0, 0
+	for i, r := range s {
+		size := utf8.RuneLen(r)
+		if r == utf8.RuneError {
+			_, size = utf8.DecodeRuneInString(s[i:])
+		}
+		if useQ {
+			var l int
+			for k := i; k < i+size; k++ {
+				l += qCharLen(s[k])
+			}
+			if n+l > max && i > start {
+				words = append(words, prefix+qEncode(s[start:i])+"?=")
+				start, n = i, 0
+				max = maxEncodedWordLen - len(prefix) - len("?=")
+			}
+			n += l
+		} else {
+			if base64Len(i+size-start) > max && i > start {
+				words = append(words, prefix+base64.StdEncoding.EncodeToString([]byte(s[start:i]))+"?=")
+				start = i
+				max = maxEncodedWordLen - len(prefix) - len("?=")
+			}
+		}
+	}
+	if useQ {
+		words = append(words, prefix+qEncode(s[start:])+"?=")
+	} else {
+		words = append(words, prefix+base64.StdEncoding.EncodeToString([]byte(s[start:]))+"?=")
+	}
+	return words
+}
+
+func base64Len(n int) int { return (n + 2) / 3 * 4 }
+
+// qLiteral reports whether c may appear unencoded in a Q encoded-word, even
+// one standing for a display name (RFC 2047 section 5 (3)).
+func qLiteral(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c == '!' || c == '*' || c == '+' || c == '-' || c == '/'
+}
+
+func qCharLen(c byte) int {
+	if qLiteral(c) || c == ' ' {
+		return 1
+	}
+	return 3
+}
+
+func qEncode(s string) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == ' ':
+			b.WriteByte('_')
+		case qLiteral(c):
+			b.WriteByte(c)
+		default:
+			b.WriteByte('=')
+			b.WriteByte(hex[c>>4])
+			b.WriteByte(hex[c&0x0f])
+		}
+	}
+	return b.String()
+}
+
+// needsEncoding reports whether a word has to be written as an encoded-word:
+// it holds non-ASCII or control characters, or could be mistaken for one.
+func needsEncoding(word string) bool {
+	for i := 0; i < len(word); i++ {
+		if c := word[i]; c >= 0x7f || c < 0x20 && c != '\t' {
+			return true
+		}
+	}
+	return strings.Contains(word, "=?")
+}
+
+// needsQuoting reports whether a display name holds characters other than
+// atext and spaces.
+func needsQuoting(name string) bool {
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+			strings.IndexByte(" !#$%&'*+-/=?^_`{|}~", c) >= 0 {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+func quoteDisplayName(name string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(name); i++ {
+		if name[i] == '"' || name[i] == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(name[i])
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// unfoldHeader removes the line breaks of a folded header value.
+func unfoldHeader(value string) string {
+	value = strings.Replace(value, "\r\n", "", -1)
+	return strings.Replace(value, "\n", "", -1)
+}
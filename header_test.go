@@ -1,8 +1,11 @@
 package enmime
 
 import (
+	"strings"
 	"testing"
+	"unicode/utf8"
 
+	"github.com/cention-sany/net/mail"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -128,3 +131,106 @@ func TestDecodeToUTF8Base64Header(t *testing.T) {
 			"Expected %q, got %q for input %q", tt.expect, result, tt.input)
 	}
 }
+
+// Test raw 8-bit headers
+func TestDecodeHeaderFallback(t *testing.T) {
+	koi8 := "\xf7\xc1\xdb \xda\xc1\xcb\xc1\xda \xcf\xd4\xd0\xd2\xc1\xd7\xcc\xc5\xce" // Ваш заказ отправлен
+	latin1 := "R\xe9ponse \xe0 votre demande"
+	var testTable = []struct {
+		input, fallback string
+		expect          DecodedHeader
+	}{
+		{"plain", "koi8-r", DecodedHeader{"plain", "", false}},
+		{"caf\xc3\xa9", "koi8-r", DecodedHeader{"café", "", false}},
+		{koi8, "koi8-r", DecodedHeader{"Ваш заказ отправлен", "koi8-r", true}},
+		{koi8, "", DecodedHeader{"Ваш заказ отправлен", "koi8-r", true}},
+		{koi8, "utf-8", DecodedHeader{"Ваш заказ отправлен", "koi8-r", true}},
+		{koi8, "x-unknown", DecodedHeader{"Ваш заказ отправлен", "koi8-r", true}},
+		{latin1, "iso-8859-1", DecodedHeader{"Réponse à votre demande", "iso-8859-1", true}},
+		{latin1 + " =?utf-8?q?=E2=82=AC?=", "iso-8859-1",
+			DecodedHeader{"Réponse à votre demande €", "iso-8859-1", true}},
+		// Shift_JIS does not fit, the detected charset is used
+		{"\x82\xa8\x92m\x82\xe7\x82\xb9", "shift_jis", DecodedHeader{"お知らせ", "shift_jis", true}},
+		{"\x82\xa8\x92m\x82\xe7\x82\xb9", "euc-jp", DecodedHeader{"お知らせ", "shift_jis", true}},
+	}
+
+	for _, tt := range testTable {
+		result := DecodeHeaderFallback(tt.input, tt.fallback)
+		assert.Equal(t, tt.expect, result, "Input %q, fallback %q", tt.input, tt.fallback)
+	}
+}
+
+// Test RFC 2047 encoding
+func TestEncodeHeader(t *testing.T) {
+	var testTable = []struct {
+		input, expect string
+	}{
+		{"Hello world", "Hello world"},
+		{"Café au lait", "=?UTF-8?B?Q2Fmw6k=?= au lait"},
+		{"Grüße aus München", "=?UTF-8?B?R3LDvMOfZQ==?= aus =?UTF-8?Q?M=C3=BCnchen?="},
+		{"Ваш заказ", "=?UTF-8?B?0JLQsNGIINC30LDQutCw0Lc=?="},
+		{"Zürich-Flughafen", "=?UTF-8?Q?Z=C3=BCrich-Flughafen?="},
+		{"not =?an?= encoded-word", "not =?UTF-8?B?PT9hbj89?= encoded-word"},
+		{"folded\r\n line", "folded line"},
+		{"wörld    😀", "=?UTF-8?B?d8O2cmxkICAgIPCfmIA=?="},
+		{"wörld \t 😀  end", "=?UTF-8?B?d8O2cmxkIAkg8J+YgA==?=  end"},
+		{"a  b\t\tc", "a  b\t\tc"},
+	}
+
+	for _, tt := range testTable {
+		result := EncodeHeader("Subject", tt.input)
+		assert.Equal(t, tt.expect, result, "Input %q", tt.input)
+		assert.Equal(t, unfoldHeader(tt.input), DecodeHeader(result))
+	}
+}
+
+func TestEncodeHeaderFolding(t *testing.T) {
+	inputs := []string{
+		strings.Repeat("ascii words only ", 12),
+		strings.Repeat("日本語のテキスト", 20),
+		strings.Repeat("Ärger über Öl, ", 15),
+		"Re: " + strings.Repeat("€", 40) + " and some plain text to finish the line off",
+	}
+
+	for _, input := range inputs {
+		result := EncodeHeader("Subject", input)
+		lines := strings.Split(result, "\r\n")
+		for i, line := range lines {
+			if i == 0 {
+				line = "Subject: " + line
+			} else {
+				assert.True(t, strings.HasPrefix(line, " "), "Fold must start with a space")
+			}
+			assert.True(t, len(line) <= 78, "Line too long: %q", line)
+			for _, word := range strings.Fields(line) {
+				if strings.HasPrefix(word, "=?") {
+					assert.True(t, len(word) <= 75, "Encoded-word too long: %q", word)
+					assert.True(t, utf8.ValidString(DecodeHeader(word)),
+						"Encoded-word splits a character: %q", word)
+				}
+			}
+		}
+		assert.True(t, len(lines) > 1, "Expected folding of %q", result)
+		assert.Equal(t, input, DecodeHeader(unfoldHeader(result)))
+	}
+}
+
+func TestEncodeAddressHeader(t *testing.T) {
+	addrs := []*mail.Address{
+		{Name: "Jöhn Doe", Address: "john@example.com"},
+		{Name: "Smith, Jane", Address: "jane@example.com"},
+		{Name: "Bob", Address: "bob@example.com"},
+		{Address: "nobody@example.com"},
+	}
+	result := EncodeAddressHeader("To", addrs)
+	assert.Equal(t, "=?UTF-8?B?SsO2aG4gRG9l?= <john@example.com>, \"Smith, Jane\"\r\n"+
+		" <jane@example.com>, Bob <bob@example.com>, nobody@example.com", result)
+
+	parsed, err := mail.ParseAddressList(DecodeToUTF8Base64Header(unfoldHeader(result)))
+	if assert.Nil(t, err) && assert.Equal(t, len(addrs), len(parsed)) {
+		for i, a := range addrs {
+			assert.Equal(t, a.Name, parsed[i].Name)
+			assert.Equal(t, a.Address, parsed[i].Address)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package enmime
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+
+	"github.com/cention-sany/mime"
+	"github.com/cention-sany/net/mail"
+	"github.com/cention-sany/net/textproto"
+)
+
+// HeaderField is a header field as it is written in the message.
+type HeaderField struct {
+	Name   string // Field name as written
+	Raw    string // Value as written, folding included, without the line break ending the field
+	Value  string // Unfolded value with its encoded words decoded
+	Offset int    // Byte offset of the field in the original message, or -1
+}
+
+// HeaderFields is a header block as the ordered list of its fields, repeated
+// fields included.
+type HeaderFields []HeaderField
+
+// HeaderFieldsPart is implemented by the parts of this package, whose header
+// is also known as an ordered list of fields, and can be replaced by one.  Get
+// at it with a type assertion on a MIMEPart.
+type HeaderFieldsPart interface {
+	MIMEPart
+	HeaderFields() HeaderFields   // Header as an ordered list of fields
+	SetHeaderFields(HeaderFields) // Replace the header with an ordered list
+}
+
+// Get returns the decoded value of the first field called name, or an empty
+// string.  Names are not case sensitive.
+func (h HeaderFields) Get(name string) string {
+	for _, f := range h {
+		if strings.EqualFold(f.Name, name) {
+			return f.Value
+		}
+	}
+	return ""
+}
+
+// Values returns the decoded values of all the fields called name, in order.
+func (h HeaderFields) Values(name string) []string {
+	var values []string
+	for _, f := range h {
+		if strings.EqualFold(f.Name, name) {
+			values = append(values, f.Value)
+		}
+	}
+	return values
+}
+
+// Add returns the fields with a name field holding value appended.  The value
+// is encoded and folded with EncodeHeader.
+func (h HeaderFields) Add(name, value string) HeaderFields {
+	return append(h[:len(h):len(h)], newHeaderField(name, EncodeHeader(name, value)))
+}
+
+// Prepend is like Add, but puts the new field first, where trace and spam
+// filter fields go.
+func (h HeaderFields) Prepend(name, value string) HeaderFields {
+	return append(HeaderFields{newHeaderField(name, EncodeHeader(name, value))}, h...)
+}
+
+// Set returns the fields with value in place of the first name field and the
+// other name fields removed.  The field is appended when there is none.
+func (h HeaderFields) Set(name, value string) HeaderFields {
+	return h.replace(newHeaderField(name, EncodeHeader(name, value)))
+}
+
+// SetAddresses is like Set for an address field, encoded with
+// EncodeAddressHeader.
+func (h HeaderFields) SetAddresses(name string, addrs []*mail.Address) HeaderFields {
+	return h.replace(newHeaderField(name, EncodeAddressHeader(name, addrs)))
+}
+
+// Delete returns the fields without the ones called name.
+func (h HeaderFields) Delete(name string) HeaderFields {
+	fields := make(HeaderFields, 0, len(h))
+	for _, f := range h {
+		if !strings.EqualFold(f.Name, name) {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// replace puts field in place of the first field of the same name and drops
+// the others, or appends it.
+func (h HeaderFields) replace(field HeaderField) HeaderFields {
+	fields := make(HeaderFields, 0, len(h)+1)
+	done := false
+	for _, f := range h {
+		if !strings.EqualFold(f.Name, field.Name) {
+			fields = append(fields, f)
+		} else if !done {
+			fields = append(fields, field)
+			done = true
+		}
+	}
+	if !done {
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+// newHeaderField makes a field that is not in the original message from its
+// encoded value.
+func newHeaderField(name, encoded string) HeaderField {
+	raw := " " + encoded
+	return HeaderField{
+		Name:   name,
+		Raw:    raw,
+		Value:  DecodeHeaderFallback(strings.TrimSpace(unfoldHeader(raw)), "").Value,
+		Offset: -1,
+	}
+}
+
+// HeaderFields returns the header of the message as an ordered list.  Only
+// messages parsed with ReadMIMEBody know the order, names and offsets of
+// their fields; for the others the fields are sorted by canonical name.
+// Fields given to SetHeaderFields are returned as they were given.
+func (m *MIMEBody) HeaderFields() HeaderFields {
+	if m.fields != nil {
+		return append(HeaderFields(nil), m.fields...)
+	}
+	if m.raw != nil {
+		return parseHeaderFields(m.raw[:rawHeaderEnd(m.raw, 0, len(m.raw))], 0, m.headerCharset())
+	}
+	return headerFieldsFromMap(m.header, m.headerCharset())
+}
+
+// Header as an ordered list, see MIMEBody.HeaderFields
+func (p *memMIMEPart) HeaderFields() HeaderFields {
+	if p.fields != nil {
+		return append(HeaderFields(nil), p.fields...)
+	}
+	if p.raw != nil {
+		return parseHeaderFields(p.RawHeader(), p.rawStart, p.charset)
+	}
+	return headerFieldsFromMap(p.header, p.charset)
+}
+
+// SetHeaderFields replaces the header of the message with fields, in their
+// order.  GetHeader, AddressList and the other accessors see the new fields,
+// and WriteTo writes them.  A field with an empty Raw gets its Value encoded.
+// The body is not parsed again: Text, HTML and the parts stay as they are.
+func (m *MIMEBody) SetHeaderFields(fields HeaderFields) {
+	m.fields = encodeHeaderFields(fields)
+	if m.header == nil {
+		m.header = make(mail.Header)
+	}
+	fillHeaderMap(m.header, m.fields)
+}
+
+// Replace the header with an ordered list, see MIMEBody.SetHeaderFields
+func (p *memMIMEPart) SetHeaderFields(fields HeaderFields) {
+	p.fields = encodeHeaderFields(fields)
+	if p.header == nil {
+		p.header = make(textproto.MIMEHeader)
+	}
+	fillHeaderMap(p.header, p.fields)
+
+	mediatype, mparams, err := mime.ParseMediaType(p.header.Get("Content-Type"))
+	if err == nil || mime.IsOkPMTError(err) == nil {
+		p.contentType = mediatype
+	}
+	p.charset = ""
+	p.setDisposition(mparams)
+}
+
+// encodeHeaderFields copies fields, giving the ones without Raw their encoded
+// Value.
+func encodeHeaderFields(fields HeaderFields) HeaderFields {
+	encoded := make(HeaderFields, len(fields))
+	for i, f := range fields {
+		if f.Raw == "" && f.Value != "" {
+			f = newHeaderField(f.Name, EncodeHeader(f.Name, f.Value))
+		}
+		encoded[i] = f
+	}
+	return encoded
+}
+
+// fillHeaderMap replaces the content of header with the unfolded values of
+// fields, like textproto reads them.
+func fillHeaderMap(header map[string][]string, fields HeaderFields) {
+	for name := range header {
+		delete(header, name)
+	}
+	for _, f := range fields {
+		name := textproto.CanonicalMIMEHeaderKey(f.Name)
+		header[name] = append(header[name], strings.TrimSpace(unfoldHeader(f.Raw)))
+	}
+}
+
+// parseHeaderFields splits a header block found at offset in the original
+// message.  Lines that are not fields are dropped, with their continuation
+// lines.  Raw 8-bit values are decoded from fallback.
+func parseHeaderFields(block []byte, offset int, fallback string) HeaderFields {
+	type span struct{ start, colon, end int }
+	var spans []span
+	folding := false
+	for i := 0; i < len(block); {
+		lineEnd, next := len(block), len(block)
+		if nl := bytes.IndexByte(block[i:], '\n'); nl >= 0 {
+			lineEnd, next = i+nl, i+nl+1
+		}
+		line := bytes.TrimRight(block[i:lineEnd], "\r")
+		if len(line) == 0 {
+			break
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			if folding {
+				spans[len(spans)-1].end = lineEnd
+			}
+		} else if c := bytes.IndexByte(line, ':'); c > 0 {
+			spans = append(spans, span{i, i + c, lineEnd})
+			folding = true
+		} else {
+			folding = false
+		}
+		i = next
+	}
+
+	fields := make(HeaderFields, len(spans))
+	for i, s := range spans {
+		raw := strings.TrimSuffix(string(block[s.colon+1:s.end]), "\r")
+		fields[i] = HeaderField{
+			Name:   strings.TrimRight(string(block[s.start:s.colon]), " \t"),
+			Raw:    raw,
+			Value:  DecodeHeaderFallback(strings.TrimSpace(unfoldHeader(raw)), fallback).Value,
+			Offset: offset + s.start,
+		}
+	}
+	return fields
+}
+
+// headerFieldsFromMap lists the fields of a parsed header, whose order is
+// lost, sorted by name.
+func headerFieldsFromMap(header map[string][]string, fallback string) HeaderFields {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var fields HeaderFields
+	for _, name := range names {
+		for _, v := range header[name] {
+			fields = append(fields, HeaderField{
+				Name:   name,
+				Raw:    v,
+				Value:  DecodeHeaderFallback(strings.TrimSpace(unfoldHeader(v)), fallback).Value,
+				Offset: -1,
+			})
+		}
+	}
+	return fields
+}
@@ -0,0 +1,117 @@
+package enmime
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const headerFieldsTestMessage = "Received: from b.example.net by c.example.org;\r\n" +
+	"\tMon, 2 Mar 2020 10:00:02 +0000\r\n" +
+	"X-Spam-Score: 1.2\r\n" +
+	"Received: from a.example.com by b.example.net; Mon, 2 Mar 2020 10:00:01 +0000\r\n" +
+	"SUBJECT : =?utf-8?q?Gr=C3=BC=C3=9Fe?=\r\n" +
+	"From: me@example.com\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=b\r\n" +
+	"\r\n" +
+	"--b\r\n" +
+	"content-type: text/plain\r\n" +
+	"X-Part: one\r\n" +
+	"\r\n" +
+	"Body\r\n" +
+	"--b--\r\n"
+
+func TestHeaderFieldsOrder(t *testing.T) {
+	m, err := ReadMIMEBody(strings.NewReader(headerFieldsTestMessage))
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+	fields := m.HeaderFields()
+	var names []string
+	for _, f := range fields {
+		names = append(names, f.Name)
+		assert.True(t, strings.HasPrefix(headerFieldsTestMessage[f.Offset:], f.Name),
+			"Offset of %v should point at its name", f.Name)
+	}
+	assert.Equal(t, []string{"Received", "X-Spam-Score", "Received", "SUBJECT", "From",
+		"MIME-Version", "Content-Type"}, names)
+
+	assert.Equal(t, " from b.example.net by c.example.org;\r\n\tMon, 2 Mar 2020 10:00:02 +0000",
+		fields[0].Raw)
+	assert.Equal(t, "from b.example.net by c.example.org;\tMon, 2 Mar 2020 10:00:02 +0000",
+		fields[0].Value)
+	assert.Equal(t, " =?utf-8?q?Gr=C3=BC=C3=9Fe?=", fields[3].Raw)
+	assert.Equal(t, "Grüße", fields[3].Value)
+	assert.Equal(t, "Grüße", fields.Get("subject"))
+	assert.Equal(t, 2, len(fields.Values("received")))
+	assert.Equal(t, "", fields.Get("Cc"))
+
+	// Parts
+	p := m.Root.FirstChild().(HeaderFieldsPart)
+	fields = p.HeaderFields()
+	if assert.Equal(t, 2, len(fields)) {
+		assert.Equal(t, "content-type", fields[0].Name)
+		assert.Equal(t, "one", fields.Get("X-Part"))
+		assert.Equal(t, strings.Index(headerFieldsTestMessage, "X-Part"), fields[1].Offset)
+	}
+	// The header map is still there
+	assert.Equal(t, "one", p.Header().Get("X-Part"))
+}
+
+func TestHeaderFieldsWithoutOriginal(t *testing.T) {
+	m := parseHeaderOnly(t, "Subject: Hello\nReceived: two\nReceived: one\n")
+	fields := m.HeaderFields()
+	var names []string
+	for _, f := range fields {
+		names = append(names, f.Name)
+		assert.Equal(t, -1, f.Offset)
+	}
+	assert.Equal(t, []string{"Received", "Received", "Subject"}, names)
+	assert.Equal(t, []string{"two", "one"}, fields.Values("Received"))
+}
+
+var headerFieldsTestTable = []struct {
+	block  string
+	names  []string
+	values []string
+}{
+	{"A: 1\nB:2\n\nC: body", []string{"A", "B"}, []string{"1", "2"}},
+	{"A: 1\n  folded\ngarbage\n  dropped\nB: 2", []string{"A", "B"}, []string{"1  folded", "2"}},
+	{" orphan\nA:\n", []string{"A"}, []string{""}},
+	{"A: x=?iso-8859-1?q?=E9?=\r\n\r\n", []string{"A"}, []string{"xé"}},
+}
+
+func TestParseHeaderFields(t *testing.T) {
+	for _, tt := range headerFieldsTestTable {
+		var names, values []string
+		for _, f := range parseHeaderFields([]byte(tt.block), 0, "") {
+			names = append(names, f.Name)
+			values = append(values, f.Value)
+		}
+		assert.Equal(t, tt.names, names, tt.block)
+		assert.Equal(t, tt.values, values, tt.block)
+	}
+}
+
+func TestHeaderFieldsEdit(t *testing.T) {
+	fields := parseHeaderFields([]byte("A: 1\r\nB: 2\r\nA: 3\r\nC: 4\r\n"), 0, "")
+	names := func(h HeaderFields) string {
+		var s []string
+		for _, f := range h {
+			s = append(s, f.Name+"="+f.Value)
+		}
+		return strings.Join(s, " ")
+	}
+	assert.Equal(t, "B=2 C=4", names(fields.Delete("a")))
+	assert.Equal(t, "a=é B=2 C=4", names(fields.Set("a", "é")))
+	assert.Equal(t, "D=5 A=1 B=2 A=3 C=4", names(fields.Prepend("D", "5")))
+	assert.Equal(t, "A=1 B=2 A=3 C=4 D=5", names(fields.Add("D", "5")))
+	assert.Equal(t, "A=1 B=2 A=3 C=4", names(fields), "Edits should not change the original list")
+
+	set := fields.Set("Subject", "Grüße")
+	assert.Equal(t, "Grüße", set.Get("subject"))
+	assert.Equal(t, " =?UTF-8?B?R3LDvMOfZQ==?=", set[len(set)-1].Raw)
+	assert.Equal(t, -1, set[len(set)-1].Offset)
+}
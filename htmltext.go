@@ -0,0 +1,506 @@
+package enmime
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// TableStyle selects how HTMLToText renders tables.
+type TableStyle int
+
+const (
+	// TableBlocks renders each cell as its own paragraph, which suits the
+	// layout tables of most HTML mail.
+	TableBlocks TableStyle = iota
+	// TableRows renders each row on one line, cells separated by " | ".
+	TableRows
+	// TableGrid renders data tables as a grid of aligned columns.
+	TableGrid
+)
+
+// HTMLTextOptions controls how HTMLToText converts HTML to plain text.
+type HTMLTextOptions struct {
+	// LinkFootnotes writes links as "text [1]" and lists their URLs at the
+	// end, instead of writing "text (URL)" inline.
+	LinkFootnotes bool
+	// Tables selects how tables are rendered.
+	Tables TableStyle
+	// ImageAltText writes the alt text of images as "[alt]".
+	ImageAltText bool
+	// Width wraps lines longer than Width characters at spaces.  Zero does
+	// not wrap.
+	Width int
+	// RemoveHidden drops elements hidden by the hidden or aria-hidden
+	// attributes, or by display:none or visibility:hidden styles.
+	RemoveHidden bool
+	// RemovePreheader drops the preheader, the preview text that mailing
+	// tools put at the top of the body, recognized by a class or id holding
+	// "preheader" or "preview", or by an mso-hide:all style.
+	RemovePreheader bool
+}
+
+var (
+	hiddenStyleRegexp    = regexp.MustCompile(`(?i)(^|;)\s*(display\s*:\s*none|visibility\s*:\s*hidden)\b`)
+	preheaderStyleRegexp = regexp.MustCompile(`(?i)mso-hide\s*:\s*all`)
+	preheaderNameRegexp  = regexp.MustCompile(`(?i)preheader|preview`)
+	htmlSpaceRegexp      = regexp.MustCompile(`\s+`)
+)
+
+// Elements dropped with their content
+var htmlTextDropElements = map[atom.Atom]bool{
+	atom.Head:     true,
+	atom.Script:   true,
+	atom.Style:    true,
+	atom.Title:    true,
+	atom.Template: true,
+}
+
+// Elements rendered as paragraphs, separated by empty lines
+var htmlTextParagraphElements = map[atom.Atom]bool{
+	atom.P:  true,
+	atom.H1: true,
+	atom.H2: true,
+	atom.H3: true,
+	atom.H4: true,
+	atom.H5: true,
+	atom.H6: true,
+	atom.Dl: true,
+}
+
+// Elements starting a new line
+var htmlTextBlockElements = map[atom.Atom]bool{
+	atom.Div:        true,
+	atom.Li:         true,
+	atom.Tr:         true,
+	atom.Td:         true,
+	atom.Th:         true,
+	atom.Dt:         true,
+	atom.Dd:         true,
+	atom.Section:    true,
+	atom.Article:    true,
+	atom.Header:     true,
+	atom.Footer:     true,
+	atom.Nav:        true,
+	atom.Aside:      true,
+	atom.Main:       true,
+	atom.Center:     true,
+	atom.Address:    true,
+	atom.Figure:     true,
+	atom.Figcaption: true,
+	atom.Form:       true,
+	atom.Fieldset:   true,
+	atom.Caption:    true,
+}
+
+// HTMLToText converts an HTML document to plain text.  Paragraphs, headings,
+// lists and quotes are separated by empty lines, list items are marked with
+// "* " or their number and quotes with "> ".  A nil opts is the same as the
+// zero HTMLTextOptions.
+func HTMLToText(doc string, opts *HTMLTextOptions) (string, error) {
+	if opts == nil {
+		opts = &HTMLTextOptions{}
+	}
+	root, err := html.Parse(strings.NewReader(doc))
+	if err != nil {
+		return "", err
+	}
+	c := &textConverter{opts: opts, links: new([]string)}
+	c.render(root)
+	c.flush()
+	text := strings.Join(c.lines, "\n")
+	if opts.LinkFootnotes && len(*c.links) > 0 {
+		text += "\n"
+		for i, url := range *c.links {
+			text += fmt.Sprintf("\n[%d] %s", i+1, url)
+		}
+	}
+	return text, nil
+}
+
+// textConverter writes the text of HTML nodes as lines.
+type textConverter struct {
+	opts   *HTMLTextOptions
+	lines  []string
+	inline strings.Builder // Text of the current line
+	marks  []textMark      // Prefixes of the current line
+	blank  bool            // An empty line goes before the next line
+	start  int             // Index of the first line of the current quote
+	links  *[]string       // Footnote URLs, shared with converters of cells
+}
+
+// textMark is a prefix of the lines inside a list item or a quote.
+type textMark struct {
+	first, rest string
+}
+
+// prefix returns the prefix of the next line, using up the first line marks.
+func (c *textConverter) prefix() string {
+	var b strings.Builder
+	for i := range c.marks {
+		b.WriteString(c.marks[i].first)
+		c.marks[i].first = c.marks[i].rest
+	}
+	return b.String()
+}
+
+// emptyPrefix returns the prefix of an empty line, the quote marks.
+func (c *textConverter) emptyPrefix() string {
+	var b strings.Builder
+	for _, m := range c.marks {
+		if strings.HasPrefix(m.rest, ">") {
+			b.WriteString(">")
+		}
+	}
+	return b.String()
+}
+
+// addLine appends a line, after the pending empty line.
+func (c *textConverter) addLine(line string) {
+	if c.blank && len(c.lines) > c.start {
+		c.lines = append(c.lines, c.emptyPrefix())
+	}
+	c.blank = false
+	prefix := c.prefix()
+	c.lines = append(c.lines, strings.TrimRight(prefix+line, " "))
+}
+
+// flush ends the current line, wrapping it.
+func (c *textConverter) flush() {
+	text := strings.TrimSpace(htmlSpaceRegexp.ReplaceAllString(c.inline.String(), " "))
+	c.inline.Reset()
+	if text == "" {
+		return
+	}
+	width := c.opts.Width
+	if width > 0 {
+		width -= prefixLen(c.marks)
+	}
+	for _, l := range wrapWords(text, width) {
+		c.addLine(l)
+	}
+}
+
+// paragraph ends the current line and the paragraph.
+func (c *textConverter) paragraph() {
+	c.flush()
+	c.blank = true
+}
+
+func prefixLen(marks []textMark) int {
+	n := 0
+	for _, m := range marks {
+		n += utf8.RuneCountInString(m.rest)
+	}
+	return n
+}
+
+func (c *textConverter) render(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		c.inline.WriteString(n.Data)
+		return
+	case html.ElementNode:
+	default:
+		c.renderChildren(n)
+		return
+	}
+	if htmlTextDropElements[n.DataAtom] ||
+		(c.opts.RemoveHidden && isHiddenElement(n)) ||
+		(c.opts.RemovePreheader && isPreheader(n)) {
+		return
+	}
+
+	switch n.DataAtom {
+	case atom.Br:
+		c.flush()
+	case atom.Hr:
+		c.paragraph()
+		c.addLine("--------")
+		c.blank = true
+	case atom.Img:
+		if alt := strings.TrimSpace(htmlAttr(n, "alt")); alt != "" && c.opts.ImageAltText {
+			c.inline.WriteString("[" + alt + "]")
+		}
+	case atom.A:
+		c.renderLink(n)
+	case atom.Pre:
+		c.paragraph()
+		text := strings.TrimSuffix(strings.TrimPrefix(preText(n), "\n"), "\n")
+		for _, l := range strings.Split(text, "\n") {
+			c.addLine(l)
+		}
+		c.blank = true
+	case atom.Blockquote:
+		c.paragraph()
+		if c.blank && len(c.lines) > 0 {
+			// The empty line above is outside of the quote
+			c.lines = append(c.lines, c.emptyPrefix())
+			c.blank = false
+		}
+		start := c.start
+		c.start = len(c.lines)
+		c.marks = append(c.marks, textMark{"> ", "> "})
+		c.renderChildren(n)
+		c.paragraph()
+		c.marks = c.marks[:len(c.marks)-1]
+		c.start = start
+	case atom.Ul, atom.Ol:
+		c.renderList(n)
+	case atom.Table:
+		c.renderTable(n)
+	default:
+		switch {
+		case htmlTextParagraphElements[n.DataAtom]:
+			c.paragraph()
+			c.renderChildren(n)
+			c.paragraph()
+		case htmlTextBlockElements[n.DataAtom]:
+			c.flush()
+			c.renderChildren(n)
+			c.flush()
+		default:
+			c.renderChildren(n)
+		}
+	}
+}
+
+func (c *textConverter) renderChildren(n *html.Node) {
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		c.render(child)
+	}
+}
+
+// renderLink writes the text of a link with its URL inline, or with the
+// number of its footnote.
+func (c *textConverter) renderLink(n *html.Node) {
+	start := c.inline.Len()
+	c.renderChildren(n)
+	if c.inline.Len() < start {
+		// The link held blocks, its text is not on this line anymore
+		start = 0
+	}
+	text := strings.TrimSpace(c.inline.String()[start:])
+	href := strings.TrimSpace(htmlAttr(n, "href"))
+	lower := strings.ToLower(href)
+	if href == "" || strings.HasPrefix(lower, "#") || strings.HasPrefix(lower, "javascript:") {
+		return
+	}
+	if text == "" {
+		text = href
+		c.inline.WriteString(href)
+	}
+	if text == href || "mailto:"+text == href || "tel:"+text == href {
+		return
+	}
+	if c.opts.LinkFootnotes {
+		*c.links = append(*c.links, href)
+		c.inline.WriteString(" [" + strconv.Itoa(len(*c.links)) + "]")
+		return
+	}
+	c.inline.WriteString(" (" + href + ")")
+}
+
+// renderList writes the items of a list with their markers, numbered from
+// the start attribute of an ol element.
+func (c *textConverter) renderList(n *html.Node) {
+	c.paragraph()
+	number := 1
+	if s, err := strconv.Atoi(htmlAttr(n, "start")); err == nil {
+		number = s
+	}
+	for item := n.FirstChild; item != nil; item = item.NextSibling {
+		if item.Type != html.ElementNode || item.DataAtom != atom.Li {
+			c.render(item)
+			continue
+		}
+		if c.opts.RemoveHidden && isHiddenElement(item) {
+			continue
+		}
+		marker := "* "
+		if n.DataAtom == atom.Ol {
+			if v, err := strconv.Atoi(htmlAttr(item, "value")); err == nil {
+				number = v
+			}
+			marker = strconv.Itoa(number) + ". "
+			number++
+		}
+		c.flush()
+		c.marks = append(c.marks, textMark{marker, strings.Repeat(" ", len(marker))})
+		c.renderChildren(item)
+		c.flush()
+		c.marks = c.marks[:len(c.marks)-1]
+	}
+	c.paragraph()
+}
+
+// renderTable writes a table in the style of the options.
+func (c *textConverter) renderTable(n *html.Node) {
+	if c.opts.Tables == TableBlocks {
+		c.paragraph()
+		c.renderChildren(n)
+		c.paragraph()
+		return
+	}
+	rows := c.tableRows(n)
+	c.paragraph()
+	if c.opts.Tables == TableRows {
+		for _, row := range rows {
+			c.addLine(strings.Join(row, " | "))
+		}
+		c.paragraph()
+		return
+	}
+
+	var widths []int
+	for _, row := range rows {
+		for i, cell := range row {
+			if i == len(widths) {
+				widths = append(widths, 0)
+			}
+			if w := utf8.RuneCountInString(cell); w > widths[i] {
+				widths[i] = w
+			}
+		}
+	}
+	rule := "+"
+	for _, w := range widths {
+		rule += strings.Repeat("-", w+2) + "+"
+	}
+	c.addLine(rule)
+	for _, row := range rows {
+		line := "|"
+		for i, w := range widths {
+			cell := ""
+			if i < len(row) {
+				cell = row[i]
+			}
+			line += " " + cell + strings.Repeat(" ", w-utf8.RuneCountInString(cell)) + " |"
+		}
+		c.addLine(line)
+		c.addLine(rule)
+	}
+	c.paragraph()
+}
+
+// tableRows returns the text of the cells of the rows of a table, leaving
+// out nested tables' own rows.
+func (c *textConverter) tableRows(table *html.Node) [][]string {
+	var rows [][]string
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			if child.Type != html.ElementNode {
+				continue
+			}
+			if c.opts.RemoveHidden && isHiddenElement(child) {
+				continue
+			}
+			switch child.DataAtom {
+			case atom.Tr:
+				var row []string
+				for cell := child.FirstChild; cell != nil; cell = cell.NextSibling {
+					if cell.Type == html.ElementNode && (cell.DataAtom == atom.Td || cell.DataAtom == atom.Th) {
+						row = append(row, c.cellText(cell))
+					}
+				}
+				rows = append(rows, row)
+			case atom.Thead, atom.Tbody, atom.Tfoot:
+				walk(child)
+			}
+		}
+	}
+	walk(table)
+	return rows
+}
+
+// cellText returns the text of a table cell on one line.
+func (c *textConverter) cellText(cell *html.Node) string {
+	opts := *c.opts
+	opts.Width = 0
+	sub := &textConverter{opts: &opts, links: c.links}
+	sub.renderChildren(cell)
+	sub.flush()
+	var parts []string
+	for _, l := range sub.lines {
+		if l = strings.TrimSpace(l); l != "" {
+			parts = append(parts, l)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// preText returns the text inside a pre element as it is.
+func preText(n *html.Node) string {
+	var b strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			switch {
+			case child.Type == html.TextNode:
+				b.WriteString(child.Data)
+			case child.Type == html.ElementNode && child.DataAtom == atom.Br:
+				b.WriteString("\n")
+			default:
+				walk(child)
+			}
+		}
+	}
+	walk(n)
+	return strings.Replace(b.String(), "\r\n", "\n", -1)
+}
+
+// wrapWords splits text into lines of at most width characters, breaking at
+// spaces.  Words longer than width get a line of their own.
+func wrapWords(text string, width int) []string {
+	if width <= 0 {
+		return []string{text}
+	}
+	var lines []string
+	line, n := "", 0
+	for _, w := range strings.Split(text, " ") {
+		wn := utf8.RuneCountInString(w)
+		if n > 0 && n+1+wn > width {
+			lines = append(lines, line)
+			line, n = "", 0
+		}
+		if n > 0 {
+			line += " "
+			n++
+		}
+		line += w
+		n += wn
+	}
+	return append(lines, line)
+}
+
+// isHiddenElement tells whether n is hidden by its attributes or style.
+func isHiddenElement(n *html.Node) bool {
+	for _, a := range n.Attr {
+		switch a.Key {
+		case "hidden":
+			return true
+		case "aria-hidden":
+			if strings.EqualFold(a.Val, "true") {
+				return true
+			}
+		case "style":
+			if hiddenStyleRegexp.MatchString(a.Val) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isPreheader tells whether n holds the preview text of a mailing.
+func isPreheader(n *html.Node) bool {
+	return preheaderNameRegexp.MatchString(htmlAttr(n, "class")) ||
+		preheaderNameRegexp.MatchString(htmlAttr(n, "id")) ||
+		preheaderStyleRegexp.MatchString(htmlAttr(n, "style"))
+}
@@ -0,0 +1,139 @@
+package enmime
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var htmlToTextTestTable = []struct {
+	name string
+	html string
+	opts HTMLTextOptions
+	want string
+}{
+	{
+		"paragraphs",
+		"<html><head><title>T</title><style>p{}</style></head><body>" +
+			"<h1>Title</h1><p>One\n  <b>two</b></p><div>Three<br>Four</div></body></html>",
+		HTMLTextOptions{},
+		"Title\n\nOne two\n\nThree\nFour",
+	},
+	{
+		"lists",
+		`<ol start="3"><li>Three</li><li>Four<ul><li>Nested</li></ul></li></ol><p>After</p>`,
+		HTMLTextOptions{},
+		"3. Three\n4. Four\n\n   * Nested\n\nAfter",
+	},
+	{
+		"quote",
+		"<p>Reply</p><blockquote><p>Quoted</p><p>Text</p></blockquote>",
+		HTMLTextOptions{},
+		"Reply\n\n> Quoted\n>\n> Text",
+	},
+	{
+		"inline links",
+		`<p><a href="https://example.com/a">Site</a>, <a href="https://example.com/">https://example.com/</a>, ` +
+			`<a href="mailto:bob@example.com">bob@example.com</a> and <a href="#top">top</a></p>`,
+		HTMLTextOptions{},
+		"Site (https://example.com/a), https://example.com/, bob@example.com and top",
+	},
+	{
+		"link footnotes",
+		`<p><a href="https://example.com/a">Site</a> and <a href="https://example.com/b">other</a></p>`,
+		HTMLTextOptions{LinkFootnotes: true},
+		"Site [1] and other [2]\n\n[1] https://example.com/a\n[2] https://example.com/b",
+	},
+	{
+		"images",
+		`<p><img src="logo.png" alt="Logo"> Hi<img src="pixel.gif"></p>`,
+		HTMLTextOptions{ImageAltText: true},
+		"[Logo] Hi",
+	},
+	{
+		"images without alt text",
+		`<p><img src="logo.png" alt="Logo"> Hi</p>`,
+		HTMLTextOptions{},
+		"Hi",
+	},
+	{
+		"width",
+		"<p>The quick brown fox jumps over the lazy dog</p><blockquote>The quick brown fox</blockquote>",
+		HTMLTextOptions{Width: 16},
+		"The quick brown\nfox jumps over\nthe lazy dog\n\n> The quick\n> brown fox",
+	},
+	{
+		"hidden",
+		`<p hidden>A</p><p style="color:red; display: none">B</p><span aria-hidden="true">C</span><p>D</p>`,
+		HTMLTextOptions{RemoveHidden: true},
+		"D",
+	},
+	{
+		"hidden kept",
+		`<p style="display:none">A</p><p>D</p>`,
+		HTMLTextOptions{},
+		"A\n\nD",
+	},
+	{
+		"preheader",
+		`<div class="preheader">Don't miss our sale</div><span style="mso-hide:all">x</span><p>Sale</p>`,
+		HTMLTextOptions{RemovePreheader: true},
+		"Sale",
+	},
+	{
+		"layout table",
+		"<table><tr><td>Left</td><td>Right</td></tr></table>",
+		HTMLTextOptions{},
+		"Left\nRight",
+	},
+	{
+		"table rows",
+		"<table><tr><th>Item</th><th>Price</th></tr><tr><td>Tea</td><td><b>2</b> €</td></tr></table>",
+		HTMLTextOptions{Tables: TableRows},
+		"Item | Price\nTea | 2 €",
+	},
+	{
+		"table grid",
+		"<p>Bill</p><table><thead><tr><th>Item</th><th>Price</th></tr></thead>" +
+			"<tbody><tr><td>Tea</td><td>2 €</td></tr><tr><td>Coffee</td></tr></tbody></table>",
+		HTMLTextOptions{Tables: TableGrid},
+		"Bill\n\n+--------+-------+\n| Item   | Price |\n+--------+-------+\n| Tea    | 2 €   |\n" +
+			"+--------+-------+\n| Coffee |       |\n+--------+-------+",
+	},
+	{
+		"pre",
+		"<p>Code:</p><pre>\nif a {\n    b()\n}</pre><p>End</p>",
+		HTMLTextOptions{Width: 5},
+		"Code:\n\nif a {\n    b()\n}\n\nEnd",
+	},
+}
+
+func TestHTMLToText(t *testing.T) {
+	for _, tt := range htmlToTextTestTable {
+		opts := tt.opts
+		got, err := HTMLToText(tt.html, &opts)
+		if assert.Nil(t, err, tt.name) {
+			assert.Equal(t, tt.want, got, tt.name)
+		}
+	}
+}
+
+func TestParseHTMLTextOptions(t *testing.T) {
+	const message = "Content-Type: text/html\r\n\r\n" +
+		`<div class="preheader">Preview</div><p>Hello <a href="https://example.com/">you</a></p>`
+	m, err := ReadMIMEBodyWithOptions(strings.NewReader(message), &ParseOptions{
+		HTMLText: &HTMLTextOptions{LinkFootnotes: true, RemovePreheader: true},
+	})
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+	assert.True(t, m.IsTextFromHTML)
+	assert.Equal(t, "Hello you [1]\n\n[1] https://example.com/", m.Text)
+
+	m, err = ReadMIMEBody(strings.NewReader(message))
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+	assert.Contains(t, m.Text, "Preview")
+}
@@ -0,0 +1,396 @@
+package enmime
+
+//go:generate go run cns11643_gen.go
+
+import (
+	"sync"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/transform"
+)
+
+// The 7-bit encodings of RFC 1557 (ISO-2022-KR) and RFC 1922 (ISO-2022-CN and
+// ISO-2022-CN-EXT).  Both designate a double byte character set to G1 with an
+// escape sequence and switch between ASCII and G1 with SO and SI.  ISO-2022-CN
+// also reaches CNS 11643 plane 2 through G2 with the single shift SS2, and
+// ISO-2022-CN-EXT planes 3 to 7 through G3 with SS3.
+var (
+	iso2022KR    encoding.Encoding = &iso2022{name: "ISO-2022-KR"}
+	iso2022CN    encoding.Encoding = &iso2022{name: "ISO-2022-CN", cn: true}
+	iso2022CNExt encoding.Encoding = &iso2022{name: "ISO-2022-CN-EXT", cn: true, ext: true}
+)
+
+const (
+	iso2022ESC = 0x1b
+	iso2022SO  = 0x0e
+	iso2022SI  = 0x0f
+)
+
+// Final bytes of the designation sequences
+const (
+	setNone    = 0
+	setKSC5601 = 'C' // ESC $ ) C
+	setGB2312  = 'A' // ESC $ ) A
+	setISOIR   = 'E' // ESC $ ) E, ISO-IR-165, a superset of GB 2312
+	setCNS1    = 'G' // ESC $ ) G
+	setCNS2    = 'H' // ESC $ * H
+	setCNS3    = 'I' // ESC $ + I, up to plane 7 at ESC $ + M
+	setCNS7    = 'M'
+)
+
+type iso2022 struct {
+	name string
+	cn   bool
+	ext  bool // CNS 11643 planes 3 to 7
+}
+
+func (e *iso2022) NewDecoder() *encoding.Decoder {
+	return &encoding.Decoder{Transformer: &iso2022Decoder{cn: e.cn, ext: e.ext}}
+}
+
+func (e *iso2022) NewEncoder() *encoding.Encoder {
+	return &encoding.Encoder{Transformer: &iso2022Encoder{cn: e.cn, ext: e.ext}}
+}
+
+func (e *iso2022) String() string { return e.name }
+
+var (
+	cnsOnce    sync.Once
+	cnsRunes   [len(cns11643Planes)][]rune
+	cnsReverse map[rune]uint32 // plane<<16 | row<<8 | col
+)
+
+func loadCNS11643() {
+	cnsOnce.Do(func() {
+		cnsReverse = make(map[rune]uint32)
+		for p, s := range cns11643Planes {
+			cnsRunes[p] = []rune(s)
+			for i, r := range cnsRunes[p] {
+				if r == utf8.RuneError {
+					continue
+				}
+				if _, ok := cnsReverse[r]; !ok {
+					cnsReverse[r] = uint32(p+1)<<16 | uint32(i/94+0x21)<<8 | uint32(i%94+0x21)
+				}
+			}
+		}
+	})
+}
+
+// cnsRune returns the rune of a CNS 11643 character of plane 1 to 7.
+func cnsRune(plane int, b1, b2 byte) rune {
+	loadCNS11643()
+	return cnsRunes[plane-1][int(b1-0x21)*94+int(b2-0x21)]
+}
+
+// eucRune decodes a GB 2312 or KS X 1001 character with the EUC decoder t.
+func eucRune(t transform.Transformer, b1, b2 byte) rune {
+	var buf [utf8.UTFMax]byte
+	t.Reset()
+	n, _, err := t.Transform(buf[:], []byte{b1 | 0x80, b2 | 0x80}, true)
+	if err != nil {
+		return utf8.RuneError
+	}
+	r, size := utf8.DecodeRune(buf[:n])
+	if size != n {
+		return utf8.RuneError
+	}
+	return r
+}
+
+func isGraphic94(c byte) bool { return c > 0x20 && c < 0x7f }
+
+type iso2022Decoder struct {
+	cn      bool
+	ext     bool
+	g1      byte // charset designated to G1, invoked by SO
+	g2      byte // charset designated to G2, invoked by SS2
+	g3      byte // charset designated to G3, invoked by SS3
+	shifted bool
+	euc     transform.Transformer
+}
+
+func (d *iso2022Decoder) Reset() {
+	d.g1, d.g2, d.g3 = setNone, setNone, setNone
+	d.shifted = false
+}
+
+// decode94x94 returns the rune of the double byte character b1 b2 of charset
+// set.
+func (d *iso2022Decoder) decode94x94(set, b1, b2 byte) rune {
+	if !isGraphic94(b1) || !isGraphic94(b2) {
+		return utf8.RuneError
+	}
+	switch set {
+	case setKSC5601:
+		if d.euc == nil {
+			d.euc = korean.EUCKR.NewDecoder()
+		}
+		return eucRune(d.euc, b1, b2)
+	case setGB2312, setISOIR:
+		if d.euc == nil {
+			d.euc = simplifiedchinese.GBK.NewDecoder()
+		}
+		return eucRune(d.euc, b1, b2)
+	case setCNS1:
+		return cnsRune(1, b1, b2)
+	case setCNS2:
+		return cnsRune(2, b1, b2)
+	}
+	if set >= setCNS3 && set <= setCNS7 {
+		return cnsRune(int(set-setCNS3)+3, b1, b2)
+	}
+	return utf8.RuneError
+}
+
+func (d *iso2022Decoder) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error) {
+	for nSrc < len(src) {
+		c := src[nSrc]
+		r, size := rune(c), 1
+		switch {
+		case c == iso2022ESC:
+			size, r = d.escape(src[nSrc:])
+			if size == 0 {
+				if !atEOF {
+					return nDst, nSrc, transform.ErrShortSrc
+				}
+				size, r = len(src)-nSrc, utf8.RuneError
+			}
+		case c == iso2022SO:
+			if d.g1 != setNone {
+				d.shifted = true
+				nSrc++
+				continue
+			}
+			r = utf8.RuneError
+		case c == iso2022SI:
+			d.shifted = false
+			nSrc++
+			continue
+		case c == '\n' || c == '\r':
+			// Every line starts in ASCII
+			d.shifted = false
+		case c >= 0x80:
+			r = utf8.RuneError
+		case d.shifted && isGraphic94(c):
+			if nSrc+1 >= len(src) {
+				if !atEOF {
+					return nDst, nSrc, transform.ErrShortSrc
+				}
+				r = utf8.RuneError
+				break
+			}
+			r, size = d.decode94x94(d.g1, c, src[nSrc+1]), 2
+		}
+
+		if r < 0 {
+			// A designation, nothing to write
+			nSrc += size
+			continue
+		}
+		if nDst+utf8.RuneLen(r) > len(dst) {
+			return nDst, nSrc, transform.ErrShortDst
+		}
+		nDst += utf8.EncodeRune(dst[nDst:], r)
+		nSrc += size
+	}
+	return nDst, nSrc, nil
+}
+
+// escape handles the escape sequence at the start of src.  It returns the size
+// of the sequence and either the rune it stands for, or -1 if it only changed
+// the designations.  A zero size means src holds an incomplete sequence.
+func (d *iso2022Decoder) escape(src []byte) (int, rune) {
+	if len(src) < 2 {
+		return 0, 0
+	}
+	switch src[1] {
+	case '$':
+		if len(src) < 4 {
+			return 0, 0
+		}
+		switch {
+		case src[2] == ')' && src[3] == setKSC5601 && !d.cn,
+			src[2] == ')' && d.cn && (src[3] == setGB2312 || src[3] == setISOIR || src[3] == setCNS1):
+			d.g1 = src[3]
+			return 4, -1
+		case src[2] == '*' && src[3] == setCNS2 && d.cn:
+			d.g2 = src[3]
+			return 4, -1
+		case src[2] == '+' && src[3] >= setCNS3 && src[3] <= setCNS7 && d.ext:
+			d.g3 = src[3]
+			return 4, -1
+		}
+	case 'N', 'O':
+		if !d.cn {
+			break
+		}
+		if len(src) < 4 {
+			return 0, 0
+		}
+		set := d.g2
+		if src[1] == 'O' {
+			set = d.g3
+		}
+		if set == setNone {
+			break
+		}
+		return 4, d.decode94x94(set, src[2], src[3])
+	}
+	// Unknown or misplaced sequence, drop the escape character
+	return 1, utf8.RuneError
+}
+
+type iso2022Encoder struct {
+	cn      bool
+	ext     bool
+	started bool
+	g1      byte
+	g2      byte
+	g3      byte
+	shifted bool
+	euc     transform.Transformer
+}
+
+func (e *iso2022Encoder) Reset() {
+	e.started = false
+	e.g1, e.g2, e.g3 = setNone, setNone, setNone
+	e.shifted = false
+}
+
+// encode94x94 returns the charset and the 7-bit bytes of rune r, or setNone if
+// the encoding cannot represent r.  GB 2312 is preferred over CNS 11643 plane
+// 1, unless plane 1 is already designated and holds r.
+func (e *iso2022Encoder) encode94x94(r rune, g1 byte) (set, b1, b2 byte) {
+	if g1 == setCNS1 {
+		loadCNS11643()
+		if c, ok := cnsReverse[r]; ok && c>>16 == 1 {
+			return setCNS1, byte(c >> 8), byte(c)
+		}
+	}
+	if e.euc == nil {
+		if e.cn {
+			e.euc = simplifiedchinese.GBK.NewEncoder()
+		} else {
+			e.euc = korean.EUCKR.NewEncoder()
+		}
+	}
+	var buf [4]byte
+	var in [utf8.UTFMax]byte
+	e.euc.Reset()
+	n, _, err := e.euc.Transform(buf[:], in[:utf8.EncodeRune(in[:], r)], true)
+	// Only the 94x94 part of GBK and UHC is GB 2312 and KS X 1001
+	if err == nil && n == 2 && buf[0] > 0xa0 && buf[0] < 0xff && buf[1] > 0xa0 && buf[1] < 0xff {
+		if e.cn {
+			return setGB2312, buf[0] & 0x7f, buf[1] & 0x7f
+		}
+		return setKSC5601, buf[0] & 0x7f, buf[1] & 0x7f
+	}
+	if e.cn {
+		loadCNS11643()
+		if c, ok := cnsReverse[r]; ok {
+			switch plane := c >> 16; {
+			case plane == 1:
+				set = setCNS1
+			case plane == 2:
+				set = setCNS2
+			case e.ext:
+				set = setCNS3 + byte(plane-3)
+			default:
+				return setNone, 0, 0
+			}
+			return set, byte(c >> 8), byte(c)
+		}
+	}
+	return setNone, 0, 0
+}
+
+func (e *iso2022Encoder) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error) {
+	var buf [16]byte
+	for nSrc < len(src) {
+		r, size := rune(src[nSrc]), 1
+		if r >= utf8.RuneSelf {
+			r, size = utf8.DecodeRune(src[nSrc:])
+			if r == utf8.RuneError && size == 1 {
+				if !atEOF && !utf8.FullRune(src[nSrc:]) {
+					return nDst, nSrc, transform.ErrShortSrc
+				}
+			}
+		}
+
+		// Build the output for r with the state it leaves behind, and only
+		// commit both when it fits into dst.
+		out := buf[:0]
+		started, g1, g2, g3, shifted := e.started, e.g1, e.g2, e.g3, e.shifted
+		if !started && !e.cn {
+			// RFC 1557 puts the designation at the start of the text
+			out = append(out, iso2022ESC, '$', ')', setKSC5601)
+			g1 = setKSC5601
+		}
+		started = true
+
+		var unsupported bool
+		if r < utf8.RuneSelf {
+			if shifted {
+				out = append(out, iso2022SI)
+				shifted = false
+			}
+			out = append(out, byte(r))
+			if r == '\n' && e.cn {
+				// RFC 1922 designations only last until the end of the line
+				g1, g2, g3 = setNone, setNone, setNone
+			}
+		} else if set, b1, b2 := e.encode94x94(r, g1); set == setNone || r == utf8.RuneError {
+			unsupported = true
+			if shifted {
+				// The replacement byte is written in ASCII
+				out = append(out, iso2022SI)
+				shifted = false
+			}
+		} else if set == setCNS2 {
+			if g2 != set {
+				out = append(out, iso2022ESC, '$', '*', set)
+				g2 = set
+			}
+			out = append(out, iso2022ESC, 'N', b1, b2)
+		} else if set >= setCNS3 {
+			if g3 != set {
+				out = append(out, iso2022ESC, '$', '+', set)
+				g3 = set
+			}
+			out = append(out, iso2022ESC, 'O', b1, b2)
+		} else {
+			if g1 != set {
+				out = append(out, iso2022ESC, '$', ')', set)
+				g1 = set
+			}
+			if !shifted {
+				out = append(out, iso2022SO)
+				shifted = true
+			}
+			out = append(out, b1, b2)
+		}
+
+		if nDst+len(out) > len(dst) {
+			return nDst, nSrc, transform.ErrShortDst
+		}
+		nDst += copy(dst[nDst:], out)
+		e.started, e.g1, e.g2, e.g3, e.shifted = started, g1, g2, g3, shifted
+		if unsupported {
+			return nDst, nSrc, repertoireError(0x1a)
+		}
+		nSrc += size
+	}
+	if atEOF && e.shifted {
+		if nDst >= len(dst) {
+			return nDst, nSrc, transform.ErrShortDst
+		}
+		dst[nDst] = iso2022SI
+		nDst++
+		e.shifted = false
+	}
+	return nDst, nSrc, nil
+}
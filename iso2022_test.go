@@ -0,0 +1,142 @@
+package enmime
+
+import (
+	"io"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/transform"
+)
+
+func TestISO2022Decode(t *testing.T) {
+	var testTable = []struct {
+		charset string
+		input   string
+		expect  string
+	}{
+		{"iso-2022-kr", "\x1b$)C\x0e>H3gGO<<?d\x0f, \x0e<<0h\x0f!\r\nHello\r\n",
+			"안녕하세요, 세계!\r\nHello\r\n"},
+		{"csISO2022KR", "\x1b$)C\x0e>H3gGO<<?d\x0f", "안녕하세요"},
+		{"iso-2022-cn", "\x1b$)A\x0eDz:C#,8P\x1b$)GuMZ@N{KtOj!$\x0f\r\n\x1b$)A\x0eVPND\x0f test\r\n",
+			"您好，感謝您的來信。\r\n中文 test\r\n"},
+		{"iso-2022-cn", "a\x1b$*H\x1bN!!\x0fb", "a乂b"},
+		{"iso-2022-cn", "\x1b$)G\x0eG#Ho\x0f", "丟佇"},
+		{"iso-2022-cn-ext", "\x1b$)E\x0eVPND\x0f", "中文"},
+		{"iso-2022-cn-ext", "\x1b$+I\x1bO!!x", "丨x"},
+		{"iso-2022-cn-ext", "\x1b$+J\x1bO!!\x1b$+M\x1bO!!\x0f", "𠂆𠁕"},
+		// SO without designation, line ends return to ASCII
+		{"iso-2022-kr", "\x0eab", "�ab"},
+		{"iso-2022-kr", "\x1b$)C\x0e>H\nab", "안\nab"},
+		// 8-bit bytes are invalid in a 7-bit encoding
+		{"iso-2022-kr", "a\xb0\xa1b", "a��b"},
+	}
+
+	for _, tt := range testTable {
+		result, err := ConvertToUTF8String(tt.charset, []byte(tt.input))
+		assert.Nil(t, err, "Charset %v", tt.charset)
+		assert.Equal(t, tt.expect, result, "Charset %v, input %q", tt.charset, tt.input)
+	}
+}
+
+func TestISO2022DecodeShortBuffers(t *testing.T) {
+	input := "\x1b$)A\x0eDz:C#,8P\x1b$)GuMZ@N{KtOj!$\x0f\r\n\x1b$*H\x1bN!!"
+	expect := "您好，感謝您的來信。\r\n乂"
+	// Feeding a byte at a time must not split escapes or characters
+	r := transform.NewReader(&oneByteReader{s: input}, iso2022CN.NewDecoder())
+	var out []byte
+	buf := make([]byte, 3)
+	for {
+		n, err := r.Read(buf)
+		out = append(out, buf[:n]...)
+		if err != nil {
+			break
+		}
+	}
+	assert.Equal(t, expect, string(out))
+
+	// A truncated character at the end of the text is replaced
+	result, err := ConvertToUTF8String("iso-2022-kr", []byte("\x1b$)C\x0e>H3"))
+	assert.Nil(t, err)
+	assert.Equal(t, "안�", result)
+}
+
+type oneByteReader struct {
+	s string
+	i int
+}
+
+func (r *oneByteReader) Read(p []byte) (int, error) {
+	if r.i >= len(r.s) {
+		return 0, io.EOF
+	}
+	p[0] = r.s[r.i]
+	r.i++
+	return 1, nil
+}
+
+func TestISO2022Encode(t *testing.T) {
+	var testTable = []struct {
+		e      encoding.Encoding
+		input  string
+		expect string
+	}{
+		{iso2022KR, "안녕하세요, 세계!\r\nHello\r\n",
+			"\x1b$)C\x0e>H3gGO<<?d\x0f, \x0e<<0h\x0f!\r\nHello\r\n"},
+		{iso2022KR, "Hello", "\x1b$)CHello"},
+		{iso2022CN, "您好，感謝您的來信。\r\n中文 test\r\n",
+			"\x1b$)A\x0eDz:C#,8P\x1b$)GuMZ@N{KtOj!$\x0f\r\n\x1b$)A\x0eVPND\x0f test\r\n"},
+		{iso2022CN, "a乂b", "a\x1b$*H\x1bN!!b"},
+		{iso2022CN, "中", "\x1b$)A\x0eVP\x0f"},
+		{iso2022CNExt, "a𠂆𠂆\n中𠂆", "a\x1b$+J\x1bO!!\x1bO!!\n\x1b$)A\x0eVP\x1b$+J\x1bO!!\x0f"},
+	}
+
+	for _, tt := range testTable {
+		result, err := tt.e.NewEncoder().String(tt.input)
+		assert.Nil(t, err, "Encoding %v", tt.e)
+		assert.Equal(t, tt.expect, result, "Encoding %v, input %q", tt.e, tt.input)
+		decoded, err := tt.e.NewDecoder().String(result)
+		assert.Nil(t, err)
+		assert.Equal(t, tt.input, decoded)
+	}
+
+	// Runes outside the repertoire
+	_, err := iso2022KR.NewEncoder().String("中文 😀")
+	assert.NotNil(t, err)
+	_, err = iso2022CN.NewEncoder().String("𠂆")
+	assert.NotNil(t, err, "Plane 4 needs ISO-2022-CN-EXT")
+	result, err := encoding.ReplaceUnsupported(iso2022KR.NewEncoder()).String("안😀녕")
+	assert.Nil(t, err)
+	assert.Equal(t, "\x1b$)C\x0e>H\x0f\x1a\x0e3g\x0f", result)
+}
+
+func TestCNS11643Planes(t *testing.T) {
+	var testTable = []struct {
+		plane  int
+		b1, b2 byte
+		expect rune
+	}{
+		{1, 0x21, 0x21, '\u3000'},
+		{1, 0x44, 0x21, '一'},
+		{2, 0x21, 0x21, '乂'},
+		{2, 0x72, 0x44, '龘'},
+		{2, 0x72, 0x45, utf8.RuneError},
+		{2, 0x73, 0x21, utf8.RuneError},
+		{2, 0x7e, 0x7e, utf8.RuneError},
+		{3, 0x21, 0x21, '丨'},
+		{4, 0x21, 0x21, '𠂆'},
+		{7, 0x21, 0x21, '𠁕'},
+	}
+
+	for _, tt := range testTable {
+		assert.Equal(t, tt.expect, cnsRune(tt.plane, tt.b1, tt.b2),
+			"Plane %d, cell %02X%02X", tt.plane, tt.b1, tt.b2)
+	}
+}
+
+func TestDetectISO2022(t *testing.T) {
+	assert.Equal(t, "iso-2022-kr", detectCharset([]byte("\x1b$)C\x0e>H3gGO<<?d\x0f")))
+	assert.Equal(t, "iso-2022-cn", detectCharset([]byte("\x1b$)A\x0eVPND\x0f")))
+	assert.Equal(t, "iso-2022-cn-ext", detectCharset([]byte("\x1b$+I\x1bO!!")))
+}
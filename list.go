@@ -0,0 +1,119 @@
+package enmime
+
+import (
+	"strings"
+)
+
+// MailingList holds the mailing list headers of a message, defined by RFC 2369,
+// RFC 2919, RFC 5064 and RFC 8058.
+type MailingList struct {
+	ID                string   // List-Id identifier, like list.example.com
+	Description       string   // List-Id display name
+	UnsubscribeMailto []string // mailto: URIs of List-Unsubscribe
+	UnsubscribeHTTP   []string // https: and http: URIs of List-Unsubscribe
+	OneClick          bool     // RFC 8058 one-click unsubscription is offered
+	Post              []string // List-Post URIs
+	PostingAllowed    bool     // False if List-Post is NO
+	Subscribe         []string // List-Subscribe URIs
+	Help              []string // List-Help URIs
+	Owner             []string // List-Owner URIs
+	Archive           []string // List-Archive URIs
+	ArchivedAt        []string // Archived-At URIs of this very message
+}
+
+// MailingList returns the mailing list headers of the message, or nil if it
+// has none.
+func (m *MIMEBody) MailingList() *MailingList {
+	found := false
+	get := func(key string) string {
+		v := m.header.Get(key)
+		if v != "" {
+			found = true
+		}
+		return v
+	}
+
+	l := &MailingList{PostingAllowed: true}
+	l.ID, l.Description = ParseListID(get("List-Id"))
+	for _, uri := range ParseListURIs(get("List-Unsubscribe")) {
+		switch urlScheme(uri) {
+		case "mailto":
+			l.UnsubscribeMailto = append(l.UnsubscribeMailto, uri)
+		case "http", "https":
+			l.UnsubscribeHTTP = append(l.UnsubscribeHTTP, uri)
+		}
+	}
+	if strings.EqualFold(strings.TrimSpace(get("List-Unsubscribe-Post")), "List-Unsubscribe=One-Click") {
+		// RFC 8058 requires an HTTPS URI to post to
+		for _, uri := range l.UnsubscribeHTTP {
+			if urlScheme(uri) == "https" {
+				l.OneClick = true
+				break
+			}
+		}
+	}
+	post := get("List-Post")
+	if strings.EqualFold(strings.TrimSpace(stripComments(post)), "NO") {
+		l.PostingAllowed = false
+	} else {
+		l.Post = ParseListURIs(post)
+	}
+	l.Subscribe = ParseListURIs(get("List-Subscribe"))
+	l.Help = ParseListURIs(get("List-Help"))
+	l.Owner = ParseListURIs(get("List-Owner"))
+	l.Archive = ParseListURIs(get("List-Archive"))
+	l.ArchivedAt = ParseListURIs(strings.Join(m.header["Archived-At"], ","))
+	if !found && len(l.ArchivedAt) == 0 {
+		return nil
+	}
+	return l
+}
+
+// ParseListID splits a List-Id header into the list identifier and its
+// description, decoding RFC 2047 encoded-words of the latter.  A value
+// without angle brackets is taken as a bare identifier.
+func ParseListID(value string) (id, description string) {
+	value = strings.TrimSpace(unfoldHeader(value))
+	i := strings.LastIndex(value, "<")
+	j := strings.LastIndex(value, ">")
+	if i < 0 || j < i {
+		return strings.Trim(value, "<>"), ""
+	}
+	id = strings.TrimSpace(value[i+1 : j])
+	description = strings.TrimSpace(value[:i])
+	if len(description) >= 2 && description[0] == '"' && description[len(description)-1] == '"' {
+		description = strings.Replace(description[1:len(description)-1], `\"`, `"`, -1)
+	}
+	return id, DecodeHeader(description)
+}
+
+// ParseListURIs returns the URIs of an RFC 2369 header, which are enclosed in
+// angle brackets, separated by commas and may be followed by comments.
+func ParseListURIs(value string) []string {
+	var uris []string
+	depth := 0
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '(':
+			depth++
+		case ')':
+			if depth > 0 {
+				depth--
+			}
+		case '<':
+			if depth > 0 {
+				continue
+			}
+			j := strings.IndexByte(value[i:], '>')
+			if j < 0 {
+				return uris
+			}
+			// White space in URIs is ignored
+			if uri := strings.Join(strings.Fields(value[i+1:i+j]), ""); uri != "" {
+				uris = append(uris, uri)
+			}
+			i += j
+		}
+	}
+	return uris
+}
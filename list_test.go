@@ -0,0 +1,83 @@
+package enmime
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseListID(t *testing.T) {
+	var testTable = []struct {
+		input, id, description string
+	}{
+		{"<list.example.com>", "list.example.com", ""},
+		{"Example Users <users.example.com>", "users.example.com", "Example Users"},
+		{`"Users, \"the\" list" <users.example.com>`, "users.example.com", `Users, "the" list`},
+		{"=?utf-8?q?Liste_f=C3=BCr_Nutzer?= <nutzer.example.de>", "nutzer.example.de", "Liste für Nutzer"},
+		{"users.example.com", "users.example.com", ""},
+		{"", "", ""},
+	}
+
+	for _, tt := range testTable {
+		id, description := ParseListID(tt.input)
+		assert.Equal(t, tt.id, id, "Input %q", tt.input)
+		assert.Equal(t, tt.description, description, "Input %q", tt.input)
+	}
+}
+
+func TestParseListURIs(t *testing.T) {
+	var testTable = []struct {
+		input  string
+		expect []string
+	}{
+		{"<mailto:list-request@example.com?subject=unsubscribe>",
+			[]string{"mailto:list-request@example.com?subject=unsubscribe"}},
+		{"<https://example.com/u?id=1>, <mailto:u@example.com>",
+			[]string{"https://example.com/u?id=1", "mailto:u@example.com"}},
+		{"<mailto:list@example.com> (Postings are moderated <mailto:no@x>)",
+			[]string{"mailto:list@example.com"}},
+		{"<https://example.com/archive/\r\n 2003/07>", []string{"https://example.com/archive/2003/07"}},
+		{"<https://example.com/(paren)>", []string{"https://example.com/(paren)"}},
+		{"NO (posting not allowed)", nil},
+	}
+
+	for _, tt := range testTable {
+		assert.Equal(t, tt.expect, ParseListURIs(tt.input), "Input %q", tt.input)
+	}
+}
+
+func TestMailingList(t *testing.T) {
+	mime := parseHeaderOnly(t, "List-Id: Example Users <users.example.com>\r\n"+
+		"List-Unsubscribe: <mailto:users-leave@example.com>,\r\n"+
+		" <https://example.com/unsubscribe?u=42>\r\n"+
+		"List-Unsubscribe-Post: List-Unsubscribe=One-Click\r\n"+
+		"List-Post: NO (moderated)\r\n"+
+		"List-Archive: <https://example.com/archive>\r\n"+
+		"Archived-At: <https://example.com/archive/42>")
+
+	l := mime.MailingList()
+	if assert.NotNil(t, l) {
+		assert.Equal(t, "users.example.com", l.ID)
+		assert.Equal(t, "Example Users", l.Description)
+		assert.Equal(t, []string{"mailto:users-leave@example.com"}, l.UnsubscribeMailto)
+		assert.Equal(t, []string{"https://example.com/unsubscribe?u=42"}, l.UnsubscribeHTTP)
+		assert.True(t, l.OneClick)
+		assert.False(t, l.PostingAllowed)
+		assert.Empty(t, l.Post)
+		assert.Equal(t, []string{"https://example.com/archive"}, l.Archive)
+		assert.Equal(t, []string{"https://example.com/archive/42"}, l.ArchivedAt)
+	}
+
+	// One-click needs an HTTPS URI
+	mime = parseHeaderOnly(t, "List-Unsubscribe: <http://example.com/u>\r\n"+
+		"List-Unsubscribe-Post: List-Unsubscribe=One-Click\r\n"+
+		"List-Post: <mailto:list@example.com>")
+	l = mime.MailingList()
+	if assert.NotNil(t, l) {
+		assert.False(t, l.OneClick)
+		assert.True(t, l.PostingAllowed)
+		assert.Equal(t, []string{"mailto:list@example.com"}, l.Post)
+	}
+
+	assert.Nil(t, parseHeaderOnly(t, "Subject: personal").MailingList())
+}
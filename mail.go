@@ -1,8 +1,10 @@
 package enmime
 
 import (
+	"bytes"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"strings"
 	"sync"
@@ -19,12 +21,17 @@ type MIMEBody struct {
 	TextCharset    string
 	HTML           string // The HTML portion of the message
 	HTMLCharset    string
-	IsTextFromHTML bool        // Plain text was empty; down-converted HTML
-	Root           MIMEPart    // The top-level MIMEPart
-	Attachments    []MIMEPart  // All parts having a Content-Disposition of attachment
-	Inlines        []MIMEPart  // All parts having a Content-Disposition of inline
-	OtherParts     []MIMEPart  // All parts not in Attachments and Inlines
-	header         mail.Header // Header from original message
+	IsTextFromHTML bool         // Plain text was empty; down-converted HTML
+	Root           MIMEPart     // The top-level MIMEPart
+	Attachments    []MIMEPart   // All parts having a Content-Disposition of attachment
+	Inlines        []MIMEPart   // All parts having a Content-Disposition of inline
+	OtherParts     []MIMEPart   // All parts not in Attachments and Inlines
+	header         mail.Header  // Header from original message
+	raw            []byte       // Original message, kept by ReadMIMEBody
+	fields         HeaderFields // Header set by SetHeaderFields, nil if unchanged
+
+	// ParseOptions.HTMLText, which Text was converted from HTML with
+	htmlText *HTMLTextOptions
 }
 
 // AddressHeaders enumerates SMTP headers that contain email addresses
@@ -171,23 +178,93 @@ func parseTextOnly(mm *MIMEBody, cte, txtCharset string, correctUTF8QP bool, r i
 	return bs, nil
 }
 
+// ParseOptions controls how ParseMIMEBodyWithOptions and
+// ReadMIMEBodyWithOptions parse a message.  The zero value parses like
+// ParseMIMEBody.
+type ParseOptions struct {
+	// CorrectUTF8QP corrects invalid UTF-8 quoted-printable, see
+	// ParseMIMEBodyWithUTF8QPCorrection.
+	CorrectUTF8QP bool
+	// KeepFlowed keeps the soft line breaks and space-stuffing of
+	// format=flowed text in Text, instead of joining the flowed lines.
+	KeepFlowed bool
+	// HTMLText converts the HTML body to Text with HTMLToText and these
+	// options when there is no text body.  When nil html2text is used.
+	HTMLText *HTMLTextOptions
+}
+
 // ParseMIMEBody parses the body of the message object into a  tree of MIMEPart
 // objects, each of which is aware of its content type, filename and headers.
 // If the part was encoded in quoted-printable or base64, it is decoded before
 // being stored in the MIMEPart object.
 func ParseMIMEBody(mailMsg *mail.Message) (*MIMEBody, error) {
-	return parsingMIMEBody(mailMsg, false)
+	return parsingMIMEBody(mailMsg, &ParseOptions{})
 }
 
 // ParseMIMEBodyWithUTF8QPCorrection like ParseMIMEBody but will try to
 // correct bad email with invalid UTF8 quoted-printable so the email can be
 // successfully parsed.
 func ParseMIMEBodyWithUTF8QPCorrection(mailMsg *mail.Message) (*MIMEBody, error) {
-	return parsingMIMEBody(mailMsg, true)
+	return parsingMIMEBody(mailMsg, &ParseOptions{CorrectUTF8QP: true})
+}
+
+// ParseMIMEBodyWithOptions is like ParseMIMEBody, with opts.  A nil opts is
+// the same as the zero ParseOptions.
+func ParseMIMEBodyWithOptions(mailMsg *mail.Message, opts *ParseOptions) (*MIMEBody, error) {
+	if opts == nil {
+		opts = &ParseOptions{}
+	}
+	return parsingMIMEBody(mailMsg, opts)
+}
+
+// ReadMIMEBody reads a whole message from r and parses it like ParseMIMEBody.
+// Unlike ParseMIMEBody it keeps the original message, which checks like DKIM
+// verification need.
+func ReadMIMEBody(r io.Reader) (*MIMEBody, error) {
+	return ReadMIMEBodyWithOptions(r, nil)
 }
 
-func parsingMIMEBody(mailMsg *mail.Message, correctUTF8QP bool) (*MIMEBody, error) {
+// ReadMIMEBodyWithOptions is like ReadMIMEBody, with opts.  A nil opts is the
+// same as the zero ParseOptions.
+func ReadMIMEBodyWithOptions(r io.Reader, opts *ParseOptions) (*MIMEBody, error) {
+	raw, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	mailMsg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	m, err := ParseMIMEBodyWithOptions(mailMsg, opts)
+	if m != nil {
+		m.raw = raw
+		m.locateRaw()
+	}
+	return m, err
+}
+
+// Raw returns the original message if it was parsed by ReadMIMEBody, or nil.
+func (m *MIMEBody) Raw() []byte {
+	return m.raw
+}
+
+// locateRaw records where the parts are in the original message.  The root
+// part, and the part of a single part message, span the whole message.
+func (m *MIMEBody) locateRaw() {
+	_, params, _ := mime.ParseMediaType(m.header.Get("Content-Type"))
+	if root, ok := m.Root.(*memMIMEPart); ok {
+		root.locateRaw(m.raw, 0, len(m.raw), params["boundary"])
+	}
+	for _, p := range m.Attachments {
+		if mp, ok := p.(*memMIMEPart); ok && mp.raw == nil && mp.parent == nil {
+			mp.locateRaw(m.raw, 0, len(m.raw), "")
+		}
+	}
+}
+
+func parsingMIMEBody(mailMsg *mail.Message, opts *ParseOptions) (*MIMEBody, error) {
 	var gerr error
+	correctUTF8QP := opts.CorrectUTF8QP
 	mimeMsg := &MIMEBody{
 		IsTextFromHTML: false,
 		header:         mailMsg.Header,
@@ -196,7 +273,15 @@ func parsingMIMEBody(mailMsg *mail.Message, correctUTF8QP bool) (*MIMEBody, erro
 	if !IsMultipartMessage(mailMsg) {
 		// Attachment only?
 		if IsBinaryBody(mailMsg) {
-			return binMIME(mailMsg)
+			m, err := binMIME(mailMsg)
+			if m == nil {
+				return nil, err
+			}
+			m.richTextBody(m.Attachments[0])
+			if herr := m.textFromHTML(opts); herr != nil {
+				return m, herr
+			}
+			return m, err
 		}
 		var once sync.Once
 		f := func(charset string) ([]byte, error) {
@@ -223,33 +308,20 @@ func parsingMIMEBody(mailMsg *mail.Message, correctUTF8QP bool) (*MIMEBody, erro
 				if err != nil {
 					return nil, err
 				}
-				if charset != "" {
-					// Convert plain text to UTF8 if content type specified a charset
-					newStr, err := ConvertToUTF8String(charset, bodyBytes)
-					if err != nil && newStr == "" {
-						return nil, err
-					} else {
-						if err != nil {
-							gerr = err
-						}
-						mimeMsg.Text = newStr
-						mimeMsg.TextCharset = charset
-					}
-				} else if mediatype == "text/html" { // charset is empty, look in html body for charset
-					charset, err := charsetFromHTMLString(mimeMsg.Text)
-
-					if charset != "" && err == nil {
-						newStr, err := ConvertToUTF8String(charset, bodyBytes)
-						if err != nil && newStr == "" {
-							return nil, err
-						} else {
-							if err != nil {
-								gerr = err
-							}
-							mimeMsg.Text = newStr
-							mimeMsg.TextCharset = charset
-						}
+				if charset == "" && mediatype == "text/html" {
+					// charset is empty, look in html body for charset
+					charset, _ = charsetFromHTMLString(mimeMsg.Text)
+				}
+				// Convert text to UTF8, detecting the charset if not specified
+				newStr, cs, err := decodeToUTF8(charset, bodyBytes)
+				if err != nil && newStr == "" {
+					return nil, err
+				} else {
+					if err != nil {
+						gerr = err
 					}
+					mimeMsg.Text = unflowText(ctype, newStr, opts)
+					mimeMsg.TextCharset = cs
 				}
 				if mediatype == "text/html" {
 					mimeMsg.HTMLCharset = mimeMsg.TextCharset
@@ -260,8 +332,11 @@ func parsingMIMEBody(mailMsg *mail.Message, correctUTF8QP bool) (*MIMEBody, erro
 				}
 			}
 		}
-		if _, err := f(""); err != nil {
+		if bodyBytes, err := f(""); err != nil {
 			return nil, err
+		} else if len(bodyBytes) > 0 {
+			// No usable Content-Type, the charset can only be detected
+			mimeMsg.Text, mimeMsg.TextCharset, _ = decodeToUTF8("", bodyBytes)
 		}
 	} else {
 		// Parse top-level multipart
@@ -292,21 +367,17 @@ func parsingMIMEBody(mailMsg *mail.Message, correctUTF8QP bool) (*MIMEBody, erro
 				return p.ContentType() == "text/plain" && p.Disposition() != "attachment"
 			})
 			if match != nil {
-				if match.Charset() != "" {
-					newStr, err := ConvertToUTF8String(match.Charset(), match.Content())
-					if err != nil {
-						if newStr == "" {
-							return nil, err
-						} else {
-							gerr = err
-						}
+				newStr, cs, err := decodeToUTF8(match.Charset(), match.Content())
+				if err != nil {
+					if newStr == "" {
+						return nil, err
+					} else {
+						gerr = err
 					}
-					mimeMsg.Text += newStr
-				} else {
-					mimeMsg.Text += string(match.Content())
 				}
+				mimeMsg.Text += unflowText(match.Header().Get("Content-Type"), newStr, opts)
 				if mimeMsg.TextCharset == "" {
-					mimeMsg.TextCharset = match.Charset()
+					mimeMsg.TextCharset = cs
 				}
 			}
 		} else {
@@ -318,21 +389,17 @@ func parsingMIMEBody(mailMsg *mail.Message, correctUTF8QP bool) (*MIMEBody, erro
 				if i > 0 {
 					mimeMsg.Text += "\n--\n"
 				}
-				if m.Charset() != "" {
-					newStr, err := ConvertToUTF8String(m.Charset(), m.Content())
-					if err != nil {
-						if newStr == "" {
-							return nil, err
-						} else {
-							gerr = err
-						}
+				newStr, cs, err := decodeToUTF8(m.Charset(), m.Content())
+				if err != nil {
+					if newStr == "" {
+						return nil, err
+					} else {
+						gerr = err
 					}
-					mimeMsg.Text += newStr
-				} else {
-					mimeMsg.Text += string(m.Content())
 				}
+				mimeMsg.Text += unflowText(m.Header().Get("Content-Type"), newStr, opts)
 				if mimeMsg.TextCharset == "" {
-					mimeMsg.TextCharset = m.Charset()
+					mimeMsg.TextCharset = cs
 				}
 			}
 		}
@@ -342,70 +409,151 @@ func parsingMIMEBody(mailMsg *mail.Message, correctUTF8QP bool) (*MIMEBody, erro
 			return p.ContentType() == "text/html" && p.Disposition() != "attachment"
 		})
 		if match != nil {
-			if match.Charset() != "" {
-				newStr, err := ConvertToUTF8String(match.Charset(), match.Content())
-				if err != nil {
-					if newStr == "" {
-						return nil, err
-					} else {
-						gerr = err
-					}
+			charset := match.Charset()
+			if charset == "" {
+				// charset is empty, look in html body for charset
+				charset, _ = charsetFromHTMLString(string(match.Content()))
+			}
+			newStr, cs, err := decodeToUTF8(charset, match.Content())
+			if err != nil {
+				if newStr == "" {
+					return nil, err
+				} else {
+					gerr = err
 				}
-				mimeMsg.HTML += newStr
-			} else {
-				mimeMsg.HTML = string(match.Content())
 			}
+			mimeMsg.HTML += newStr
 			if mimeMsg.HTMLCharset == "" {
-				mimeMsg.HTMLCharset = match.Charset()
+				mimeMsg.HTMLCharset = cs
 			}
 		}
 
-		// Locate attachments
-		mimeMsg.Attachments = BreadthMatchAll(root, func(p MIMEPart) bool {
-			return p.Disposition() == "attachment" || p.ContentType() == "application/octet-stream"
-		})
-
-		// Locate inlines
-		mimeMsg.Inlines = BreadthMatchAll(root, func(p MIMEPart) bool {
-			return p.Disposition() == "inline"
-		})
+		// Convert text/enriched or text/rtf when there is no other body
+		if mimeMsg.Text == "" && mimeMsg.HTML == "" {
+			mimeMsg.richTextBody(BreadthMatchFirst(root, isRichTextBody))
+		}
 
-		// Locate others parts not handled in "Attachments" and "inlines"
-		mimeMsg.OtherParts = BreadthMatchAll(root, func(p MIMEPart) bool {
-			if strings.HasPrefix(p.ContentType(), "multipart/") {
-				return false
-			}
+		mimeMsg.sortParts()
+	}
 
-			if p.Disposition() != "" {
-				return false
-			}
+	if err := mimeMsg.textFromHTML(opts); err != nil {
+		return mimeMsg, err
+	}
+	return mimeMsg, gerr
+}
 
-			if p.ContentType() == "application/octet-stream" {
-				return false
-			}
+// textFromHTML down-converts HTML to text if necessary.
+func (m *MIMEBody) textFromHTML(opts *ParseOptions) error {
+	if m.Text != "" || m.HTML == "" {
+		return nil
+	}
+	m.IsTextFromHTML = true
+	m.htmlText = opts.HTMLText
+	var err error
+	if m.Text, err = m.htmlToText(m.HTML); err != nil {
+		// Fail gently
+		m.Text = ""
+		return err
+	}
+	m.TextCharset = m.HTMLCharset
+	return nil
+}
 
-			return p.ContentType() != "text/plain" && p.ContentType() != "text/html"
-		})
+// htmlToText converts HTML to text the way Text is converted from the HTML
+// body, with HTMLToText when ParseOptions.HTMLText was given.
+func (m *MIMEBody) htmlToText(doc string) (string, error) {
+	if m.htmlText != nil {
+		return HTMLToText(doc, m.htmlText)
 	}
+	return html2text.FromString(doc)
+}
 
-	// Down-convert HTML to text if necessary
-	if mimeMsg.Text == "" && mimeMsg.HTML != "" {
-		mimeMsg.IsTextFromHTML = true
-		var err error
-		if mimeMsg.Text, err = html2text.FromString(mimeMsg.HTML); err != nil {
-			// Fail gently
-			mimeMsg.Text = ""
-			return mimeMsg, err
+// isRichTextBody tells whether p is a text/enriched or text/rtf body.
+func isRichTextBody(p MIMEPart) bool {
+	return (p.ContentType() == "text/enriched" || p.ContentType() == "text/rtf") &&
+		p.Disposition() != "attachment"
+}
+
+// richTextBody fills Text, or HTML for RTF encapsulating HTML, from p when it
+// is a text/enriched or text/rtf body.  A body that cannot be converted is
+// left out, the part itself being kept.
+func (m *MIMEBody) richTextBody(p MIMEPart) {
+	if p == nil || !isRichTextBody(p) {
+		return
+	}
+	if p.ContentType() == "text/enriched" {
+		if text, cs, _ := decodeToUTF8(p.Charset(), p.Content()); text != "" {
+			m.Text, m.TextCharset = EnrichedToText(text), cs
 		}
-		mimeMsg.TextCharset = mimeMsg.HTMLCharset
+		return
 	}
-	return mimeMsg, gerr
+	d, err := decodeRTF(p.Content())
+	if err != nil {
+		return
+	}
+	if d.fromHTML {
+		m.HTML, m.HTMLCharset = d.html.String(), d.charset
+	} else {
+		m.Text, m.TextCharset = d.text.String(), d.charset
+	}
+}
+
+// sortParts fills Attachments, Inlines and OtherParts from the part tree.
+func (m *MIMEBody) sortParts() {
+	// Locate attachments
+	m.Attachments = BreadthMatchAll(m.Root, func(p MIMEPart) bool {
+		return p.Disposition() == "attachment" || p.ContentType() == "application/octet-stream"
+	})
+
+	// Locate inlines
+	m.Inlines = BreadthMatchAll(m.Root, func(p MIMEPart) bool {
+		return p.Disposition() == "inline"
+	})
+
+	// Locate others parts not handled in "Attachments" and "inlines"
+	m.OtherParts = BreadthMatchAll(m.Root, func(p MIMEPart) bool {
+		if strings.HasPrefix(p.ContentType(), "multipart/") {
+			return false
+		}
+
+		if p.Disposition() != "" {
+			return false
+		}
+
+		if p.ContentType() == "application/octet-stream" {
+			return false
+		}
+
+		return p.ContentType() != "text/plain" && p.ContentType() != "text/html"
+	})
 }
 
 // GetHeader processes the specified header for RFC 2047 encoded words and
 // return the result
 func (m *MIMEBody) GetHeader(name string) string {
-	return DecodeHeader(m.header.Get(name))
+	return m.GetDecodedHeader(name).Value
+}
+
+// GetDecodedHeader is like GetHeader, but raw 8-bit text is converted from
+// the charset of the message body before falling back to charset detection.
+// The result tells whether the charset was guessed.
+func (m *MIMEBody) GetDecodedHeader(name string) DecodedHeader {
+	return DecodeHeaderFallback(m.header.Get(name), m.headerCharset())
+}
+
+// headerCharset returns the charset to try for raw 8-bit header text: the
+// charset of the top-level Content-Type, else the one of the text or HTML body.
+func (m *MIMEBody) headerCharset() string {
+	_, params, err := mime.ParseMediaType(m.header.Get("Content-Type"))
+	if err == nil || mime.IsOkPMTError(err) == nil {
+		if cs := params["charset"]; cs != "" {
+			return cs
+		}
+	}
+	if m.TextCharset != "" {
+		return m.TextCharset
+	}
+	return m.HTMLCharset
 }
 
 // AddressList returns a mail.Address slice with RFC 2047 encoded encoded names.
@@ -421,7 +569,11 @@ func (m *MIMEBody) AddressList(key string) ([]*mail.Address, error) {
 		return nil, fmt.Errorf("%s is not address header", key)
 	}
 
-	str := DecodeToUTF8Base64Header(m.header.Get(key))
+	str := m.header.Get(key)
+	if !isASCIIOrUTF8([]byte(str)) {
+		str, _ = decodeRawHeader(str, m.headerCharset())
+	}
+	str = DecodeToUTF8Base64Header(str)
 	if str == "" {
 		return nil, mail.ErrHeaderNotPresent
 	}
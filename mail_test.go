@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"bytes"
 	"fmt"
+	"io/ioutil"
 	"strings"
 	//"net/mail"
 	"os"
@@ -507,6 +508,84 @@ func TestLongHeader(t *testing.T) {
 	assert.Equal(t, "</div>hello!</div>", mime.HTML, "Html text is not match")
 }
 
+func TestRawHeaderBodyCharset(t *testing.T) {
+	mime := parseHeaderOnly(t, "From: \xc8\xe2\xe0\xed <ivan@example.com>\r\n"+
+		"Subject: \xcf\xf0\xe8\xe2\xe5\xf2\r\n"+
+		"Content-Type: text/plain; charset=windows-1251")
+
+	subject := mime.GetDecodedHeader("Subject")
+	assert.Equal(t, "Привет", subject.Value)
+	assert.Equal(t, "windows-1251", subject.Charset)
+	assert.True(t, subject.Guessed)
+	assert.Equal(t, "Привет", mime.GetHeader("Subject"))
+
+	from, err := mime.AddressList("From")
+	if assert.Nil(t, err) && assert.Equal(t, 1, len(from)) {
+		assert.Equal(t, "Иван", from[0].Name)
+		assert.Equal(t, "ivan@example.com", from[0].Address)
+	}
+
+	mime = parseHeaderOnly(t, "Subject: Hello")
+	assert.False(t, mime.GetDecodedHeader("Subject").Guessed)
+}
+
+func TestReadMIMEBodyRawParts(t *testing.T) {
+	raw, err := ioutil.ReadFile(filepath.Join("test-data", "mail", "attachment-octet.raw"))
+	if err != nil {
+		t.Fatalf("Failed to open test data: %v", err)
+	}
+	mime, err := ReadMIMEBody(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+	root := mime.Root.(RawMIMEPart)
+	start, end := root.Offsets()
+	assert.Equal(t, 0, start, "Root should start the message")
+	assert.Equal(t, len(raw), end, "Root should end the message")
+	assert.True(t, strings.HasPrefix(string(root.RawHeader()), "From: me@here.com\n"),
+		"Root should have the message header")
+	assert.True(t, strings.HasSuffix(string(root.RawHeader()), "boundary=\"MyBoundaryString\"\n\n"),
+		"Root header should end with its empty line")
+
+	att := mime.Attachments[0].(RawMIMEPart)
+	assert.Equal(t, "Content-Type: application/octet-stream; file=\"ATTACHMENT.EXE\"\n"+
+		"Content-Transfer-Encoding: base64\n\n", string(att.RawHeader()),
+		"Attachment should have its header block")
+	assert.Equal(t, "AxfhfujropadladnggnfjgwsaiubvnmkadiuhterqHJSFfuAjkfhrqpeorLAkFn\n"+
+		"jNfhgt7Fjd9dfkliodf==\n", string(att.RawContent()), "Attachment should have its encoded content")
+	start, end = att.Offsets()
+	assert.Equal(t, string(att.RawHeader())+string(att.RawContent()), string(raw[start:end]),
+		"Attachment range should match its raw bytes")
+
+	// Without the original message
+	mime, err = ParseMIMEBody(readMessage("attachment-octet.raw"))
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+	att = mime.Attachments[0].(RawMIMEPart)
+	start, _ = att.Offsets()
+	assert.Equal(t, -1, start, "Parts should not know their offsets")
+	assert.Nil(t, att.RawContent(), "Parts should not know their raw content")
+}
+
+func TestReadMIMEBodyRawSinglePart(t *testing.T) {
+	raw := "From: me@here.com\r\nContent-Type: application/pdf\r\n" +
+		"Content-Disposition: attachment; filename=doc.pdf\r\n" +
+		"Content-Transfer-Encoding: base64\r\n\r\nJVBERi0=\r\n"
+	mime, err := ReadMIMEBody(strings.NewReader(raw))
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+	if assert.Equal(t, 1, len(mime.Attachments), "Should have a single attachment") {
+		att := mime.Attachments[0].(RawMIMEPart)
+		assert.Equal(t, "%PDF-", string(att.Content()), "Attachment should be decoded")
+		assert.Equal(t, "JVBERi0=\r\n", string(att.RawContent()), "Attachment should have its encoded content")
+		start, end := att.Offsets()
+		assert.Equal(t, 0, start, "Single part should start the message")
+		assert.Equal(t, len(raw), end, "Single part should end the message")
+	}
+}
+
 // readMessage is a test utility function to fetch a mail.Message object.
 func readMessage(filename string) *mail.Message {
 	// Open test email for parsing
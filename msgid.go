@@ -0,0 +1,66 @@
+package enmime
+
+import (
+	"strings"
+)
+
+// ParseMessageIDs returns the msg-ids of a Message-ID, In-Reply-To or
+// References header without their angle brackets.  Comments are skipped, and
+// so are the phrases some clients put in In-Reply-To, as long as the ids are
+// bracketed.  Values without any brackets are split at white space and
+// commas.
+func ParseMessageIDs(value string) []string {
+	value = stripComments(unfoldHeader(value))
+	var ids []string
+	if !strings.Contains(value, "<") {
+		for _, f := range strings.FieldsFunc(value, func(r rune) bool {
+			return r == ' ' || r == '\t' || r == ','
+		}) {
+			if f = strings.Trim(f, `">`); f != "" {
+				ids = append(ids, f)
+			}
+		}
+		return ids
+	}
+	for {
+		i := strings.Index(value, "<")
+		if i < 0 {
+			break
+		}
+		value = value[i+1:]
+		j := strings.IndexAny(value, "<>")
+		if j < 0 {
+			j = len(value)
+		}
+		// Some clients fold long ids
+		id := strings.Join(strings.Fields(value[:j]), "")
+		if id != "" {
+			ids = append(ids, id)
+		}
+		if j < len(value) && value[j] == '>' {
+			j++
+		}
+		value = value[j:]
+	}
+	return ids
+}
+
+// MessageID returns the Message-ID of the message without its angle brackets,
+// or an empty string.
+func (m *MIMEBody) MessageID() string {
+	if ids := ParseMessageIDs(m.header.Get("Message-Id")); len(ids) > 0 {
+		return ids[0]
+	}
+	return ""
+}
+
+// InReplyTo returns the msg-ids of the In-Reply-To header.
+func (m *MIMEBody) InReplyTo() []string {
+	return ParseMessageIDs(m.header.Get("In-Reply-To"))
+}
+
+// References returns the msg-ids of the References header, from the first
+// message of the thread to the parent.
+func (m *MIMEBody) References() []string {
+	return ParseMessageIDs(strings.Join(m.header["References"], " "))
+}
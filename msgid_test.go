@@ -0,0 +1,40 @@
+package enmime
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMessageIDs(t *testing.T) {
+	var testTable = []struct {
+		input  string
+		expect []string
+	}{
+		{"<abc@example.com>", []string{"abc@example.com"}},
+		{"  <abc@example.com> (added by relay)", []string{"abc@example.com"}},
+		{"abc@example.com", []string{"abc@example.com"}},
+		{"<a@x> <b@x>\r\n\t<c@x>", []string{"a@x", "b@x", "c@x"}},
+		{"<a@x><b@x>", []string{"a@x", "b@x"}},
+		{"a@x, b@x", []string{"a@x", "b@x"}},
+		{`Your message of "Tue, 1 Jul 2003" <a@x>`, []string{"a@x"}},
+		{"<a@x> (comment <not@id>) <b@x>", []string{"a@x", "b@x"}},
+		{"<long-id-\r\n folded@x>", []string{"long-id-folded@x"}},
+		{"<a@x", []string{"a@x"}},
+		{"", nil},
+	}
+
+	for _, tt := range testTable {
+		assert.Equal(t, tt.expect, ParseMessageIDs(tt.input), "Input %q", tt.input)
+	}
+}
+
+func TestMIMEBodyMessageIDs(t *testing.T) {
+	mime := parseHeaderOnly(t, "Message-ID: <c@x>\r\n"+
+		"In-Reply-To: <b@x> (from Bob)\r\n"+
+		"References: <a@x>\r\n <b@x>")
+
+	assert.Equal(t, "c@x", mime.MessageID())
+	assert.Equal(t, []string{"b@x"}, mime.InReplyTo())
+	assert.Equal(t, []string{"a@x", "b@x"}, mime.References())
+}
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"bytes"
 	"io"
+	"io/ioutil"
 	//"mime/multipart"
 	//"mime/quotedprintable"
 	//"net/textproto"
@@ -35,6 +36,16 @@ type MIMEPart interface {
 	Content() []byte              // Decoded content of this part (can be empty)
 }
 
+// RawMIMEPart is implemented by the parts of this package, which know their
+// bytes in the original message.  Get at it with a type assertion on a
+// MIMEPart.
+type RawMIMEPart interface {
+	MIMEPart
+	RawHeader() []byte         // Original header block with its empty line (can be nil)
+	RawContent() []byte        // Original content, still transfer encoded (can be nil)
+	Offsets() (start, end int) // Byte range of the part in the original message, or -1
+}
+
 // memMIMEPart is an in-memory implementation of the MIMEPart interface.  It will likely
 // choke on huge attachments.
 type memMIMEPart struct {
@@ -47,6 +58,12 @@ type memMIMEPart struct {
 	fileName    string
 	charset     string
 	content     []byte
+	raw         []byte // Original message, nil if not kept
+	rawStart    int
+	rawBody     int
+	rawEnd      int
+	fields      HeaderFields // Header set by SetHeaderFields, nil if unchanged
+	changed     bool         // Content or children changed since parsing
 }
 
 // NewMIMEPart creates a new memMIMEPart object.  It does not update the parents FirstChild
@@ -100,9 +117,39 @@ func (p *memMIMEPart) Content() []byte {
 	return p.content
 }
 
+// Original header block with its empty line (can be nil)
+func (p *memMIMEPart) RawHeader() []byte {
+	if p.raw == nil {
+		return nil
+	}
+	return p.raw[p.rawStart:p.rawBody]
+}
+
+// Original content, still transfer encoded (can be nil)
+func (p *memMIMEPart) RawContent() []byte {
+	if p.raw == nil {
+		return nil
+	}
+	return p.raw[p.rawBody:p.rawEnd]
+}
+
+// Byte range of the part in the original message, or -1
+func (p *memMIMEPart) Offsets() (start, end int) {
+	if p.raw == nil {
+		return -1, -1
+	}
+	return p.rawStart, p.rawEnd
+}
+
 // ParseMIME reads a MIME document from the provided reader and parses it into
-// tree of MIMEPart objects.
+// tree of MIMEPart objects.  The document is kept, so that the parts know their
+// original bytes.
 func ParseMIME(reader *bufio.Reader) (MIMEPart, error) {
+	raw, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	reader = bufio.NewReader(bytes.NewReader(raw))
 	tr := textproto.NewReader(reader)
 	header, err := tr.ReadMIMEHeader()
 	if err != nil {
@@ -131,6 +178,7 @@ func ParseMIME(reader *bufio.Reader) (MIMEPart, error) {
 		}
 		root.content = content
 	}
+	root.locateRaw(raw, 0, len(raw), params["boundary"])
 
 	return root, nil
 }
@@ -220,22 +268,7 @@ func parseParts(parent *memMIMEPart, reader io.Reader, boundary string, correctU
 		}
 		prevSibling = p
 
-		// Figure out our disposition, filename
-		disposition, dparams, err := mime.ParseMediaType(mrp.Header.Get("Content-Disposition"))
-		if err == nil || mime.IsOkPMTError(err) == nil {
-			// Disposition is optional
-			p.disposition = disposition
-			p.fileName = DecodeHeader(dparams["filename"])
-		}
-		if p.fileName == "" && mparams["name"] != "" {
-			p.fileName = DecodeHeader(mparams["name"])
-		}
-		if p.fileName == "" && mparams["file"] != "" {
-			p.fileName = DecodeHeader(mparams["file"])
-		}
-		if p.charset == "" {
-			p.charset = mparams["charset"]
-		}
+		p.setDisposition(mparams)
 
 		boundary := mparams["boundary"]
 		isText := strings.HasPrefix(mediatype, "text/")
@@ -270,6 +303,122 @@ func parseParts(parent *memMIMEPart, reader io.Reader, boundary string, correctU
 	return nil
 }
 
+// setDisposition figures out the disposition, file name and charset of p from
+// its header and the parameters of its Content-Type.
+func (p *memMIMEPart) setDisposition(mparams map[string]string) {
+	p.disposition, p.fileName = "", ""
+	disposition, dparams, err := mime.ParseMediaType(p.header.Get("Content-Disposition"))
+	if err == nil || mime.IsOkPMTError(err) == nil {
+		// Disposition is optional
+		p.disposition = disposition
+		p.fileName = DecodeHeader(dparams["filename"])
+	}
+	if p.fileName == "" && mparams["name"] != "" {
+		p.fileName = DecodeHeader(mparams["name"])
+	}
+	if p.fileName == "" && mparams["file"] != "" {
+		p.fileName = DecodeHeader(mparams["file"])
+	}
+	if p.charset == "" {
+		p.charset = mparams["charset"]
+	}
+}
+
+// locateRaw records that p is raw[start:end], and where its descendants are
+// when it is a multipart with the given boundary.  Parts are matched in order
+// with the delimiters found in raw; when their numbers differ the descendants
+// are left without offsets.
+func (p *memMIMEPart) locateRaw(raw []byte, start, end int, boundary string) {
+	p.raw, p.rawStart, p.rawBody, p.rawEnd = raw, start, rawHeaderEnd(raw, start, end), end
+	if boundary == "" {
+		return
+	}
+	spans := rawBodyParts(raw, p.rawBody, end, boundary)
+	var children []*memMIMEPart
+	for c := p.firstChild; c != nil; c = c.NextSibling() {
+		cp, ok := c.(*memMIMEPart)
+		if !ok {
+			return
+		}
+		children = append(children, cp)
+	}
+	if len(children) != len(spans) {
+		// The parser did not split the body like the delimiters do, the
+		// children would be given the bytes of others
+		for _, cp := range children {
+			cp.forgetRaw()
+		}
+		return
+	}
+	for i, cp := range children {
+		_, params, _ := mime.ParseMediaType(cp.header.Get("Content-Type"))
+		cp.locateRaw(raw, spans[i][0], spans[i][1], params["boundary"])
+	}
+}
+
+// forgetRaw drops the original bytes of p and its descendants.
+func (p *memMIMEPart) forgetRaw() {
+	p.raw = nil
+	for c := p.firstChild; c != nil; c = c.NextSibling() {
+		if cp, ok := c.(*memMIMEPart); ok {
+			cp.forgetRaw()
+		}
+	}
+}
+
+// rawHeaderEnd returns the offset following the empty line that ends the
+// header block starting at start, or end if there is none.
+func rawHeaderEnd(raw []byte, start, end int) int {
+	for i := start; i < end; {
+		nl := bytes.IndexByte(raw[i:end], '\n')
+		if nl < 0 {
+			break
+		}
+		if nl == 0 || nl == 1 && raw[i] == '\r' {
+			return i + nl + 1
+		}
+		i += nl + 1
+	}
+	return end
+}
+
+// rawBodyParts returns the byte ranges of the body parts of the multipart
+// body raw[start:end].  The line break before a delimiter belongs to the
+// delimiter, and a part missing its closing delimiter runs to end.
+func rawBodyParts(raw []byte, start, end int, boundary string) [][2]int {
+	delim := []byte("--" + boundary)
+	var spans [][2]int
+	partStart := -1
+	for i := start; i < end; {
+		lineEnd, next := end, end
+		if nl := bytes.IndexByte(raw[i:end], '\n'); nl >= 0 {
+			lineEnd, next = i+nl, i+nl+1
+		}
+		line := bytes.TrimRight(raw[i:lineEnd], " \t\r")
+		if bytes.HasPrefix(line, delim) && (len(line) == len(delim) || string(line[len(delim):]) == "--") {
+			if partStart >= 0 {
+				e := i
+				if e > partStart && raw[e-1] == '\n' {
+					e--
+					if e > partStart && raw[e-1] == '\r' {
+						e--
+					}
+				}
+				spans = append(spans, [2]int{partStart, e})
+			}
+			if len(line) > len(delim) {
+				return spans
+			}
+			partStart = next
+		}
+		i = next
+	}
+	if partStart >= 0 && partStart < end {
+		spans = append(spans, [2]int{partStart, end})
+	}
+	return spans
+}
+
 // decodeSection attempts to decode the data from reader using the algorithm listed in
 // the Content-Transfer-Encoding header, returning the raw data if it does not known
 // the encoding type.
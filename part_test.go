@@ -2,9 +2,12 @@ package enmime
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -302,6 +305,101 @@ func TestMultiAnyParts(t *testing.T) {
 	assert.Nil(t, p.NextSibling(), "Second child should not have a sibling")
 }
 
+func TestRawPartOffsets(t *testing.T) {
+	raw, err := ioutil.ReadFile(filepath.Join("test-data", "parts", "nestedmulti.raw"))
+	if err != nil {
+		t.Fatalf("Failed to open test data: %v", err)
+	}
+	p, err := ParseMIME(openPart("nestedmulti.raw"))
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+
+	root := p.(RawMIMEPart)
+	start, end := root.Offsets()
+	assert.Equal(t, 0, start, "Root should start the document")
+	assert.Equal(t, len(raw), end, "Root should end the document")
+	assert.Equal(t, "Content-Type: multipart/alternative; boundary=\"Enmime-Test-100\"\n\n",
+		string(root.RawHeader()), "Root should have its header block")
+
+	// Every part is its header block followed by its content
+	parts := DepthMatchAll(root, func(p MIMEPart) bool { return true })
+	assert.Equal(t, 6, len(parts), "All parts should be found")
+	for _, p := range parts {
+		rp := p.(RawMIMEPart)
+		start, end := rp.Offsets()
+		assert.Equal(t, string(raw[start:end]), string(rp.RawHeader())+string(rp.RawContent()),
+			"Raw bytes should be the part range")
+	}
+
+	rp := root.FirstChild().(RawMIMEPart)
+	assert.Equal(t, "Content-Transfer-Encoding: 7bit\nContent-Type: text/plain; charset=us-ascii\n\n",
+		string(rp.RawHeader()), "First child should have its header block")
+	assert.Equal(t, "A text section", string(rp.RawContent()), "First child should have its content")
+
+	rp = rp.NextSibling().FirstChild().NextSibling().NextSibling().(RawMIMEPart)
+	assert.Equal(t, "Another inline text attachment", string(rp.RawContent()),
+		"Third nested should have its content")
+	start, _ = rp.Offsets()
+	assert.Equal(t, bytes.Index(raw, []byte("Content-Transfer-Encoding: 7bit\nContent-Disposition: inline\n")),
+		start, "Third nested should start after its delimiter")
+}
+
+func TestRawPartEncodedContent(t *testing.T) {
+	p, err := ParseMIME(openPart("multibase64.raw"))
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	rp := p.FirstChild().NextSibling().(RawMIMEPart)
+	assert.Contains(t, string(rp.Content()), "<html>", "Content should be decoded")
+	assert.NotContains(t, string(rp.RawContent()), "<html>", "Raw content should still be encoded")
+
+	rp = NewMIMEPart(nil, "text/plain")
+	start, end := rp.Offsets()
+	assert.Equal(t, -1, start, "Part without original should have no offsets")
+	assert.Equal(t, -1, end, "Part without original should have no offsets")
+	assert.Nil(t, rp.RawHeader(), "Part without original should have no raw header")
+}
+
+func TestRawPartCountMismatch(t *testing.T) {
+	p, err := ParseMIME(bufio.NewReader(strings.NewReader("Content-Type: multipart/mixed; boundary=b\n\n" +
+		"--b\n\nA\n--b\n\nB\n--b--\n")))
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	// Three delimited parts for two children
+	raw := []byte("Content-Type: multipart/mixed; boundary=b\n\n--b\n\nA\n--b\n\nB\n--b\n\nC\n--b--\n")
+	root := p.(*memMIMEPart)
+	root.locateRaw(raw, 0, len(raw), "b")
+	start, _ := root.Offsets()
+	assert.Equal(t, 0, start, "Root should keep its offsets")
+	for c := root.FirstChild(); c != nil; c = c.NextSibling() {
+		start, _ := c.(RawMIMEPart).Offsets()
+		assert.Equal(t, -1, start, "Children should have no offsets")
+	}
+}
+
+var rawBodyPartsTestTable = []struct {
+	body  string
+	spans []string
+}{
+	{"preamble\n--b\none\n--b\ntwo\n--b--\nepilogue", []string{"one", "two"}},
+	{"--b \t\r\none\r\n--b--\r\n", []string{"one"}},
+	{"--b\n--bx\n--b\n\n--b--", []string{"--bx", ""}},
+	{"x--b\none\n--b\ntruncated\n", []string{"truncated\n"}},
+	{"no delimiter", nil},
+}
+
+func TestRawBodyParts(t *testing.T) {
+	for _, tt := range rawBodyPartsTestTable {
+		var spans []string
+		for _, s := range rawBodyParts([]byte(tt.body), 0, len(tt.body), "b") {
+			spans = append(spans, tt.body[s[0]:s[1]])
+		}
+		assert.Equal(t, tt.spans, spans, tt.body)
+	}
+}
+
 // openPart is a test utility function to open a part as a reader
 func openPart(filename string) *bufio.Reader {
 	// Open test part for parsing
@@ -0,0 +1,183 @@
+package enmime
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+)
+
+// PGPSigned is the signed entity of a PGP/MIME multipart/signed part, with
+// what is needed to check its signature.
+type PGPSigned struct {
+	Content   MIMEPart // The signed entity
+	Signed    []byte   // Bytes covered by the signature, with CRLF line endings
+	Signature []byte   // The application/pgp-signature part, usually ASCII armored
+	MicAlg    string   // Hash announced by the micalg parameter, like "pgp-sha256"
+}
+
+// PGPDecrypted is the content of a PGP/MIME multipart/encrypted part.
+type PGPDecrypted struct {
+	Content  MIMEPart        // Parsed tree of the decrypted entity
+	Raw      []byte          // The decrypted entity, which may itself be multipart/signed
+	SignedBy *openpgp.Entity // Key that signed the encrypted data, nil if unsigned or unknown
+}
+
+// PGPBlock is an ASCII armored OpenPGP block found in a text body.
+type PGPBlock struct {
+	Type   string // Armor type, like "PGP MESSAGE" or "PGP SIGNED MESSAGE"
+	Text   string // The block, from its BEGIN line to its END line
+	Offset int    // Byte offset of the block in the text
+}
+
+var errNoPGP = errors.New("No PGP/MIME part found")
+
+// PGPSigned returns the first PGP/MIME signed entity of the message.  The
+// signature covers the exact bytes of the entity, so the message must have
+// been parsed with ReadMIMEBody.
+func (m *MIMEBody) PGPSigned() (*PGPSigned, error) {
+	p := m.findPart(func(p MIMEPart) bool {
+		ctype, params := m.partMediaType(p)
+		return ctype == "multipart/signed" &&
+			strings.ToLower(params["protocol"]) == "application/pgp-signature"
+	})
+	if p == nil {
+		return nil, errNoPGP
+	}
+	signed := p.FirstChild()
+	if signed == nil || signed.NextSibling() == nil {
+		return nil, errors.New("Malformed multipart/signed part")
+	}
+	content, err := signedBytes(signed)
+	if err != nil {
+		return nil, err
+	}
+	_, params := m.partMediaType(p)
+	return &PGPSigned{
+		Content:   signed,
+		Signed:    content,
+		Signature: signed.NextSibling().Content(),
+		MicAlg:    strings.ToLower(params["micalg"]),
+	}, nil
+}
+
+// Verify checks the signature against the keys of keyring, and returns the
+// key that made it.
+func (s *PGPSigned) Verify(keyring openpgp.KeyRing) (*openpgp.Entity, error) {
+	if sig := bytes.TrimSpace(s.Signature); bytes.HasPrefix(sig, []byte("-----BEGIN ")) {
+		return openpgp.CheckArmoredDetachedSignature(keyring, bytes.NewReader(s.Signed), bytes.NewReader(sig))
+	}
+	return openpgp.CheckDetachedSignature(keyring, bytes.NewReader(s.Signed), bytes.NewReader(s.Signature))
+}
+
+// VerifyPGP checks the first PGP/MIME signature of the message against the
+// keys of keyring, and returns the key that made it.
+func (m *MIMEBody) VerifyPGP(keyring openpgp.KeyRing) (*openpgp.Entity, error) {
+	s, err := m.PGPSigned()
+	if err != nil {
+		return nil, err
+	}
+	return s.Verify(keyring)
+}
+
+// DecryptPGP decrypts the first PGP/MIME multipart/encrypted part of the
+// message with the private keys of keyring, calling prompt for passphrases
+// as openpgp.ReadMessage does, and parses the decrypted entity into a new
+// tree.  Data that is also signed must carry a valid signature when the
+// signer is in keyring.
+func (m *MIMEBody) DecryptPGP(keyring openpgp.KeyRing, prompt openpgp.PromptFunction) (*PGPDecrypted, error) {
+	p := m.findPart(func(p MIMEPart) bool {
+		ctype, params := m.partMediaType(p)
+		return ctype == "multipart/encrypted" &&
+			strings.ToLower(params["protocol"]) == "application/pgp-encrypted"
+	})
+	if p == nil {
+		return nil, errNoPGP
+	}
+	// The first part only holds the version
+	version := p.FirstChild()
+	if version == nil || version.NextSibling() == nil {
+		return nil, errors.New("Malformed multipart/encrypted part")
+	}
+	data := version.NextSibling().Content()
+	var r io.Reader = bytes.NewReader(data)
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("-----BEGIN ")) {
+		block, err := armor.Decode(r)
+		if err != nil {
+			return nil, fmt.Errorf("Malformed PGP armor: %v", err)
+		}
+		r = block.Body
+	}
+
+	md, err := openpgp.ReadMessage(r, keyring, prompt, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to decrypt PGP message: %v", err)
+	}
+	raw, err := ioutil.ReadAll(md.UnverifiedBody)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to decrypt PGP message: %v", err)
+	}
+	d := &PGPDecrypted{Raw: raw}
+	if md.IsSigned && md.SignedBy != nil {
+		if md.SignatureError != nil {
+			return nil, fmt.Errorf("Bad signature of PGP message: %v", md.SignatureError)
+		}
+		d.SignedBy = md.SignedBy.Entity
+	}
+	if d.Content, err = ParseMIME(bufio.NewReader(bytes.NewReader(raw))); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// InlinePGP returns the ASCII armored OpenPGP blocks of the text body of the
+// message.
+func (m *MIMEBody) InlinePGP() []PGPBlock {
+	return FindPGPBlocks(m.Text)
+}
+
+// FindPGPBlocks returns the ASCII armored OpenPGP blocks of text, each one
+// starting with a "-----BEGIN PGP" line.  A clear signed message ends with
+// its signature, and a block without END line runs to the end of text.
+func FindPGPBlocks(text string) []PGPBlock {
+	var blocks []PGPBlock
+	for pos := 0; pos < len(text); {
+		i := strings.Index(text[pos:], "-----BEGIN PGP ")
+		if i < 0 {
+			break
+		}
+		start := pos + i
+		if start > 0 && text[start-1] != '\n' {
+			// Not at the beginning of a line
+			pos = start + 1
+			continue
+		}
+		line := text[start:]
+		if nl := strings.IndexByte(line, '\n'); nl >= 0 {
+			line = line[:nl]
+		}
+		line = strings.TrimRight(line, " \t\r")
+		if !strings.HasSuffix(line, "-----") || len(line) <= len("-----BEGIN ")+len("-----") {
+			pos = start + 1
+			continue
+		}
+		typ := line[len("-----BEGIN ") : len(line)-len("-----")]
+		endType := typ
+		if typ == "PGP SIGNED MESSAGE" {
+			endType = "PGP SIGNATURE"
+		}
+		end := len(text)
+		if j := strings.Index(text[start:], "\n-----END "+endType+"-----"); j >= 0 {
+			end = start + j + len("\n-----END "+endType+"-----")
+		}
+		blocks = append(blocks, PGPBlock{Type: typ, Text: text[start:end], Offset: start})
+		pos = end
+	}
+	return blocks
+}
@@ -0,0 +1,150 @@
+package enmime
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cention-sany/net/mail"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/openpgp"
+)
+
+func readPGPMessage(t *testing.T, filename string) *MIMEBody {
+	f, err := os.Open(filepath.Join("test-data", "pgp", filename))
+	if err != nil {
+		t.Fatalf("Failed to open test data: %v", err)
+	}
+	defer f.Close()
+	m, err := ReadMIMEBody(f)
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+	return m
+}
+
+func readPGPKeyRing(t *testing.T, filename string) openpgp.EntityList {
+	f, err := os.Open(filepath.Join("test-data", "pgp", filename))
+	if err != nil {
+		t.Fatalf("Failed to open test data: %v", err)
+	}
+	defer f.Close()
+	keyring, err := openpgp.ReadArmoredKeyRing(f)
+	if err != nil {
+		t.Fatalf("Failed to read key ring: %v", err)
+	}
+	return keyring
+}
+
+func TestPGPSigned(t *testing.T) {
+	m := readPGPMessage(t, "signed.raw")
+	s, err := m.PGPSigned()
+	if err != nil {
+		t.Fatalf("Failed to find signed part: %v", err)
+	}
+	assert.Equal(t, "pgp-sha256", s.MicAlg)
+	assert.Equal(t, "text/plain", s.Content.ContentType())
+	assert.True(t, strings.HasPrefix(string(s.Signed),
+		"Content-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\n"))
+	assert.True(t, strings.HasSuffix(string(s.Signed), "Gr=C3=BC=C3=9Fe, Alice\r\n"))
+	assert.True(t, bytes.HasPrefix(s.Signature, []byte("-----BEGIN PGP SIGNATURE-----")))
+
+	msg, err := mail.ReadMessage(bytes.NewReader(m.Raw()))
+	if err != nil {
+		t.Fatalf("Failed to read message: %v", err)
+	}
+	m, err = ParseMIMEBody(msg)
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+	_, err = m.PGPSigned()
+	assert.Equal(t, errNoRawMessage, err)
+
+	m = readPGPMessage(t, "inline.raw")
+	_, err = m.PGPSigned()
+	assert.Equal(t, errNoPGP, err)
+}
+
+func TestVerifyPGP(t *testing.T) {
+	alice := readPGPKeyRing(t, "alice-secret.asc")
+	mallory := readPGPKeyRing(t, "mallory-public.asc")
+
+	m := readPGPMessage(t, "signed.raw")
+	signer, err := m.VerifyPGP(alice)
+	if assert.Nil(t, err) {
+		assert.Contains(t, signer.Identities, "Alice <alice@example.com>")
+	}
+
+	_, err = m.VerifyPGP(mallory)
+	assert.NotNil(t, err)
+
+	m, err = ReadMIMEBody(bytes.NewReader(
+		bytes.Replace(m.Raw(), []byte("signed with"), []byte("forged with"), 1)))
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+	_, err = m.VerifyPGP(alice)
+	assert.NotNil(t, err)
+}
+
+func TestDecryptPGP(t *testing.T) {
+	m := readPGPMessage(t, "encrypted.raw")
+	d, err := m.DecryptPGP(readPGPKeyRing(t, "alice-secret.asc"), nil)
+	if err != nil {
+		t.Fatalf("Failed to decrypt: %v", err)
+	}
+	if assert.NotNil(t, d.SignedBy) {
+		assert.Contains(t, d.SignedBy.Identities, "Alice <alice@example.com>")
+	}
+	assert.True(t, strings.HasPrefix(string(d.Raw), "Content-Type: multipart/mixed"))
+	assert.Equal(t, "multipart/mixed", d.Content.ContentType())
+	text := d.Content.FirstChild()
+	if assert.NotNil(t, text) {
+		assert.Equal(t, "Secret text.", string(text.Content()))
+		if att := text.NextSibling(); assert.NotNil(t, att) {
+			assert.Equal(t, "data.bin", att.FileName())
+			assert.Equal(t, []byte{0, 1, 2, 3}, att.Content())
+		}
+	}
+
+	_, err = m.DecryptPGP(readPGPKeyRing(t, "mallory-public.asc"), nil)
+	assert.NotNil(t, err)
+}
+
+func TestInlinePGP(t *testing.T) {
+	m := readPGPMessage(t, "inline.raw")
+	blocks := m.InlinePGP()
+	if !assert.Len(t, blocks, 2) {
+		return
+	}
+	assert.Equal(t, "PGP SIGNED MESSAGE", blocks[0].Type)
+	assert.Equal(t, 0, blocks[0].Offset)
+	assert.True(t, strings.HasSuffix(blocks[0].Text, "-----END PGP SIGNATURE-----"))
+	assert.Equal(t, "PGP PUBLIC KEY BLOCK", blocks[1].Type)
+	assert.Equal(t, blocks[1].Text, m.Text[blocks[1].Offset:blocks[1].Offset+len(blocks[1].Text)])
+	assert.True(t, strings.HasSuffix(blocks[1].Text, "-----END PGP PUBLIC KEY BLOCK-----"))
+}
+
+var pgpBlockTestTable = []struct {
+	text  string
+	types []string
+}{
+	{"no block", nil},
+	{"> -----BEGIN PGP MESSAGE-----\n> quoted\n", nil},
+	{"-----BEGIN PGP MESSAGE-----\n\nhQEM\n-----END PGP MESSAGE-----\n", []string{"PGP MESSAGE"}},
+	{"text\r\n-----BEGIN PGP MESSAGE-----\r\n\r\ntruncated", []string{"PGP MESSAGE"}},
+	{"-----BEGIN PGP SIGNATURE-----\n\niQE\n-----END PGP SIGNATURE-----\n" +
+		"-----BEGIN PGP MESSAGE-----\n\nhQEM\n-----END PGP MESSAGE-----", []string{"PGP SIGNATURE", "PGP MESSAGE"}},
+}
+
+func TestFindPGPBlocks(t *testing.T) {
+	for _, tt := range pgpBlockTestTable {
+		var types []string
+		for _, b := range FindPGPBlocks(tt.text) {
+			types = append(types, b.Type)
+		}
+		assert.Equal(t, tt.types, types, tt.text)
+	}
+}
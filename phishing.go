@@ -0,0 +1,325 @@
+package enmime
+
+import (
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/idna"
+)
+
+// LinkIssue describes why a link in an HTML body looks suspicious.
+type LinkIssue string
+
+// Issues reported by AnalyzeLinks
+const (
+	LinkTextMismatch LinkIssue = "text-mismatch" // Visible text names a different domain than the href
+	LinkRawIP        LinkIssue = "raw-ip"        // Href points to an IP address instead of a host name
+	LinkPunycode     LinkIssue = "punycode"      // Href host contains punycode (xn--) labels
+	LinkHomoglyph    LinkIssue = "homoglyph"     // Href host mixes scripts or uses lookalike characters
+	LinkShortener    LinkIssue = "shortener"     // Href host is a known URL shortener
+)
+
+// SuspiciousLink is an anchor of an HTML body that raised one or more issues.
+type SuspiciousLink struct {
+	Text   string      // Visible text of the anchor
+	Href   string      // Raw href attribute
+	Host   string      // Host of the href, converted to Unicode
+	Issues []LinkIssue // Reasons this link was reported
+}
+
+// URLShorteners enumerates the host names reported as LinkShortener.
+var URLShorteners = []string{
+	"bit.ly", "bitly.com", "goo.gl", "t.co", "tinyurl.com", "ow.ly", "is.gd",
+	"buff.ly", "rebrand.ly", "cutt.ly", "shorturl.at", "rb.gy", "tiny.cc",
+	"bl.ink", "lnkd.in", "t.ly", "v.gd", "s.id", "soo.gd", "clck.ru", "qr.ae",
+	"adf.ly", "shorte.st", "x.co", "mcaf.ee", "su.pr", "tr.im", "db.tt",
+}
+
+var linkTextDomainRegexp = regexp.MustCompile(
+	`(?i)^(?:[a-z][a-z0-9+.-]*://)?(?:www\.)?((?:[\p{L}\p{N}](?:[\p{L}\p{N}-]*[\p{L}\p{N}])?\.)+[\p{L}]{2,}|\d{1,3}(?:\.\d{1,3}){3})(?::\d+)?(?:[/?#]\S*)?$`)
+
+// AnalyzeLinks walks the anchors of the given HTML body and reports the ones
+// whose visible text names another domain than their href, or whose href
+// points to a raw IP address, a punycode or homoglyph domain, or a URL
+// shortener.
+func AnalyzeLinks(htmlBody string) ([]SuspiciousLink, error) {
+	doc, err := html.Parse(strings.NewReader(htmlBody))
+	if err != nil {
+		return nil, err
+	}
+	var links []SuspiciousLink
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.DataAtom == atom.A {
+			if href, ok := nodeAttr(n, "href"); ok {
+				if l := analyzeLink(nodeText(n), href); len(l.Issues) > 0 {
+					links = append(links, l)
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	return links, nil
+}
+
+// SuspiciousLinks runs AnalyzeLinks over the HTML body of the message.
+func (m *MIMEBody) SuspiciousLinks() ([]SuspiciousLink, error) {
+	if m.HTML == "" {
+		return nil, nil
+	}
+	return AnalyzeLinks(m.HTML)
+}
+
+func analyzeLink(text, href string) SuspiciousLink {
+	l := SuspiciousLink{Text: text, Href: href}
+	u, err := url.Parse(strings.TrimSpace(href))
+	if err != nil {
+		return l
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https", "ftp":
+	default:
+		return l
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "" {
+		return l
+	}
+	l.Host = host
+	if isRawIPHost(host) {
+		l.Issues = append(l.Issues, LinkRawIP)
+	} else {
+		uhost := host
+		if hasPunycodeLabel(host) {
+			l.Issues = append(l.Issues, LinkPunycode)
+			if h, err := idna.ToUnicode(host); err == nil {
+				uhost = h
+			}
+		}
+		l.Host = uhost
+		if isHomoglyphDomain(uhost) {
+			l.Issues = append(l.Issues, LinkHomoglyph)
+		}
+		if isURLShortener(host) {
+			l.Issues = append(l.Issues, LinkShortener)
+		}
+	}
+	if textHost := domainFromLinkText(text); textHost != "" {
+		if !sameRegisteredDomain(textHost, l.Host) && !sameRegisteredDomain(textHost, host) {
+			l.Issues = append(l.Issues, LinkTextMismatch)
+		}
+	}
+	return l
+}
+
+// domainFromLinkText returns the lower-cased host name if the visible text
+// of a link looks like an URL or a bare domain.
+func domainFromLinkText(text string) string {
+	m := linkTextDomainRegexp.FindStringSubmatch(strings.TrimSpace(text))
+	if m == nil {
+		return ""
+	}
+	host := strings.ToLower(m[1])
+	if hasPunycodeLabel(host) {
+		if h, err := idna.ToUnicode(host); err == nil {
+			host = h
+		}
+	}
+	return host
+}
+
+// isRawIPHost detects dotted IPv4, IPv6 and the integer or hex forms of an
+// IPv4 address browsers accept, e.g. http://3232235777/.
+func isRawIPHost(host string) bool {
+	if net.ParseIP(host) != nil {
+		return true
+	}
+	h := strings.TrimPrefix(host, "0x")
+	if h == "" {
+		return false
+	}
+	for _, r := range h {
+		if !unicode.IsDigit(r) && !(host != h && strings.ContainsRune("abcdef", r)) {
+			return false
+		}
+	}
+	return true
+}
+
+func hasPunycodeLabel(host string) bool {
+	for _, label := range strings.Split(host, ".") {
+		if strings.HasPrefix(label, "xn--") {
+			return true
+		}
+	}
+	return false
+}
+
+func isURLShortener(host string) bool {
+	host = strings.TrimPrefix(host, "www.")
+	for _, s := range URLShorteners {
+		if host == s {
+			return true
+		}
+	}
+	return false
+}
+
+// isHomoglyphDomain reports whether any label of the domain mixes letters of
+// different scripts, e.g. a Cyrillic "а" in "аpple", or only uses non-ASCII
+// letters that all have an ASCII lookalike, e.g. an all Cyrillic "рау".
+func isHomoglyphDomain(host string) bool {
+	for _, label := range strings.Split(host, ".") {
+		if len(scriptsOf(label)) > 1 {
+			return true
+		}
+		if isASCII(label) {
+			continue
+		}
+		allConfusable := true
+		for _, r := range label {
+			if r < 0x80 {
+				continue
+			}
+			if _, ok := confusables[r]; !ok {
+				allConfusable = false
+				break
+			}
+		}
+		if allConfusable {
+			return true
+		}
+	}
+	return false
+}
+
+// registeredDomain approximates the registrable part of a host name: the last
+// two labels, or three when the second-level label is a common generic one
+// below a country code, as in example.co.uk.
+func registeredDomain(host string) string {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	labels := strings.Split(host, ".")
+	n := 2
+	if len(labels) > 2 && len(labels[len(labels)-1]) == 2 {
+		switch labels[len(labels)-2] {
+		case "co", "com", "net", "org", "gov", "ac", "edu", "ne", "or", "go":
+			n = 3
+		}
+	}
+	if len(labels) <= n {
+		return host
+	}
+	return strings.Join(labels[len(labels)-n:], ".")
+}
+
+func sameRegisteredDomain(a, b string) bool {
+	return registeredDomain(a) == registeredDomain(b)
+}
+
+// nodeAttr returns the value of the named attribute of an element.
+func nodeAttr(n *html.Node, key string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Namespace == "" && strings.ToLower(a.Key) == key {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+// nodeText returns the text content of n with whitespace collapsed.
+func nodeText(n *html.Node) string {
+	var b strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+			b.WriteByte(' ')
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// Scripts considered when looking for mixed-script strings.
+var letterScripts = []struct {
+	name  string
+	table *unicode.RangeTable
+}{
+	{"Latin", unicode.Latin},
+	{"Cyrillic", unicode.Cyrillic},
+	{"Greek", unicode.Greek},
+	{"Armenian", unicode.Armenian},
+	{"Hebrew", unicode.Hebrew},
+	{"Arabic", unicode.Arabic},
+	{"Cherokee", unicode.Cherokee},
+	{"Han", unicode.Han},
+	{"Hiragana", unicode.Hiragana},
+	{"Katakana", unicode.Katakana},
+	{"Hangul", unicode.Hangul},
+	{"Thai", unicode.Thai},
+	{"Georgian", unicode.Georgian},
+	{"Devanagari", unicode.Devanagari},
+}
+
+// scriptsOf returns the names of the scripts used by the letters of s.  Han,
+// Hiragana and Katakana are reported as one script since Japanese mixes them.
+func scriptsOf(s string) []string {
+	var scripts []string
+	seen := make(map[string]bool)
+	for _, r := range s {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		for _, ls := range letterScripts {
+			if unicode.Is(ls.table, r) {
+				name := ls.name
+				switch name {
+				case "Han", "Hiragana", "Katakana":
+					name = "Han"
+				}
+				if !seen[name] {
+					seen[name] = true
+					scripts = append(scripts, name)
+				}
+				break
+			}
+		}
+	}
+	return scripts
+}
+
+// confusables maps non-Latin letters to the Latin letter they look like.
+var confusables = map[rune]rune{
+	// Cyrillic
+	'а': 'a', 'в': 'b', 'с': 'c', 'ԁ': 'd', 'е': 'e', 'һ': 'h', 'і': 'i', 'ј': 'j',
+	'к': 'k', 'ӏ': 'l', 'м': 'm', 'п': 'n', 'о': 'o', 'р': 'p', 'ԛ': 'q', 'г': 'r',
+	'ѕ': 's', 'т': 't', 'џ': 'u', 'ѵ': 'v', 'ԝ': 'w', 'х': 'x', 'у': 'y', 'ӡ': 'z',
+	'ё': 'e', 'ї': 'i',
+	// Greek
+	'α': 'a', 'β': 'b', 'ε': 'e', 'η': 'n', 'ι': 'i', 'κ': 'k', 'ν': 'v', 'ο': 'o',
+	'ρ': 'p', 'τ': 't', 'υ': 'u', 'χ': 'x', 'γ': 'y', 'ω': 'w',
+	// Armenian
+	'օ': 'o', 'ս': 'u', 'հ': 'h', 'ո': 'n', 'ց': 'g', 'զ': 'q',
+	// Latin lookalikes outside of ASCII
+	'ı': 'i', 'ɑ': 'a', 'ɡ': 'g', 'ł': 'l', 'ƅ': 'b', 'ɩ': 'i', 'ʏ': 'y',
+}
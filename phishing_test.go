@@ -0,0 +1,76 @@
+package enmime
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnalyzeLinks(t *testing.T) {
+	var testTable = []struct {
+		text, href string
+		expect     []LinkIssue
+	}{
+		{"Click here", "https://www.example.com/login", nil},
+		{"www.example.com", "https://login.example.com/", nil},
+		{"https://www.paypal.com/", "http://paypal.com.evil.example/", []LinkIssue{LinkTextMismatch}},
+		{"paypal.com", "https://evil.example/", []LinkIssue{LinkTextMismatch}},
+		{"Your account", "http://192.168.10.20/login", []LinkIssue{LinkRawIP}},
+		{"Your account", "http://[::1]/login", []LinkIssue{LinkRawIP}},
+		{"Your account", "http://3232235777/", []LinkIssue{LinkRawIP}},
+		{"Your account", "http://0xC0A80001/", []LinkIssue{LinkRawIP}},
+		{"apple.com", "https://xn--pple-43d.com/", []LinkIssue{LinkPunycode, LinkHomoglyph, LinkTextMismatch}},
+		{"Your bank", "https://xn--80ak6aa92e.com/", []LinkIssue{LinkPunycode, LinkHomoglyph}},
+		{"Your bank", "https://xn--mnchen-3ya.de/", []LinkIssue{LinkPunycode}},
+		{"Details", "https://bit.ly/abc123", []LinkIssue{LinkShortener}},
+		{"bit.ly/abc123", "https://bit.ly/abc123", []LinkIssue{LinkShortener}},
+		{"example.com", "mailto:someone@other.example", nil},
+		{"example.com", "#top", nil},
+	}
+
+	for _, tt := range testTable {
+		body := `<p>Dear customer, <a href="` + tt.href + `"><b>` + tt.text + `</b></a></p>`
+		links, err := AnalyzeLinks(body)
+		if err != nil {
+			t.Fatalf("Failed to analyze links: %v", err)
+		}
+		if tt.expect == nil {
+			assert.Empty(t, links, "No issues expected for %q -> %q", tt.text, tt.href)
+			continue
+		}
+		if assert.Equal(t, 1, len(links), "Expected one link for %q -> %q", tt.text, tt.href) {
+			assert.Equal(t, tt.text, links[0].Text)
+			assert.Equal(t, tt.href, links[0].Href)
+			assert.Equal(t, tt.expect, links[0].Issues, "Issues for %q -> %q", tt.text, tt.href)
+		}
+	}
+}
+
+func TestAnalyzeLinksHost(t *testing.T) {
+	links, err := AnalyzeLinks(`<a href="https://xn--pple-43d.com/">x</a>`)
+	if err != nil {
+		t.Fatalf("Failed to analyze links: %v", err)
+	}
+	if assert.Equal(t, 1, len(links)) {
+		assert.Equal(t, "аpple.com", links[0].Host, "Host should be converted to Unicode")
+	}
+}
+
+func TestSuspiciousLinks(t *testing.T) {
+	msg := readMessage("html-mime-inline.raw")
+	mime, err := ParseMIMEBody(msg)
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+
+	links, err := mime.SuspiciousLinks()
+	assert.Nil(t, err)
+	assert.Empty(t, links, "Message has no links")
+
+	mime.HTML = `<a href="http://10.0.0.1/">www.example.com</a>`
+	links, err = mime.SuspiciousLinks()
+	assert.Nil(t, err)
+	if assert.Equal(t, 1, len(links)) {
+		assert.Equal(t, []LinkIssue{LinkRawIP, LinkTextMismatch}, links[0].Issues)
+	}
+}
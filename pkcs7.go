@@ -0,0 +1,558 @@
+package enmime
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	_ "crypto/sha1" // Registers the digests of SignedData
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+var (
+	oidPKCS7SignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidPKCS7EnvelopedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 3}
+
+	oidAttributeContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidAttributeMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+
+	oidRSAEncryption = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidRSAESOAEP     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 7}
+	oidRSASSAPSS     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 10}
+	oidMGF1          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 8}
+	oidPSpecified    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 9}
+
+	oidAES128CBC    = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC    = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC    = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+	oidDESEDE3CBC   = asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}
+	oidDESCBC       = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 7}
+	pkcs7DigestOIDs = []struct {
+		oid  asn1.ObjectIdentifier
+		hash crypto.Hash
+	}{
+		{asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}, crypto.SHA1},
+		{asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}, crypto.SHA256},
+		{asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}, crypto.SHA384},
+		{asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}, crypto.SHA512},
+		{asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 4}, crypto.SHA224},
+	}
+)
+
+var (
+	errPKCS7Truncated = errors.New("Truncated PKCS #7 data")
+	errPKCS7TooDeep   = errors.New("PKCS #7 data nested too deeply")
+)
+
+// Nesting depth of BER elements berToDER accepts, far beyond what CMS
+// structures need
+const maxBERDepth = 64
+
+type pkcs7ContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+type pkcs7SignedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	ContentInfo      pkcs7ContentInfo
+	Certificates     asn1.RawValue     `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue     `asn1:"optional,tag:1"`
+	SignerInfos      []pkcs7SignerInfo `asn1:"set"`
+}
+
+type pkcs7SignerInfo struct {
+	Version                   int
+	SID                       asn1.RawValue
+	DigestAlgorithm           pkix.AlgorithmIdentifier
+	AuthenticatedAttributes   asn1.RawValue `asn1:"optional,tag:0"`
+	DigestEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedDigest           []byte
+	UnauthenticatedAttributes asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type pkcs7Attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue `asn1:"set"`
+}
+
+type pkcs7IssuerAndSerial struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type pkcs7EnvelopedData struct {
+	Version              int
+	OriginatorInfo       asn1.RawValue   `asn1:"optional,tag:0"`
+	RecipientInfos       []asn1.RawValue `asn1:"set"`
+	EncryptedContentInfo pkcs7EncryptedContentInfo
+}
+
+type pkcs7KeyTransRecipientInfo struct {
+	Version                int
+	RID                    asn1.RawValue
+	KeyEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedKey           []byte
+}
+
+// RSAES-OAEP-params of RFC 4055, whose absent fields stand for SHA-1, MGF1
+// with SHA-1 and an empty label
+type pkcs7OAEPParams struct {
+	HashFunc    pkix.AlgorithmIdentifier `asn1:"optional,explicit,tag:0"`
+	MaskGenFunc pkix.AlgorithmIdentifier `asn1:"optional,explicit,tag:1"`
+	PSourceFunc pkix.AlgorithmIdentifier `asn1:"optional,explicit,tag:2"`
+}
+
+type pkcs7EncryptedContentInfo struct {
+	ContentType                asn1.ObjectIdentifier
+	ContentEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedContent           asn1.RawValue `asn1:"optional,tag:0"`
+}
+
+// VerifyPKCS7 verifies a PKCS #7 (CMS) SignedData structure in DER or BER
+// form, as found in S/MIME application/pkcs7-signature and pkcs7-mime parts.
+// A detached signature needs the signed content; otherwise content is nil and
+// the content embedded in the structure is returned.  Every signature must
+// match, and the certificate of every signer must chain to roots, or to the
+// system roots if roots is nil.  The signer certificates are returned.
+func VerifyPKCS7(der, content []byte, roots *x509.CertPool) ([]*x509.Certificate, []byte, error) {
+	data, err := pkcs7Content(der, oidPKCS7SignedData)
+	if err != nil {
+		return nil, nil, err
+	}
+	var sd pkcs7SignedData
+	if _, err := asn1.Unmarshal(data, &sd); err != nil {
+		return nil, nil, fmt.Errorf("Malformed PKCS #7 SignedData: %v", err)
+	}
+	if content == nil {
+		if len(sd.ContentInfo.Content.Bytes) > 0 {
+			if _, err := asn1.Unmarshal(sd.ContentInfo.Content.Bytes, &content); err != nil {
+				return nil, nil, fmt.Errorf("Malformed PKCS #7 content: %v", err)
+			}
+		}
+		if content == nil {
+			return nil, nil, errors.New("Detached PKCS #7 signature without content")
+		}
+	}
+	if len(sd.SignerInfos) == 0 {
+		return nil, nil, errors.New("PKCS #7 SignedData without signer")
+	}
+	var certs []*x509.Certificate
+	if len(sd.Certificates.Bytes) > 0 {
+		if certs, err = x509.ParseCertificates(sd.Certificates.Bytes); err != nil {
+			return nil, nil, fmt.Errorf("Malformed PKCS #7 certificates: %v", err)
+		}
+	}
+	intermediates := x509.NewCertPool()
+	for _, c := range certs {
+		intermediates.AddCert(c)
+	}
+
+	var signers []*x509.Certificate
+	for _, si := range sd.SignerInfos {
+		cert := pkcs7FindCertificate(certs, si.SID)
+		if cert == nil {
+			return nil, nil, errors.New("Signer certificate not found in PKCS #7 data")
+		}
+		if err := pkcs7VerifySigner(si, cert, content, sd.ContentInfo.ContentType); err != nil {
+			return nil, nil, err
+		}
+		_, err := cert.Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection},
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("Signer certificate not trusted: %v", err)
+		}
+		signers = append(signers, cert)
+	}
+	return signers, content, nil
+}
+
+// pkcs7VerifySigner checks the signature of one signer over content of type
+// contentType, through the signed attributes if there are any.
+func pkcs7VerifySigner(si pkcs7SignerInfo, cert *x509.Certificate, content []byte,
+	contentType asn1.ObjectIdentifier) error {
+	hash := pkcs7Hash(si.DigestAlgorithm.Algorithm)
+	if hash == 0 {
+		return fmt.Errorf("Unsupported PKCS #7 digest algorithm %v", si.DigestAlgorithm.Algorithm)
+	}
+	signed := content
+	if len(si.AuthenticatedAttributes.FullBytes) > 0 {
+		// The attributes are signed as a SET OF, not with their implicit tag
+		signed = append([]byte{0x31}, si.AuthenticatedAttributes.FullBytes[1:]...)
+		var attrs []pkcs7Attribute
+		if _, err := asn1.UnmarshalWithParams(signed, &attrs, "set"); err != nil {
+			return fmt.Errorf("Malformed PKCS #7 signed attributes: %v", err)
+		}
+		var digest []byte
+		var ctype asn1.ObjectIdentifier
+		for _, a := range attrs {
+			switch {
+			case a.Type.Equal(oidAttributeMessageDigest):
+				if _, err := asn1.Unmarshal(a.Values.Bytes, &digest); err != nil {
+					return fmt.Errorf("Malformed PKCS #7 message digest: %v", err)
+				}
+			case a.Type.Equal(oidAttributeContentType):
+				if _, err := asn1.Unmarshal(a.Values.Bytes, &ctype); err != nil {
+					return fmt.Errorf("Malformed PKCS #7 content type: %v", err)
+				}
+			}
+		}
+		// RFC 5652 section 5.3 requires the content type among the signed
+		// attributes, so it cannot be swapped
+		if !ctype.Equal(contentType) {
+			return errors.New("PKCS #7 content type attribute missing or mismatched")
+		}
+		h := hash.New()
+		h.Write(content)
+		if digest == nil || !bytes.Equal(digest, h.Sum(nil)) {
+			return errors.New("PKCS #7 message digest mismatch")
+		}
+	}
+
+	sig := si.EncryptedDigest
+	var err error
+	switch pub := cert.PublicKey.(type) {
+	case ed25519.PublicKey:
+		if !ed25519.Verify(pub, signed, sig) {
+			err = errors.New("ed25519 verification failure")
+		}
+	case *rsa.PublicKey:
+		h := hash.New()
+		h.Write(signed)
+		if si.DigestEncryptionAlgorithm.Algorithm.Equal(oidRSASSAPSS) {
+			err = rsa.VerifyPSS(pub, hash, h.Sum(nil), sig, nil)
+		} else {
+			err = rsa.VerifyPKCS1v15(pub, hash, h.Sum(nil), sig)
+		}
+	case *ecdsa.PublicKey:
+		h := hash.New()
+		h.Write(signed)
+		var rs struct{ R, S *big.Int }
+		if _, err = asn1.Unmarshal(sig, &rs); err == nil && !ecdsa.Verify(pub, h.Sum(nil), rs.R, rs.S) {
+			err = errors.New("ECDSA verification failure")
+		}
+	default:
+		err = fmt.Errorf("unsupported key type %T", pub)
+	}
+	if err != nil {
+		return fmt.Errorf("PKCS #7 signature of %q does not match: %v", cert.Subject.CommonName, err)
+	}
+	return nil
+}
+
+// DecryptPKCS7 decrypts a PKCS #7 (CMS) EnvelopedData structure in DER or BER
+// form, as found in S/MIME application/pkcs7-mime parts, with the private key
+// of a recipient.  The recipient is looked up by cert; if cert is nil every
+// recipient is tried.  Keys are transported with RSA, PKCS #1 v1.5 or OAEP,
+// and content is encrypted with AES or DES in CBC mode.
+func DecryptPKCS7(der []byte, cert *x509.Certificate, key crypto.Decrypter) ([]byte, error) {
+	data, err := pkcs7Content(der, oidPKCS7EnvelopedData)
+	if err != nil {
+		return nil, err
+	}
+	var ed pkcs7EnvelopedData
+	if _, err := asn1.Unmarshal(data, &ed); err != nil {
+		return nil, fmt.Errorf("Malformed PKCS #7 EnvelopedData: %v", err)
+	}
+	eci := ed.EncryptedContentInfo
+	ciphertext := eci.EncryptedContent.Bytes
+	if eci.EncryptedContent.IsCompound {
+		// Encrypted content in chunks
+		ciphertext = nil
+		for rest := eci.EncryptedContent.Bytes; len(rest) > 0; {
+			var chunk []byte
+			if rest, err = asn1.Unmarshal(rest, &chunk); err != nil {
+				return nil, fmt.Errorf("Malformed PKCS #7 encrypted content: %v", err)
+			}
+			ciphertext = append(ciphertext, chunk...)
+		}
+	}
+
+	err = errors.New("No PKCS #7 recipient matches the certificate")
+	for _, raw := range ed.RecipientInfos {
+		var ri pkcs7KeyTransRecipientInfo
+		if _, perr := asn1.Unmarshal(raw.FullBytes, &ri); perr != nil {
+			// Key agreement and other recipient types
+			continue
+		}
+		if cert != nil && !pkcs7MatchCertificate(cert, ri.RID) {
+			continue
+		}
+		var opts crypto.DecrypterOpts = &rsa.PKCS1v15DecryptOptions{}
+		switch {
+		case ri.KeyEncryptionAlgorithm.Algorithm.Equal(oidRSAESOAEP):
+			if opts, err = pkcs7OAEPOptions(ri.KeyEncryptionAlgorithm.Parameters); err != nil {
+				continue
+			}
+		case !ri.KeyEncryptionAlgorithm.Algorithm.Equal(oidRSAEncryption):
+			err = fmt.Errorf("Unsupported PKCS #7 key encryption algorithm %v",
+				ri.KeyEncryptionAlgorithm.Algorithm)
+			continue
+		}
+		var cek, plain []byte
+		if cek, err = key.Decrypt(rand.Reader, ri.EncryptedKey, opts); err != nil {
+			err = fmt.Errorf("Unable to decrypt PKCS #7 content key: %v", err)
+			continue
+		}
+		if plain, err = pkcs7DecryptContent(eci.ContentEncryptionAlgorithm, cek, ciphertext); err == nil {
+			return plain, nil
+		}
+	}
+	return nil, err
+}
+
+// pkcs7OAEPOptions returns the decryption options of the RSAES-OAEP-params
+// params.  MGF1 must use the same hash as OAEP itself.
+func pkcs7OAEPOptions(params asn1.RawValue) (*rsa.OAEPOptions, error) {
+	var p pkcs7OAEPParams
+	if len(params.FullBytes) > 0 && params.Tag != asn1.TagNull {
+		if rest, err := asn1.Unmarshal(params.FullBytes, &p); err != nil || len(rest) > 0 {
+			return nil, errors.New("Malformed PKCS #7 RSAES-OAEP parameters")
+		}
+	}
+	opts := &rsa.OAEPOptions{Hash: crypto.SHA1}
+	if len(p.HashFunc.Algorithm) > 0 {
+		opts.Hash = pkcs7Hash(p.HashFunc.Algorithm)
+	}
+	mgfHash := crypto.SHA1
+	if len(p.MaskGenFunc.Algorithm) > 0 {
+		var alg pkix.AlgorithmIdentifier
+		if !p.MaskGenFunc.Algorithm.Equal(oidMGF1) {
+			return nil, fmt.Errorf("Unsupported PKCS #7 mask generation function %v", p.MaskGenFunc.Algorithm)
+		}
+		if _, err := asn1.Unmarshal(p.MaskGenFunc.Parameters.FullBytes, &alg); err != nil {
+			return nil, errors.New("Malformed PKCS #7 RSAES-OAEP parameters")
+		}
+		mgfHash = pkcs7Hash(alg.Algorithm)
+	}
+	if opts.Hash == 0 || !opts.Hash.Available() || mgfHash != opts.Hash {
+		return nil, errors.New("Unsupported PKCS #7 RSAES-OAEP hash")
+	}
+	if len(p.PSourceFunc.Algorithm) > 0 {
+		if !p.PSourceFunc.Algorithm.Equal(oidPSpecified) {
+			return nil, fmt.Errorf("Unsupported PKCS #7 OAEP label source %v", p.PSourceFunc.Algorithm)
+		}
+		if _, err := asn1.Unmarshal(p.PSourceFunc.Parameters.FullBytes, &opts.Label); err != nil {
+			return nil, errors.New("Malformed PKCS #7 RSAES-OAEP parameters")
+		}
+	}
+	return opts, nil
+}
+
+func pkcs7DecryptContent(alg pkix.AlgorithmIdentifier, key, ciphertext []byte) ([]byte, error) {
+	var keyLen int
+	var newCipher func([]byte) (cipher.Block, error)
+	switch {
+	case alg.Algorithm.Equal(oidAES128CBC):
+		keyLen, newCipher = 16, aes.NewCipher
+	case alg.Algorithm.Equal(oidAES192CBC):
+		keyLen, newCipher = 24, aes.NewCipher
+	case alg.Algorithm.Equal(oidAES256CBC):
+		keyLen, newCipher = 32, aes.NewCipher
+	case alg.Algorithm.Equal(oidDESEDE3CBC):
+		keyLen, newCipher = 24, des.NewTripleDESCipher
+	case alg.Algorithm.Equal(oidDESCBC):
+		keyLen, newCipher = 8, des.NewCipher
+	default:
+		return nil, fmt.Errorf("Unsupported PKCS #7 content encryption algorithm %v", alg.Algorithm)
+	}
+	if len(key) != keyLen {
+		return nil, errors.New("Invalid PKCS #7 content key")
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(alg.Parameters.FullBytes, &iv); err != nil {
+		return nil, fmt.Errorf("Malformed PKCS #7 initialization vector: %v", err)
+	}
+	block, err := newCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	bs := block.BlockSize()
+	if len(iv) != bs || len(ciphertext) == 0 || len(ciphertext)%bs != 0 {
+		return nil, errors.New("Invalid PKCS #7 encrypted content")
+	}
+	plain := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, ciphertext)
+	pad := int(plain[len(plain)-1])
+	if pad == 0 || pad > bs {
+		return nil, errors.New("Invalid PKCS #7 padding, wrong key?")
+	}
+	for _, b := range plain[len(plain)-pad:] {
+		if int(b) != pad {
+			return nil, errors.New("Invalid PKCS #7 padding, wrong key?")
+		}
+	}
+	return plain[:len(plain)-pad], nil
+}
+
+// pkcs7Content returns the content of a ContentInfo of the given type.
+func pkcs7Content(der []byte, contentType asn1.ObjectIdentifier) ([]byte, error) {
+	der, err := berToDER(der)
+	if err != nil {
+		return nil, err
+	}
+	var ci pkcs7ContentInfo
+	if _, err := asn1.Unmarshal(der, &ci); err != nil {
+		return nil, fmt.Errorf("Malformed PKCS #7 data: %v", err)
+	}
+	if !ci.ContentType.Equal(contentType) {
+		return nil, fmt.Errorf("Unexpected PKCS #7 content type %v", ci.ContentType)
+	}
+	return ci.Content.Bytes, nil
+}
+
+func pkcs7Hash(oid asn1.ObjectIdentifier) crypto.Hash {
+	for _, d := range pkcs7DigestOIDs {
+		if d.oid.Equal(oid) {
+			return d.hash
+		}
+	}
+	return 0
+}
+
+func pkcs7FindCertificate(certs []*x509.Certificate, id asn1.RawValue) *x509.Certificate {
+	for _, c := range certs {
+		if pkcs7MatchCertificate(c, id) {
+			return c
+		}
+	}
+	return nil
+}
+
+// pkcs7MatchCertificate reports whether a signer or recipient identifier,
+// either an IssuerAndSerialNumber or a [0] SubjectKeyIdentifier, designates
+// cert.
+func pkcs7MatchCertificate(cert *x509.Certificate, id asn1.RawValue) bool {
+	if id.Class == asn1.ClassContextSpecific && id.Tag == 0 {
+		return len(cert.SubjectKeyId) > 0 && bytes.Equal(cert.SubjectKeyId, id.Bytes)
+	}
+	var ias pkcs7IssuerAndSerial
+	if _, err := asn1.Unmarshal(id.FullBytes, &ias); err != nil || ias.SerialNumber == nil {
+		return false
+	}
+	return bytes.Equal(cert.RawIssuer, ias.Issuer.FullBytes) && cert.SerialNumber.Cmp(ias.SerialNumber) == 0
+}
+
+// berToDER converts the BER encoding that streaming S/MIME encoders produce
+// into DER: indefinite lengths become definite, and constructed octet strings
+// are joined.
+func berToDER(ber []byte) ([]byte, error) {
+	der, _, err := berElement(ber, 0)
+	return der, err
+}
+
+// berElement converts the first element of ber, nested at depth, and returns
+// the bytes after it.
+func berElement(ber []byte, depth int) ([]byte, []byte, error) {
+	if depth > maxBERDepth {
+		return nil, nil, errPKCS7TooDeep
+	}
+	if len(ber) < 2 {
+		return nil, nil, errPKCS7Truncated
+	}
+	tagLen := 1
+	if ber[0]&0x1f == 0x1f {
+		for tagLen < len(ber) && ber[tagLen]&0x80 != 0 {
+			tagLen++
+		}
+		tagLen++
+		if tagLen >= len(ber) {
+			return nil, nil, errPKCS7Truncated
+		}
+	}
+	tag, rest := ber[:tagLen], ber[tagLen:]
+	length, indefinite := int(rest[0]), false
+	rest = rest[1:]
+	switch {
+	case length == 0x80:
+		indefinite = true
+	case length > 0x80:
+		n := length & 0x7f
+		if n > 4 || n > len(rest) {
+			return nil, nil, errPKCS7Truncated
+		}
+		length = 0
+		for _, b := range rest[:n] {
+			length = length<<8 | int(b)
+		}
+		rest = rest[n:]
+	}
+	if ber[0]&0x20 == 0 {
+		if indefinite || length < 0 || length > len(rest) {
+			return nil, nil, errPKCS7Truncated
+		}
+		return derElement(tag, rest[:length]), rest[length:], nil
+	}
+
+	var children [][]byte
+	inner := rest
+	if !indefinite {
+		if length < 0 || length > len(rest) {
+			return nil, nil, errPKCS7Truncated
+		}
+		inner, rest = rest[:length], rest[length:]
+	}
+	for {
+		if indefinite {
+			if len(inner) < 2 {
+				return nil, nil, errPKCS7Truncated
+			}
+			if inner[0] == 0 && inner[1] == 0 {
+				rest = inner[2:]
+				break
+			}
+		} else if len(inner) == 0 {
+			break
+		}
+		child, r, err := berElement(inner, depth+1)
+		if err != nil {
+			return nil, nil, err
+		}
+		children = append(children, child)
+		inner = r
+	}
+
+	if ber[0] == 0x24 {
+		// Constructed OCTET STRING
+		var content []byte
+		for _, c := range children {
+			var chunk []byte
+			if _, err := asn1.Unmarshal(c, &chunk); err != nil {
+				return nil, nil, err
+			}
+			content = append(content, chunk...)
+		}
+		return derElement([]byte{0x04}, content), rest, nil
+	}
+	return derElement(tag, bytes.Join(children, nil)), rest, nil
+}
+
+func derElement(tag, content []byte) []byte {
+	out := append([]byte{}, tag...)
+	if n := len(content); n < 0x80 {
+		out = append(out, byte(n))
+	} else {
+		var l []byte
+		for ; n > 0; n >>= 8 {
+			l = append([]byte{byte(n)}, l...)
+		}
+		out = append(append(out, 0x80|byte(len(l))), l...)
+	}
+	return append(out, content...)
+}
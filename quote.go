@@ -0,0 +1,294 @@
+package enmime
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// ReplyParts is the body of a reply split into what the sender wrote, the
+// history they quoted and their signature.
+type ReplyParts struct {
+	Text      string // New content
+	Quoted    string // Quoted messages, attribution lines included
+	Signature string // Signature below the new content, without its delimiter
+}
+
+var (
+	// "On ... wrote:" lines, the verb being followed by at most a name and an
+	// address
+	attributionRegexp = regexp.MustCompile(`(?i)(wrote|schrieb|a écrit|escribió|ha scritto|escreveu|` +
+		`schreef|skrev|kirjoitti|napisał\(a\)|napisała|napisał|napsal|написал\(а\)|написала|написал|` +
+		`yazdı|έγραψε|写道|寫道|が書きました)[^:：]{0,120}[:：]\s*$`)
+	// First words of attribution lines that clients wrap
+	attributionStartRegexp = regexp.MustCompile(`(?i)^(on|am|le|el|il|em|op|den|w dniu|в|在)\s`)
+	// Dates, times and addresses found in attribution lines
+	attributionDetailRegexp = regexp.MustCompile(`\b(19|20)\d\d\b|\d{1,2}:\d\d|@|<[^>]*>`)
+	// Outlook separators
+	originalMessageRegexp = regexp.MustCompile(`(?i)^\s*-{3,}\s*(original message|ursprüngliche nachricht|` +
+		`message d'origine|mensaje original|messaggio originale|mensagem original|oorspronkelijk bericht|` +
+		`originalmeddelande|opprinnelig melding|oprindelig meddelelse|alkuperäinen viesti|` +
+		`wiadomość oryginalna|исходное сообщение|原始邮件|原始郵件)\s*-{3,}\s*$`)
+	underscoreLineRegexp = regexp.MustCompile(`^\s*_{20,}\s*$`)
+	// Header block of a quoted message: a From field followed by a Sent or
+	// Date field
+	quotedFromRegexp = regexp.MustCompile(`(?i)^\s*\*?(from|von|de|da|van|från|fra|od|от|发件人|寄件者)\s*\*?\s*[:：]`)
+	quotedDateRegexp = regexp.MustCompile(`(?i)^\s*\*?(sent|date|gesendet|datum|envoyé|date d'envoi|` +
+		`enviado|fecha|inviato|data|verzonden|skickat|sendt|lähetetty|wysłano|отправлено|发送时间|日期)\s*\*?\s*[:：]`)
+)
+
+// SplitReplyText splits the plain text body of a reply.  Quoted text is
+// recognized by its '>' prefix and the attribution line above it, and a
+// quoted message written without prefixes by the line introducing it: an
+// attribution with a date or an address, an Outlook
+// "-----Original Message-----" separator or the header fields of the quoted
+// message.  Everything from such a line on is quoted.  The signature starts
+// after the last "-- " line of the new content.
+func SplitReplyText(text string) ReplyParts {
+	lines := strings.Split(strings.Replace(text, "\r\n", "\n", -1), "\n")
+	var newLines, quoted []string
+	for i := 0; i < len(lines); i++ {
+		l := lines[i]
+		if strings.HasPrefix(l, ">") {
+			quoted = append(quoted, l)
+			continue
+		}
+		n := quoteHeaderLines(lines, i)
+		if n == 0 {
+			newLines = append(newLines, l)
+			continue
+		}
+		next := i + n
+		for next < len(lines) && strings.TrimSpace(lines[next]) == "" {
+			next++
+		}
+		if a := isAttribution(lines, i); a > 0 {
+			if next < len(lines) && strings.HasPrefix(lines[next], ">") {
+				// The quote is prefixed, the lines below it may be new again
+				quoted = append(quoted, lines[i:i+n]...)
+				i += n - 1
+				continue
+			}
+			if !isFullAttribution(lines[i : i+a]) {
+				// A sentence of the new content ending in "wrote:"
+				newLines = append(newLines, l)
+				continue
+			}
+		}
+		quoted = append(quoted, lines[i:]...)
+		break
+	}
+
+	parts := ReplyParts{Quoted: trimLines(quoted)}
+	for i := len(newLines) - 1; i >= 0; i-- {
+		if newLines[i] == "-- " || newLines[i] == "--" {
+			parts.Signature = trimLines(newLines[i+1:])
+			newLines = newLines[:i]
+			break
+		}
+	}
+	parts.Text = trimLines(newLines)
+	return parts
+}
+
+// quoteHeaderLines returns the number of lines of the line introducing a
+// quoted message at lines[i], or 0.
+func quoteHeaderLines(lines []string, i int) int {
+	if n := isAttribution(lines, i); n > 0 {
+		return n
+	}
+	l := lines[i]
+	if originalMessageRegexp.MatchString(l) {
+		return 1
+	}
+	if underscoreLineRegexp.MatchString(l) && i+1 < len(lines) && quotedFromRegexp.MatchString(lines[i+1]) {
+		return 1
+	}
+	if quotedFromRegexp.MatchString(l) && i+1 < len(lines) && quotedDateRegexp.MatchString(lines[i+1]) {
+		return 1
+	}
+	return 0
+}
+
+// isAttribution returns the number of lines, one or two when wrapped, of the
+// attribution line at lines[i], or 0.
+func isAttribution(lines []string, i int) int {
+	l := strings.TrimSpace(lines[i])
+	if l == "" || len(l) > 300 {
+		return 0
+	}
+	if attributionRegexp.MatchString(l) {
+		return 1
+	}
+	if i+1 < len(lines) && attributionStartRegexp.MatchString(l) &&
+		attributionRegexp.MatchString(l+" "+strings.TrimSpace(lines[i+1])) {
+		return 2
+	}
+	return 0
+}
+
+// isFullAttribution tells whether the attribution lines say more than who
+// wrote: they start like an attribution, or hold a date or an address.  Only
+// such lines introduce a quote without '>' prefixes.
+func isFullAttribution(lines []string) bool {
+	l := strings.TrimSpace(strings.Join(lines, " "))
+	return attributionStartRegexp.MatchString(l) || attributionDetailRegexp.MatchString(l)
+}
+
+// trimLines joins lines, dropping the empty ones at both ends.
+func trimLines(lines []string) string {
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Classes and ids of the elements holding the quoted message, or the
+// signature, in the HTML of common clients
+var (
+	htmlQuoteClasses = []string{"gmail_quote", "gmail_extra", "yahoo_quoted", "moz-cite-prefix",
+		"protonmail_quote", "zmail_extra", "enmime_quote"}
+	htmlQuoteIDs           = []string{"divRplyFwdMsg", "appendonsend", "OLK_SRC_BODY_SECTION"}
+	htmlSignatureClasses   = []string{"gmail_signature", "moz-signature", "signature"}
+	htmlSignatureIDs       = []string{"Signature", "signature"}
+	outlookSeparatorRegexp = regexp.MustCompile(`(?i)border-top:\s*solid\s+#(e1e1e1|b5c4df)`)
+)
+
+// SplitReplyHTML splits the HTML body of a reply into HTML fragments.  The
+// quoted message starts at the first quote container of Gmail, Outlook,
+// Thunderbird, Yahoo and others, or at a <blockquote type="cite">, and goes
+// on to the end of the document.  The signature is the signature container
+// of the new content.
+func SplitReplyHTML(doc string) (ReplyParts, error) {
+	root, err := html.Parse(strings.NewReader(doc))
+	if err != nil {
+		return ReplyParts{}, err
+	}
+	body := findBody(root)
+	if body == nil {
+		body = root
+	}
+
+	var parts ReplyParts
+	quoted := new(bytes.Buffer)
+	if n := findNode(body, isHTMLQuote); n != nil {
+		// Move the quote and everything after it out of the document
+		for {
+			parent := n.Parent
+			for c := n; c != nil; {
+				next := c.NextSibling
+				parent.RemoveChild(c)
+				if err := html.Render(quoted, c); err != nil {
+					return ReplyParts{}, err
+				}
+				c = next
+			}
+			// The siblings following the ancestors come after the quote too
+			for parent != body && parent.NextSibling == nil {
+				parent = parent.Parent
+			}
+			if parent == body {
+				break
+			}
+			n = parent.NextSibling
+		}
+	}
+	parts.Quoted = strings.TrimSpace(quoted.String())
+
+	if s := findNode(body, isHTMLSignature); s != nil {
+		s.Parent.RemoveChild(s)
+		if parts.Signature, err = renderChildren(s); err != nil {
+			return ReplyParts{}, err
+		}
+		parts.Signature = strings.TrimSpace(parts.Signature)
+	}
+	if parts.Text, err = renderChildren(body); err != nil {
+		return ReplyParts{}, err
+	}
+	parts.Text = strings.TrimSpace(parts.Text)
+	return parts, nil
+}
+
+// SplitReply splits the text body of the message with SplitReplyText.  When
+// the text was converted from HTML, the HTML is split with SplitReplyHTML
+// and its parts converted to text the same way.
+func (m *MIMEBody) SplitReply() (ReplyParts, error) {
+	if !m.IsTextFromHTML {
+		return SplitReplyText(m.Text), nil
+	}
+	parts, err := SplitReplyHTML(m.HTML)
+	if err != nil {
+		return parts, err
+	}
+	for _, s := range []*string{&parts.Text, &parts.Quoted, &parts.Signature} {
+		if *s, err = m.htmlToText(*s); err != nil {
+			return parts, err
+		}
+	}
+	return parts, nil
+}
+
+// isHTMLQuote tells whether n holds a quoted message.
+func isHTMLQuote(n *html.Node) bool {
+	if n.Data == "blockquote" && strings.EqualFold(htmlAttr(n, "type"), "cite") {
+		return true
+	}
+	if n.Data == "div" && outlookSeparatorRegexp.MatchString(htmlAttr(n, "style")) {
+		return true
+	}
+	return hasHTMLClass(n, htmlQuoteClasses) || hasHTMLID(n, htmlQuoteIDs)
+}
+
+// isHTMLSignature tells whether n holds a signature.
+func isHTMLSignature(n *html.Node) bool {
+	return hasHTMLClass(n, htmlSignatureClasses) || hasHTMLID(n, htmlSignatureIDs)
+}
+
+func hasHTMLClass(n *html.Node, classes []string) bool {
+	for _, c := range strings.Fields(htmlAttr(n, "class")) {
+		for _, want := range classes {
+			if c == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func hasHTMLID(n *html.Node, ids []string) bool {
+	id := htmlAttr(n, "id")
+	for _, want := range ids {
+		if id == want {
+			return true
+		}
+	}
+	return false
+}
+
+func htmlAttr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// findNode returns the first element below n, in document order, for which
+// match is true.
+func findNode(n *html.Node, match func(*html.Node) bool) *html.Node {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && match(c) {
+			return c
+		}
+		if found := findNode(c, match); found != nil {
+			return found
+		}
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package enmime
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var splitReplyTextTestTable = []struct {
+	name  string
+	text  string
+	parts ReplyParts
+}{
+	{
+		"top posting",
+		"Sounds good.\r\n\r\nOn Mon, 2 Mar 2020 at 10:00, Alice <alice@example.com> wrote:\r\n> Lunch?\r\n>\r\n",
+		ReplyParts{"Sounds good.", "On Mon, 2 Mar 2020 at 10:00, Alice <alice@example.com> wrote:\n> Lunch?\n>", ""},
+	},
+	{
+		"wrapped attribution",
+		"Yes\n\nOn Mon, Mar 2, 2020 at 10:00 AM Alice Example <\nalice@example.com> wrote:\n\n> Lunch?\n",
+		ReplyParts{"Yes", "On Mon, Mar 2, 2020 at 10:00 AM Alice Example <\nalice@example.com> wrote:\n> Lunch?", ""},
+	},
+	{
+		"interleaved",
+		"Am 02.03.2020 um 10:00 schrieb Alice <alice@example.com>:\n> Lunch?\nYes.\n> Where?\nHere.\n-- \nBob\n",
+		ReplyParts{"Yes.\nHere.", "Am 02.03.2020 um 10:00 schrieb Alice <alice@example.com>:\n> Lunch?\n> Where?", "Bob"},
+	},
+	{
+		"signature",
+		"Oui.\n--\nBob\nExample Inc.\n\nLe lun. 2 mars 2020 à 10:00, Alice <alice@example.com> a écrit :\n> Déjeuner ?",
+		ReplyParts{"Oui.", "Le lun. 2 mars 2020 à 10:00, Alice <alice@example.com> a écrit :\n> Déjeuner ?",
+			"Bob\nExample Inc."},
+	},
+	{
+		"outlook",
+		"Fine.\n\n-----Original Message-----\nFrom: Alice\nSent: Monday\n\nLunch?\n",
+		ReplyParts{"Fine.", "-----Original Message-----\nFrom: Alice\nSent: Monday\n\nLunch?", ""},
+	},
+	{
+		"outlook localized",
+		"Gut.\n\n-----Ursprüngliche Nachricht-----\nVon: Alice\nLunch?",
+		ReplyParts{"Gut.", "-----Ursprüngliche Nachricht-----\nVon: Alice\nLunch?", ""},
+	},
+	{
+		"outlook header block",
+		"Ok\n________________________________\nFrom: Alice <alice@example.com>\nSent: Monday, March 2, 2020 10:00\n\nLunch?",
+		ReplyParts{"Ok", "________________________________\nFrom: Alice <alice@example.com>\n" +
+			"Sent: Monday, March 2, 2020 10:00\n\nLunch?", ""},
+	},
+	{
+		"unprefixed quote",
+		"Да\n\n2 марта 2020 г., в 10:00, Alice написал(а):\n\nОбед?",
+		ReplyParts{"Да", "2 марта 2020 г., в 10:00, Alice написал(а):\n\nОбед?", ""},
+	},
+	{
+		"no quote",
+		"From: the team\nThanks, we wrote: nothing.\n",
+		ReplyParts{"From: the team\nThanks, we wrote: nothing.", "", ""},
+	},
+	{
+		"new line ending in wrote",
+		"Hi,\n\nThis is the function I wrote:\n\n    func f() {}\n\nThanks\n-- \nBob",
+		ReplyParts{"Hi,\n\nThis is the function I wrote:\n\n    func f() {}\n\nThanks", "", "Bob"},
+	},
+	{
+		"unprefixed quote with address",
+		"Ok\n\nalice@example.com wrote:\nLunch?",
+		ReplyParts{"Ok", "alice@example.com wrote:\nLunch?", ""},
+	},
+}
+
+func TestSplitReplyText(t *testing.T) {
+	for _, tt := range splitReplyTextTestTable {
+		assert.Equal(t, tt.parts, SplitReplyText(tt.text), tt.name)
+	}
+}
+
+var splitReplyHTMLTestTable = []struct {
+	name  string
+	html  string
+	parts ReplyParts
+}{
+	{
+		"gmail",
+		`<div dir="ltr">Yes<br><div class="gmail_signature">Bob</div></div><br>` +
+			`<div class="gmail_quote"><div class="gmail_attr">On Mon, Alice wrote:</div>` +
+			`<blockquote class="gmail_quote">Lunch?</blockquote></div>`,
+		ReplyParts{`<div dir="ltr">Yes<br/></div><br/>`,
+			`<div class="gmail_quote"><div class="gmail_attr">On Mon, Alice wrote:</div>` +
+				`<blockquote class="gmail_quote">Lunch?</blockquote></div>`, "Bob"},
+	},
+	{
+		"outlook",
+		`<html><body><div><p>Fine</p><div id="Signature">Bob</div><hr>` +
+			`<div id="divRplyFwdMsg"><b>From:</b> Alice</div><div>Lunch?</div></div><p>Old</p></body></html>`,
+		ReplyParts{`<div><p>Fine</p><hr/></div>`,
+			`<div id="divRplyFwdMsg"><b>From:</b> Alice</div><div>Lunch?</div><p>Old</p>`, "Bob"},
+	},
+	{
+		"outlook desktop",
+		`<p>Ok</p><div style="border:none;border-top:solid #E1E1E1 1.0pt;padding:3.0pt 0in 0in 0in">` +
+			`<p><b>From:</b> Alice</p></div><p>Lunch?</p>`,
+		ReplyParts{`<p>Ok</p>`, `<div style="border:none;border-top:solid #E1E1E1 1.0pt;padding:3.0pt 0in 0in 0in">` +
+			`<p><b>From:</b> Alice</p></div><p>Lunch?</p>`, ""},
+	},
+	{
+		"thunderbird",
+		`<p>Sure</p><div class="moz-cite-prefix">On 2/3/20 Alice wrote:</div>` +
+			`<blockquote type="cite">Lunch?</blockquote><pre class="moz-signature">-- Bob</pre>`,
+		ReplyParts{`<p>Sure</p>`, `<div class="moz-cite-prefix">On 2/3/20 Alice wrote:</div>` +
+			`<blockquote type="cite">Lunch?</blockquote><pre class="moz-signature">-- Bob</pre>`, ""},
+	},
+	{
+		"no quote",
+		`<p>Hello</p>`,
+		ReplyParts{`<p>Hello</p>`, "", ""},
+	},
+}
+
+func TestSplitReplyHTML(t *testing.T) {
+	for _, tt := range splitReplyHTMLTestTable {
+		parts, err := SplitReplyHTML(tt.html)
+		if assert.Nil(t, err, tt.name) {
+			assert.Equal(t, tt.parts, parts, tt.name)
+		}
+	}
+}
+
+func TestMIMEBodySplitReply(t *testing.T) {
+	m, err := ReadMIMEBody(strings.NewReader("Content-Type: text/html\r\n\r\n" +
+		`<p>Yes</p><div class="gmail_quote">On Mon, Alice wrote:<blockquote>Lunch?</blockquote></div>`))
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+	parts, err := m.SplitReply()
+	if assert.Nil(t, err) {
+		assert.Equal(t, "Yes", parts.Text)
+		assert.Contains(t, parts.Quoted, "Lunch?")
+	}
+
+	// Converted with HTMLToText like Text
+	m, err = ReadMIMEBodyWithOptions(strings.NewReader("Content-Type: text/html\r\n\r\n"+
+		`<p>Yes</p><blockquote type="cite"><p>Lunch?</p><ul><li>Soup</li></ul></blockquote>`),
+		&ParseOptions{HTMLText: &HTMLTextOptions{}})
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+	parts, err = m.SplitReply()
+	if assert.Nil(t, err) {
+		assert.Equal(t, ReplyParts{"Yes", "> Lunch?\n>\n> * Soup", ""}, parts)
+	}
+
+	m = parseHeaderOnly(t, "Subject: Re: Lunch")
+	m.Text = "Yes\n> Lunch?\n"
+	parts, err = m.SplitReply()
+	if assert.Nil(t, err) {
+		assert.Equal(t, ReplyParts{"Yes", "> Lunch?", ""}, parts)
+	}
+}
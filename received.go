@@ -0,0 +1,193 @@
+package enmime
+
+import (
+	"net"
+	"strings"
+	"time"
+)
+
+// Received is one hop of the Received header chain of a message.
+type Received struct {
+	From    string        // Host name the sender announced
+	FromIP  string        // IP address of the sender, as seen by the receiver
+	By      string        // Host name of the receiver
+	Via     string        // Link type
+	With    string        // Protocol, like ESMTPS
+	ID      string        // Queue id of the receiver
+	For     string        // Recipient address
+	Date    time.Time     // Time the receiver got the message, zero if unknown
+	Delay   time.Duration // Time since the previous hop, zero if unknown
+	Comment string        // Comments of the from clause, often the reverse DNS
+	Raw     string        // Unparsed header value
+}
+
+// ParseReceived parses the value of a Received header.  It never fails: the
+// clauses that cannot be found are left empty.
+func ParseReceived(value string) Received {
+	r := Received{Raw: value}
+	value = unfoldHeader(value)
+	clauses := value
+	if i := strings.LastIndex(value, ";"); i >= 0 {
+		clauses = value[:i]
+		if t, err := ParseDate(value[i+1:]); err == nil {
+			r.Date = t
+		}
+	}
+
+	var key string
+	var comments []string
+	for _, tok := range receivedTokens(clauses) {
+		if strings.HasPrefix(tok, "(") {
+			if key == "from" {
+				comments = append(comments, strings.TrimSpace(tok[1:len(tok)-1]))
+			}
+			continue
+		}
+		switch k := strings.ToLower(tok); k {
+		case "from", "by", "via", "with", "id", "for":
+			key = k
+			continue
+		}
+		// Only the first word of a clause is its value
+		switch key {
+		case "from":
+			if r.From == "" {
+				r.From = tok
+			}
+		case "by":
+			if r.By == "" {
+				r.By = tok
+			}
+		case "via":
+			if r.Via == "" {
+				r.Via = tok
+			}
+		case "with":
+			if r.With == "" {
+				r.With = tok
+			}
+		case "id":
+			if r.ID == "" {
+				r.ID = strings.Trim(tok, "<>")
+			}
+		case "for":
+			if r.For == "" {
+				r.For = strings.Trim(tok, "<>")
+			}
+		}
+	}
+	r.Comment = strings.Join(comments, " ")
+	r.FromIP = receivedIP(r.Comment)
+	if r.FromIP == "" {
+		r.FromIP = receivedIP(r.From)
+	}
+	return r
+}
+
+// ReceivedChain parses the Received headers of the message, from the most
+// recent hop, which is the topmost header, to the oldest.  The Delay of each
+// hop is the time since the hop below it.
+func (m *MIMEBody) ReceivedChain() []Received {
+	values := m.header["Received"]
+	chain := make([]Received, len(values))
+	for i, v := range values {
+		chain[i] = ParseReceived(v)
+	}
+	for i := 0; i+1 < len(chain); i++ {
+		if !chain[i].Date.IsZero() && !chain[i+1].Date.IsZero() {
+			chain[i].Delay = chain[i].Date.Sub(chain[i+1].Date)
+		}
+	}
+	return chain
+}
+
+// OriginIP returns the sender IP address of the oldest hop of chain whose
+// sender is on a public network, or an empty string.
+func OriginIP(chain []Received) string {
+	for i := len(chain) - 1; i >= 0; i-- {
+		ip := net.ParseIP(chain[i].FromIP)
+		if ip == nil || ip.IsLoopback() || ip.IsLinkLocalUnicast() || isPrivateIP(ip) {
+			continue
+		}
+		return chain[i].FromIP
+	}
+	return ""
+}
+
+var privateNets = func() []*net.IPNet {
+	var nets []*net.IPNet
+	for _, s := range []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16",
+		"100.64.0.0/10", "fc00::/7"} {
+		_, n, _ := net.ParseCIDR(s)
+		nets = append(nets, n)
+	}
+	return nets
+}()
+
+func isPrivateIP(ip net.IP) bool {
+	for _, n := range privateNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// receivedTokens splits the clauses of a Received header into words and
+// comments, keeping each comment, which may nest, as a single token.
+func receivedTokens(s string) []string {
+	var tokens []string
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case c == '(':
+			depth, j := 0, i
+			for ; j < len(s); j++ {
+				if s[j] == '\\' {
+					j++
+					continue
+				}
+				if s[j] == '(' {
+					depth++
+				} else if s[j] == ')' {
+					depth--
+					if depth == 0 {
+						break
+					}
+				}
+			}
+			if j >= len(s) {
+				// Unterminated comment
+				tokens = append(tokens, s[i:]+")")
+				return tokens
+			}
+			tokens = append(tokens, s[i:j+1])
+			i = j + 1
+		default:
+			j := i
+			for j < len(s) && !strings.ContainsRune(" \t\r\n(", rune(s[j])) {
+				j++
+			}
+			tokens = append(tokens, s[i:j])
+			i = j
+		}
+	}
+	return tokens
+}
+
+// receivedIP finds an IP address in text like "mail.example.com [192.0.2.1]",
+// "[IPv6:2001:db8::1]" or "192.0.2.1".
+func receivedIP(s string) string {
+	for _, f := range strings.FieldsFunc(s, func(r rune) bool {
+		return r == ' ' || r == '[' || r == ']' || r == '(' || r == ')' || r == ',' || r == '='
+	}) {
+		f = strings.TrimPrefix(strings.TrimPrefix(f, "IPv6:"), "ipv6:")
+		f = strings.TrimSuffix(f, ".")
+		if ip := net.ParseIP(f); ip != nil {
+			return ip.String()
+		}
+	}
+	return ""
+}
@@ -0,0 +1,53 @@
+package enmime
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseReceived(t *testing.T) {
+	r := ParseReceived("from mail.example.com (mail.example.com [192.0.2.1])\r\n" +
+		"\tby mx.example.net (Postfix) with ESMTPS id 4F3A21234\r\n" +
+		"\tfor <bob@example.net>; Tue, 1 Jul 2003 10:52:37 +0200 (CEST)")
+	assert.Equal(t, "mail.example.com", r.From)
+	assert.Equal(t, "192.0.2.1", r.FromIP)
+	assert.Equal(t, "mail.example.com [192.0.2.1]", r.Comment)
+	assert.Equal(t, "mx.example.net", r.By)
+	assert.Equal(t, "ESMTPS", r.With)
+	assert.Equal(t, "4F3A21234", r.ID)
+	assert.Equal(t, "bob@example.net", r.For)
+	assert.Equal(t, int64(1057049557), r.Date.Unix())
+
+	r = ParseReceived("from [IPv6:2001:db8::1] (unknown)\r\n by relay.example.org" +
+		" with LMTP; 1 Jul 2003 10:52:37 +0200")
+	assert.Equal(t, "2001:db8::1", r.FromIP)
+	assert.Equal(t, "relay.example.org", r.By)
+	assert.Equal(t, "LMTP", r.With)
+	assert.Equal(t, "", r.For)
+
+	r = ParseReceived("by localhost (nested (comment)) via HTTP; garbage")
+	assert.Equal(t, "localhost", r.By)
+	assert.Equal(t, "HTTP", r.Via)
+	assert.True(t, r.Date.IsZero())
+}
+
+func TestReceivedChain(t *testing.T) {
+	mime := parseHeaderOnly(t, "Received: from mx.example.net (mx.example.net [10.0.0.5])\r\n"+
+		" by mailbox.example.net; Tue, 1 Jul 2003 10:53:07 +0200\r\n"+
+		"Received: from mail.example.com (mail.example.com [192.0.2.1])\r\n"+
+		" by mx.example.net; Tue, 1 Jul 2003 08:52:40 +0000\r\n"+
+		"Received: from laptop (laptop [192.168.1.20])\r\n"+
+		" by mail.example.com; Tue, 1 Jul 2003 10:52:37 +0200")
+
+	chain := mime.ReceivedChain()
+	if assert.Equal(t, 3, len(chain)) {
+		assert.Equal(t, "mailbox.example.net", chain[0].By)
+		assert.Equal(t, 27*time.Second, chain[0].Delay)
+		assert.Equal(t, 3*time.Second, chain[1].Delay)
+		assert.Equal(t, time.Duration(0), chain[2].Delay)
+	}
+	assert.Equal(t, "192.0.2.1", OriginIP(chain))
+	assert.Empty(t, parseHeaderOnly(t, "Subject: local").ReceivedChain())
+}
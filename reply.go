@@ -0,0 +1,485 @@
+package enmime
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/cention-sany/mime"
+	"github.com/cention-sany/net/mail"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// ReplyOptions controls how Reply builds a reply.
+type ReplyOptions struct {
+	// From is the sender of the reply.  Its address is left out of the
+	// recipients of a reply to all.
+	From *mail.Address
+	// Self lists other addresses of the sender to leave out of the recipients.
+	Self []string
+	// All replies to all the recipients of the message, not only its author.
+	All bool
+	// Text is the new text, written above the quoted message.
+	Text string
+	// HTML is the new HTML, written above the quoted message.  When empty the
+	// escaped Text is used.
+	HTML string
+	// Attribution is the line introducing the quoted message.  When empty it
+	// is "On <date>, <author> wrote:".
+	Attribution string
+	// Date of the reply, the current time if zero.
+	Date time.Time
+}
+
+// ForwardOptions controls how Forward builds a forward.
+type ForwardOptions struct {
+	From   *mail.Address   // Sender of the forward
+	To, Cc []*mail.Address // Recipients of the forward
+	Text   string          // New text, written above the forwarded message
+	HTML   string          // New HTML, the escaped Text if empty
+	// AsAttachment attaches the whole message as a message/rfc822 part instead
+	// of quoting it inline with its attachments and inline images.
+	AsAttachment bool
+	// Date of the forward, the current time if zero.
+	Date time.Time
+}
+
+// Reply and forward prefixes replaced when building a new subject
+var (
+	replyPrefixRegexp   = regexp.MustCompile(`(?i)^\s*(re|aw|sv|vs|antw|rif|odp)\s*(\[\d+\]|\(\d+\))?\s*[:：]\s*`)
+	forwardPrefixRegexp = regexp.MustCompile(`(?i)^\s*(fwd?|wg|tr|rv|enc)\s*(\[\d+\]|\(\d+\))?\s*[:：]\s*`)
+)
+
+// ReplySubject returns subject with a single "Re: " prefix, whatever reply
+// prefixes it already had, in whichever language.
+func ReplySubject(subject string) string {
+	return "Re: " + stripPrefixes(replyPrefixRegexp, subject)
+}
+
+// ForwardSubject returns subject with a single "Fwd: " prefix.
+func ForwardSubject(subject string) string {
+	return "Fwd: " + stripPrefixes(forwardPrefixRegexp, subject)
+}
+
+func stripPrefixes(re *regexp.Regexp, subject string) string {
+	for {
+		loc := re.FindStringIndex(subject)
+		if loc == nil {
+			return strings.TrimSpace(subject)
+		}
+		subject = subject[loc[1]:]
+	}
+}
+
+// ReplyRecipients returns the recipients of a reply: the Reply-To addresses,
+// or else the author.  A reply to all adds the To and Cc addresses as Cc.
+// The addresses in self are left out, and a reply to one's own message goes
+// to its recipients instead.  Duplicates are removed.
+func (m *MIMEBody) ReplyRecipients(all bool, self ...string) (to, cc []*mail.Address) {
+	isSelf := make(map[string]bool, len(self))
+	for _, s := range self {
+		isSelf[strings.ToLower(s)] = true
+	}
+	seen := make(map[string]bool)
+	add := func(list []*mail.Address, addrs []*mail.Address) []*mail.Address {
+		for _, a := range addrs {
+			key := strings.ToLower(a.Address)
+			if !isSelf[key] && !seen[key] {
+				seen[key] = true
+				list = append(list, a)
+			}
+		}
+		return list
+	}
+
+	author := m.addresses("Reply-To")
+	if author == nil {
+		author = m.addresses("From")
+	}
+	fromSelf := len(author) > 0
+	for _, a := range author {
+		fromSelf = fromSelf && isSelf[strings.ToLower(a.Address)]
+	}
+	if fromSelf {
+		to = add(to, m.addresses("To"))
+		if all {
+			cc = add(cc, m.addresses("Cc"))
+		}
+		return to, cc
+	}
+	to = add(to, author)
+	if all {
+		cc = add(cc, m.addresses("To"))
+		cc = add(cc, m.addresses("Cc"))
+	}
+	return to, cc
+}
+
+// addresses returns the addresses of the header key, nil when it is missing
+// or cannot be parsed.
+func (m *MIMEBody) addresses(key string) []*mail.Address {
+	addrs, err := m.AddressList(key)
+	if err != nil {
+		return nil
+	}
+	return addrs
+}
+
+// Reply builds a reply to the message: its subject gets a "Re: " prefix, it
+// is threaded with In-Reply-To and References, and its text/plain and
+// text/html bodies quote the message below an attribution line.  The inline
+// images of the message are kept for the quoted HTML.
+func (m *MIMEBody) Reply(opts *ReplyOptions) (*MIMEBody, error) {
+	o := ReplyOptions{}
+	if opts != nil {
+		o = *opts
+	}
+	self := o.Self
+	if o.From != nil {
+		self = append([]string{o.From.Address}, self...)
+	}
+	to, cc := m.ReplyRecipients(o.All, self...)
+	if len(to) == 0 {
+		return nil, fmt.Errorf("No recipient to reply to")
+	}
+
+	attribution := o.Attribution
+	if attribution == "" {
+		attribution = m.attribution()
+	}
+	text := o.Text
+	if text != "" {
+		text = strings.TrimRight(text, "\r\n") + "\n\n"
+	}
+	text += attribution + "\n" + QuoteText(m.Text)
+	newHTML := o.HTML
+	if newHTML == "" {
+		newHTML = textToHTML(o.Text)
+	}
+	quoted := htmlBodyContent(m.HTML)
+	if m.HTML == "" {
+		quoted = textToHTML(m.Text)
+	}
+	body := newHTML + "<div class=\"enmime_quote\"><p>" + html.EscapeString(attribution) + "</p>" +
+		"<blockquote type=\"cite\" style=\"margin:0 0 0 .8ex;border-left:1px solid #ccc;padding-left:1ex\">" +
+		quoted + "</blockquote></div>"
+
+	fields := newMessageFields(o.From, to, cc, ReplySubject(m.GetHeader("Subject")), o.Date)
+	if id := m.MessageID(); id != "" {
+		refs := m.References()
+		if len(refs) == 0 {
+			refs = m.InReplyTo()
+			if len(refs) > 1 {
+				refs = nil
+			}
+		}
+		refs = append(refs[:len(refs):len(refs)], id)
+		fields = fields.Add("In-Reply-To", "<"+id+">").
+			Add("References", "<"+strings.Join(refs, "> <")+">")
+	}
+	return newMessage(fields, text, body, m.cidInlines(), nil), nil
+}
+
+// Forward builds a forward of the message with a "Fwd: " subject.  Inline, the
+// text and HTML bodies show the main header fields of the message above its
+// bodies, and its attachments and inline images are copied.  As an attachment,
+// the message is written out as a message/rfc822 part, which needs a message
+// parsed with ReadMIMEBody unless it has parts to write again (see WriteTo).
+func (m *MIMEBody) Forward(opts *ForwardOptions) (*MIMEBody, error) {
+	o := ForwardOptions{}
+	if opts != nil {
+		o = *opts
+	}
+	fields := newMessageFields(o.From, o.To, o.Cc, ForwardSubject(m.GetHeader("Subject")), o.Date)
+	newHTML := o.HTML
+	if newHTML == "" {
+		newHTML = textToHTML(o.Text)
+	}
+
+	if o.AsAttachment {
+		raw, err := m.Bytes()
+		if err != nil {
+			return nil, err
+		}
+		name := strings.Map(func(r rune) rune {
+			if strings.ContainsRune(`/\:*?"<>|`, r) || r < ' ' {
+				return '_'
+			}
+			return r
+		}, m.GetHeader("Subject"))
+		if name == "" {
+			name = "message"
+		}
+		cte := "7bit"
+		if !is7bit(raw) {
+			cte = "8bit"
+		}
+		if longLines(raw) {
+			cte = "binary"
+		}
+		// The disposition is already encoded: EncodeHeader would turn a non
+		// ASCII file name into an encoded-word inside the quoted string.
+		att := newLeafPart("message/rfc822", append(HeaderFields{}.
+			Add("Content-Type", "message/rfc822"),
+			newHeaderField("Content-Disposition", attachmentDisposition(name+".eml"))).
+			Add("Content-Transfer-Encoding", cte), raw)
+		return newMessage(fields, o.Text, newHTML, nil, []*memMIMEPart{att}), nil
+	}
+
+	text := o.Text
+	if text != "" {
+		text = strings.TrimRight(text, "\r\n") + "\n\n"
+	}
+	var headerText, headerHTML string
+	for _, name := range []string{"From", "Date", "Subject", "To", "Cc"} {
+		if v := m.GetHeader(name); v != "" {
+			headerText += name + ": " + v + "\n"
+			headerHTML += name + ": " + html.EscapeString(v) + "<br>\n"
+		}
+	}
+	text += "---------- Forwarded message ----------\n" + headerText + "\n" + m.Text
+	forwarded := htmlBodyContent(m.HTML)
+	if m.HTML == "" {
+		forwarded = textToHTML(m.Text)
+	}
+	body := newHTML + "<div class=\"enmime_forward\"><p>---------- Forwarded message ----------<br>\n" +
+		headerHTML + "</p>" + forwarded + "</div>"
+
+	var attachments []*memMIMEPart
+	for _, p := range m.Attachments {
+		attachments = append(attachments, copyPart(p))
+	}
+	for _, p := range m.Inlines {
+		if p.Header() == nil || p.Header().Get("Content-Id") == "" {
+			attachments = append(attachments, copyPart(p))
+		}
+	}
+	return newMessage(fields, text, body, m.cidInlines(), attachments), nil
+}
+
+// attribution returns the default line introducing a quote of the message.
+func (m *MIMEBody) attribution() string {
+	author := "someone"
+	if from := m.addresses("From"); len(from) > 0 {
+		author = from[0].Address
+		if from[0].Name != "" {
+			author = from[0].Name + " <" + from[0].Address + ">"
+		}
+	}
+	if date, err := m.Date(); err == nil {
+		return "On " + date.Format("Mon, 2 Jan 2006 at 15:04") + ", " + author + " wrote:"
+	}
+	return author + " wrote:"
+}
+
+// cidInlines copies the parts of the message that HTML can refer to by their
+// Content-ID.
+func (m *MIMEBody) cidInlines() []*memMIMEPart {
+	var inlines []*memMIMEPart
+	for _, p := range m.Inlines {
+		if p.Header() != nil && p.Header().Get("Content-Id") != "" {
+			inlines = append(inlines, copyPart(p))
+		}
+	}
+	return inlines
+}
+
+// QuoteText prefixes the lines of text with "> ", or ">" for empty and
+// already quoted lines.
+func QuoteText(text string) string {
+	lines := strings.Split(strings.TrimRight(strings.Replace(text, "\r\n", "\n", -1), "\n"), "\n")
+	for i, l := range lines {
+		if l == "" || l[0] == '>' {
+			lines[i] = ">" + l
+		} else {
+			lines[i] = "> " + l
+		}
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// textToHTML escapes text, keeping its line breaks.
+func textToHTML(text string) string {
+	if text == "" {
+		return ""
+	}
+	text = html.EscapeString(strings.Replace(text, "\r\n", "\n", -1))
+	return "<div>" + strings.Replace(text, "\n", "<br>\n", -1) + "</div>"
+}
+
+// htmlBodyContent returns what is inside the body element of an HTML
+// document, which can then be nested in another document.
+func htmlBodyContent(doc string) string {
+	root, err := html.Parse(strings.NewReader(doc))
+	if err != nil {
+		return doc
+	}
+	body := findBody(root)
+	if body == nil {
+		return doc
+	}
+	content, err := renderChildren(body)
+	if err != nil {
+		return doc
+	}
+	return content
+}
+
+// findBody returns the body element of a parsed document, or nil.
+func findBody(root *html.Node) *html.Node {
+	return findNode(root, func(n *html.Node) bool { return n.DataAtom == atom.Body })
+}
+
+// renderChildren renders the nodes inside n.
+func renderChildren(n *html.Node) (string, error) {
+	buf := new(bytes.Buffer)
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if err := html.Render(buf, c); err != nil {
+			return "", err
+		}
+	}
+	return buf.String(), nil
+}
+
+// newMessageFields returns the header fields of a new message.
+func newMessageFields(from *mail.Address, to, cc []*mail.Address, subject string, date time.Time) HeaderFields {
+	if date.IsZero() {
+		date = time.Now()
+	}
+	var fields HeaderFields
+	domain := "localhost"
+	if from != nil {
+		fields = fields.SetAddresses("From", []*mail.Address{from})
+		if i := strings.LastIndex(from.Address, "@"); i >= 0 {
+			domain = from.Address[i+1:]
+		}
+	}
+	if len(to) > 0 {
+		fields = fields.SetAddresses("To", to)
+	}
+	if len(cc) > 0 {
+		fields = fields.SetAddresses("Cc", cc)
+	}
+	return fields.Add("Subject", subject).
+		Add("Date", date.Format(time.RFC1123Z)).
+		Add("Message-ID", "<"+randomToken()+"@"+domain+">").
+		Add("MIME-Version", "1.0")
+}
+
+// newMessage builds a message from its header fields and bodies, in a
+// multipart/alternative, itself in a multipart/related with the inline parts
+// and in a multipart/mixed with the attachments.
+func newMessage(fields HeaderFields, text, body string, inlines, attachments []*memMIMEPart) *MIMEBody {
+	root := newMultipart("multipart/alternative",
+		newTextPart("text/plain", text), newTextPart("text/html", body))
+	if len(inlines) > 0 {
+		root = newMultipart("multipart/related", append([]*memMIMEPart{root}, inlines...)...)
+	}
+	if len(attachments) > 0 {
+		root = newMultipart("multipart/mixed", append([]*memMIMEPart{root}, attachments...)...)
+	}
+	m := &MIMEBody{
+		Text:        text,
+		TextCharset: "utf-8",
+		HTML:        body,
+		HTMLCharset: "utf-8",
+		Root:        root,
+	}
+	// The header of the root part goes to the message
+	m.SetHeaderFields(append(fields, root.fields...))
+	root.header, root.fields = nil, nil
+	m.sortParts()
+	return m
+}
+
+// newMultipart returns a new multipart of type mediatype holding parts.
+func newMultipart(mediatype string, parts ...*memMIMEPart) *memMIMEPart {
+	p := NewMIMEPart(nil, mediatype)
+	p.SetHeaderFields(HeaderFields{}.
+		Add("Content-Type", mediatype+"; boundary=\""+randomToken()+"\""))
+	for i := len(parts) - 1; i >= 0; i-- {
+		parts[i].parent, parts[i].nextSibling = p, p.firstChild
+		p.firstChild = parts[i]
+	}
+	return p
+}
+
+// newTextPart returns a new UTF-8 text part with CRLF line breaks.
+func newTextPart(mediatype, text string) *memMIMEPart {
+	content := []byte(strings.Replace(strings.Replace(text, "\r\n", "\n", -1), "\n", "\r\n", -1))
+	return newLeafPart(mediatype, HeaderFields{}.
+		Add("Content-Type", mediatype+"; charset=utf-8").
+		Add("Content-Transfer-Encoding", transferEncoding("7bit", mediatype, content)), content)
+}
+
+// newLeafPart returns a new part with fields and content.
+func newLeafPart(mediatype string, fields HeaderFields, content []byte) *memMIMEPart {
+	p := NewMIMEPart(nil, mediatype)
+	p.SetHeaderFields(fields)
+	p.content = content
+	return p
+}
+
+// attachmentDisposition returns the Content-Disposition of an attachment named
+// filename.  The old mime package cannot format non ASCII parameters, which
+// are written with the RFC 2231 extended notation in UTF-8.
+func attachmentDisposition(filename string) string {
+	params := map[string]string{"filename": filename}
+	if v := mime.FormatMediaType("attachment", params); v != "" {
+		return v
+	}
+	var b strings.Builder
+	b.WriteString("attachment; filename*=utf-8''")
+	for i := 0; i < len(filename); i++ {
+		c := filename[i]
+		if c > ' ' && c < 0x7f && !strings.ContainsRune(`*'%()<>@,;:\"/[]?=`, rune(c)) {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// copyPart copies p and the parts inside it, without their original bytes,
+// to be put in another message.
+func copyPart(p MIMEPart) *memMIMEPart {
+	var fields HeaderFields
+	if hp, ok := p.(HeaderFieldsPart); ok && p.Parent() != nil {
+		fields = hp.HeaderFields()
+	} else {
+		// Single part message, whose header is the one of the message (see
+		// binMIME), or part of another package
+		fields = headerFieldsFromMap(p.Header(), p.Charset())
+	}
+	if p.FirstChild() == nil {
+		cte := fields.Get("Content-Transfer-Encoding")
+		if enc := transferEncoding(cte, p.ContentType(), p.Content()); enc != cte {
+			fields = fields.Set("Content-Transfer-Encoding", enc)
+		}
+	}
+	c := newLeafPart(p.ContentType(), fields, p.Content())
+	var children []*memMIMEPart
+	for child := p.FirstChild(); child != nil; child = child.NextSibling() {
+		children = append(children, copyPart(child))
+	}
+	for i := len(children) - 1; i >= 0; i-- {
+		children[i].parent, children[i].nextSibling = c, c.firstChild
+		c.firstChild = children[i]
+	}
+	return c
+}
+
+// randomToken returns a random string usable in boundaries and message ids.
+func randomToken() string {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
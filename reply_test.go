@@ -0,0 +1,228 @@
+package enmime
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cention-sany/net/mail"
+	"github.com/stretchr/testify/assert"
+)
+
+const replyTestMessage = "From: Alice <alice@example.com>\r\n" +
+	"To: Bob <bob@example.com>, carol@example.com\r\n" +
+	"Cc: Dave <dave@example.com>, bob@example.com\r\n" +
+	"Subject: RE: AW: Lunch\r\n" +
+	"Date: Mon, 2 Mar 2020 10:00:00 +0000\r\n" +
+	"Message-ID: <3@example.com>\r\n" +
+	"References: <1@example.com> <2@example.com>\r\n" +
+	"Content-Type: multipart/mixed; boundary=mixed\r\n" +
+	"\r\n" +
+	"--mixed\r\n" +
+	"Content-Type: multipart/related; boundary=rel\r\n" +
+	"\r\n" +
+	"--rel\r\n" +
+	"Content-Type: multipart/alternative; boundary=alt\r\n" +
+	"\r\n" +
+	"--alt\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"\r\n" +
+	"Noon?\r\n" +
+	"> Lunch tomorrow\r\n" +
+	"--alt\r\n" +
+	"Content-Type: text/html\r\n" +
+	"\r\n" +
+	"<html><head><title>x</title></head><body><p>Noon? <img src=\"cid:logo\"></p></body></html>\r\n" +
+	"--alt--\r\n" +
+	"--rel\r\n" +
+	"Content-Type: image/png\r\n" +
+	"Content-Disposition: inline\r\n" +
+	"Content-ID: <logo>\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"iVBORw==\r\n" +
+	"--rel--\r\n" +
+	"--mixed\r\n" +
+	"Content-Type: application/pdf\r\n" +
+	"Content-Disposition: attachment; filename=menu.pdf\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"JVBERg==\r\n" +
+	"--mixed--\r\n"
+
+var subjectTestTable = []struct {
+	subject, reply, forward string
+}{
+	{"Lunch", "Re: Lunch", "Fwd: Lunch"},
+	{"RE: Re[2]: AW: Lunch", "Re: Lunch", "Fwd: RE: Re[2]: AW: Lunch"},
+	{"Fw: Lunch", "Re: Fw: Lunch", "Fwd: Lunch"},
+	{"[list] Re: Lunch", "Re: [list] Re: Lunch", "Fwd: [list] Re: Lunch"},
+	{"SV：  Lunch ", "Re: Lunch", "Fwd: SV：  Lunch"},
+}
+
+func TestReplySubject(t *testing.T) {
+	for _, tt := range subjectTestTable {
+		assert.Equal(t, tt.reply, ReplySubject(tt.subject), tt.subject)
+		assert.Equal(t, tt.forward, ForwardSubject(tt.subject), tt.subject)
+	}
+}
+
+func addressStrings(addrs []*mail.Address) []string {
+	var s []string
+	for _, a := range addrs {
+		s = append(s, a.Address)
+	}
+	return s
+}
+
+func TestReplyRecipients(t *testing.T) {
+	m, err := ReadMIMEBody(strings.NewReader(replyTestMessage))
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+	to, cc := m.ReplyRecipients(false, "bob@example.com")
+	assert.Equal(t, []string{"alice@example.com"}, addressStrings(to))
+	assert.Nil(t, cc)
+
+	to, cc = m.ReplyRecipients(true, "BOB@example.com")
+	assert.Equal(t, []string{"alice@example.com"}, addressStrings(to))
+	assert.Equal(t, []string{"carol@example.com", "dave@example.com"}, addressStrings(cc))
+
+	// Reply to one's own message
+	to, cc = m.ReplyRecipients(true, "alice@example.com")
+	assert.Equal(t, []string{"bob@example.com", "carol@example.com"}, addressStrings(to))
+	assert.Equal(t, []string{"dave@example.com"}, addressStrings(cc))
+
+	m = parseHeaderOnly(t, "From: alice@example.com\nReply-To: list@example.com\nTo: list@example.com")
+	to, cc = m.ReplyRecipients(true)
+	assert.Equal(t, []string{"list@example.com"}, addressStrings(to))
+	assert.Nil(t, cc)
+}
+
+func TestReply(t *testing.T) {
+	m, err := ReadMIMEBody(strings.NewReader(replyTestMessage))
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+	r, err := m.Reply(&ReplyOptions{
+		From: &mail.Address{Name: "Bob", Address: "bob@example.com"},
+		All:  true,
+		Text: "Sure & see you.\n",
+		Date: time.Date(2020, 3, 2, 11, 0, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatalf("Failed to reply: %v", err)
+	}
+	assert.Equal(t, "Sure & see you.\n\nOn Mon, 2 Mar 2020 at 10:00, Alice <alice@example.com> wrote:\n"+
+		"> Noon?\n>> Lunch tomorrow\n", r.Text)
+	assert.Contains(t, r.HTML, "<div>Sure &amp; see you.<br>\n</div>")
+	assert.Contains(t, r.HTML, "<p>On Mon, 2 Mar 2020 at 10:00, Alice &lt;alice@example.com&gt; wrote:</p>"+
+		"<blockquote type=\"cite\"")
+	assert.Contains(t, r.HTML, "<p>Noon? <img src=\"cid:logo\"/></p></blockquote>")
+	assert.NotContains(t, r.HTML, "<title>")
+
+	b, err := r.Bytes()
+	if err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+	r, err = ReadMIMEBody(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+	assert.Equal(t, "Re: Lunch", r.GetHeader("Subject"))
+	assert.Equal(t, "Mon, 02 Mar 2020 11:00:00 +0000", r.GetHeader("Date"))
+	assert.Equal(t, []string{"3@example.com"}, r.InReplyTo())
+	assert.Equal(t, []string{"1@example.com", "2@example.com", "3@example.com"}, r.References())
+	assert.True(t, strings.HasSuffix(r.MessageID(), "@example.com"))
+	to, _ := r.AddressList("To")
+	assert.Equal(t, []string{"alice@example.com"}, addressStrings(to))
+	cc, _ := r.AddressList("Cc")
+	assert.Equal(t, []string{"carol@example.com", "dave@example.com"}, addressStrings(cc))
+	assert.Contains(t, r.Text, "\r\n> Noon?\r\n")
+	assert.Contains(t, r.HTML, "cid:logo")
+	assert.Len(t, r.Attachments, 0)
+	if assert.Len(t, r.Inlines, 1) {
+		assert.Equal(t, "<logo>", r.Inlines[0].Header().Get("Content-Id"))
+		assert.Equal(t, m.Inlines[0].Content(), r.Inlines[0].Content())
+	}
+	assert.Equal(t, "multipart/related", r.Root.ContentType())
+}
+
+func TestForward(t *testing.T) {
+	m, err := ReadMIMEBody(strings.NewReader(replyTestMessage))
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+	opts := &ForwardOptions{
+		From: &mail.Address{Address: "bob@example.com"},
+		To:   []*mail.Address{{Name: "Eve", Address: "eve@example.com"}},
+		Text: "FYI",
+	}
+	f, err := m.Forward(opts)
+	if err != nil {
+		t.Fatalf("Failed to forward: %v", err)
+	}
+	assert.True(t, strings.HasPrefix(f.Text, "FYI\n\n---------- Forwarded message ----------\n"+
+		"From: Alice <alice@example.com>\nDate: Mon, 2 Mar 2020 10:00:00 +0000\nSubject: RE: AW: Lunch\n"))
+	assert.True(t, strings.HasSuffix(f.Text, "\n\nNoon?\r\n> Lunch tomorrow"))
+	assert.Contains(t, f.HTML, "Cc: Dave &lt;dave@example.com&gt;, bob@example.com<br>")
+
+	b, err := f.Bytes()
+	if err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+	f, err = ReadMIMEBody(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+	assert.Equal(t, "Fwd: RE: AW: Lunch", f.GetHeader("Subject"))
+	assert.Equal(t, "", f.GetHeader("In-Reply-To"))
+	assert.Equal(t, "multipart/mixed", f.Root.ContentType())
+	if assert.Len(t, f.Attachments, 1) {
+		assert.Equal(t, "menu.pdf", f.Attachments[0].FileName())
+		assert.Equal(t, []byte("%PDF"), f.Attachments[0].Content())
+	}
+	assert.Len(t, f.Inlines, 1)
+
+	opts.AsAttachment = true
+	f, err = m.Forward(opts)
+	if err != nil {
+		t.Fatalf("Failed to forward: %v", err)
+	}
+	assert.Equal(t, "FYI", f.Text)
+	if assert.Len(t, f.Attachments, 1) {
+		assert.Equal(t, "message/rfc822", f.Attachments[0].ContentType())
+		assert.Equal(t, "RE_ AW_ Lunch.eml", f.Attachments[0].FileName())
+		assert.Equal(t, replyTestMessage, string(f.Attachments[0].Content()))
+	}
+	b, err = f.Bytes()
+	if err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+	assert.Contains(t, string(b), "Content-Transfer-Encoding: 7bit\r\n\r\n"+replyTestMessage)
+}
+
+func TestForwardAttachmentName(t *testing.T) {
+	m, err := ReadMIMEBody(strings.NewReader("From: alice@example.com\r\n" +
+		"Subject: =?utf-8?q?R=C3=A9union_=22budget=22?=\r\n\r\nHello\r\n"))
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+	f, err := m.Forward(&ForwardOptions{AsAttachment: true})
+	if err != nil {
+		t.Fatalf("Failed to forward: %v", err)
+	}
+	if assert.Len(t, f.Attachments, 1) {
+		assert.Equal(t, "Réunion _budget_.eml", f.Attachments[0].FileName())
+	}
+	b, err := f.Bytes()
+	if err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+	assert.Contains(t, string(b), "Content-Disposition: attachment; filename*=utf-8''R%C3%A9union%20_budget_.eml\r\n")
+}
+
+func TestQuoteText(t *testing.T) {
+	assert.Equal(t, "> a\n>\n>> b\n", QuoteText("a\r\n\r\n> b\r\n"))
+}
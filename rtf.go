@@ -0,0 +1,285 @@
+package enmime
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+var (
+	errNotRTF    = errors.New("Not an RTF document")
+	errNoRTFHTML = errors.New("RTF document does not encapsulate HTML")
+)
+
+// Destinations whose text is not part of the document
+var rtfSkipDestinations = map[string]bool{
+	"author": true, "buptim": true, "colortbl": true, "comment": true, "creatim": true,
+	"doccomm": true, "fldinst": true, "fonttbl": true, "footer": true, "footerf": true,
+	"footerl": true, "footerr": true, "footnote": true, "header": true, "headerf": true,
+	"headerl": true, "headerr": true, "info": true, "keywords": true, "listoverridetable": true,
+	"listtable": true, "mhtmltag": true, "object": true, "operator": true, "pict": true,
+	"printim": true, "private": true, "revtim": true, "rsidtbl": true, "rxe": true,
+	"stylesheet": true, "subject": true, "tc": true, "title": true, "txe": true, "xe": true,
+}
+
+// Control words standing for characters
+var rtfSpecialChars = map[string]string{
+	"par": "\n", "line": "\n", "row": "\n", "sect": "\n", "page": "\n",
+	"tab": "\t", "cell": "\t",
+	"emdash": "—", "endash": "–", "bullet": "•",
+	"lquote": "‘", "rquote": "’", "ldblquote": "“", "rdblquote": "”",
+	"emspace": " ", "enspace": " ", "qmspace": " ",
+}
+
+// RTFToText returns the text of the RTF document rtf, without formatting.
+// Characters are decoded from the code page of the document.
+func RTFToText(rtf []byte) (string, error) {
+	d, err := decodeRTF(rtf)
+	if err != nil {
+		return "", err
+	}
+	return d.text.String(), nil
+}
+
+// RTFToHTML returns the HTML document encapsulated in rtf, as Outlook writes
+// HTML messages in RTF with \fromhtml1 (MS-OXRTFEX).
+func RTFToHTML(rtf []byte) (string, error) {
+	d, err := decodeRTF(rtf)
+	if err != nil {
+		return "", err
+	}
+	if !d.fromHTML {
+		return "", errNoRTFHTML
+	}
+	return d.html.String(), nil
+}
+
+// rtfGroup is the state kept by each {} group of an RTF document.
+type rtfGroup struct {
+	skipText bool // Text is not part of the RTF document
+	skipHTML bool // Text is not part of the encapsulated HTML
+	htmlRTF  bool // Text only belongs to the RTF rendering, see \htmlrtf
+	uc       int  // Number of characters after \u standing for it
+}
+
+// rtfDecoder reads an RTF document, writing its text and the encapsulated
+// HTML as it goes.
+type rtfDecoder struct {
+	text, html strings.Builder
+	fromHTML   bool
+	charset    string
+	state      rtfGroup
+	stack      []rtfGroup
+	pending    []byte // Bytes of the code page waiting to be decoded
+	skip       int    // Characters left to skip after \u
+	surrogate  rune   // High surrogate of a \u pair
+}
+
+func decodeRTF(rtf []byte) (*rtfDecoder, error) {
+	rtf = bytes.TrimLeft(rtf, " \t\r\n")
+	if !bytes.HasPrefix(rtf, []byte(`{\rtf`)) {
+		return nil, errNotRTF
+	}
+	d := &rtfDecoder{charset: "windows-1252", state: rtfGroup{uc: 1}}
+	for i := 0; i < len(rtf); {
+		c := rtf[i]
+		switch c {
+		case '{':
+			d.flush()
+			d.stack = append(d.stack, d.state)
+			d.skip = 0
+			i++
+		case '}':
+			d.flush()
+			if len(d.stack) > 0 {
+				d.state = d.stack[len(d.stack)-1]
+				d.stack = d.stack[:len(d.stack)-1]
+			}
+			d.skip = 0
+			i++
+		case '\\':
+			i = d.control(rtf, i+1)
+		case '\r', '\n':
+			i++
+		default:
+			if d.skipChar() {
+				i++
+				continue
+			}
+			d.pending = append(d.pending, c)
+			i++
+		}
+	}
+	d.flush()
+	return d, nil
+}
+
+// control reads the control word or symbol following the backslash at
+// rtf[i-1], and returns the index after it.
+func (d *rtfDecoder) control(rtf []byte, i int) int {
+	if i >= len(rtf) {
+		return i
+	}
+	c := rtf[i]
+	if !isASCIILetter(c) {
+		// Control symbol
+		switch c {
+		case '\'':
+			if i+2 < len(rtf) {
+				if b, err := strconv.ParseUint(string(rtf[i+1:i+3]), 16, 8); err == nil && !d.skipChar() {
+					d.pending = append(d.pending, byte(b))
+				}
+			}
+			return i + 3
+		case '\\', '{', '}':
+			if !d.skipChar() {
+				d.pending = append(d.pending, c)
+			}
+		case '~':
+			d.emit(" ")
+		case '_':
+			d.emit("‑")
+		case '\r', '\n':
+			d.emit("\n")
+		case '*':
+			d.flush()
+			d.destination(rtf, i+1)
+		}
+		return i + 1
+	}
+
+	start := i
+	for i < len(rtf) && isASCIILetter(rtf[i]) {
+		i++
+	}
+	word := string(rtf[start:i])
+	numStart := i
+	if i < len(rtf) && rtf[i] == '-' {
+		i++
+	}
+	for i < len(rtf) && rtf[i] >= '0' && rtf[i] <= '9' {
+		i++
+	}
+	num, hasNum := 0, i > numStart
+	if hasNum {
+		num, _ = strconv.Atoi(string(rtf[numStart:i]))
+	}
+	if i < len(rtf) && rtf[i] == ' ' {
+		i++
+	}
+	d.word(word, num, hasNum)
+	return i
+}
+
+// destination handles the \* marking the group as a destination to skip when
+// the reader does not know it, at rtf[i].
+func (d *rtfDecoder) destination(rtf []byte, i int) {
+	for i < len(rtf) && (rtf[i] == ' ' || rtf[i] == '\r' || rtf[i] == '\n') {
+		i++
+	}
+	if bytes.HasPrefix(rtf[i:], []byte(`\htmltag`)) {
+		// HTML markup, not part of the RTF document
+		d.state.skipText = true
+		d.state.htmlRTF = false
+		return
+	}
+	d.state.skipText, d.state.skipHTML = true, true
+}
+
+// word handles the control word with its numeric parameter.
+func (d *rtfDecoder) word(word string, num int, hasNum bool) {
+	if d.skipChar() {
+		return
+	}
+	if s, ok := rtfSpecialChars[word]; ok {
+		d.emit(s)
+		return
+	}
+	d.flush()
+	switch word {
+	case "fromhtml":
+		d.fromHTML = !hasNum || num != 0
+	case "htmlrtf":
+		d.state.htmlRTF = !hasNum || num != 0
+	case "ansicpg":
+		d.charset = rtfCharset(num)
+	case "uc":
+		if num >= 0 {
+			d.state.uc = num
+		}
+	case "u":
+		r := rune(num)
+		if r < 0 {
+			r += 0x10000
+		}
+		d.skip = d.state.uc
+		switch {
+		case utf16.IsSurrogate(r) && r < 0xdc00:
+			d.surrogate = r
+			return
+		case utf16.IsSurrogate(r) && d.surrogate != 0:
+			r = utf16.DecodeRune(d.surrogate, r)
+		}
+		d.surrogate = 0
+		d.emit(string(r))
+	default:
+		if rtfSkipDestinations[word] {
+			d.state.skipText, d.state.skipHTML = true, true
+		}
+	}
+}
+
+// skipChar tells whether the next character stands for the last \u
+// character, and uses it up.
+func (d *rtfDecoder) skipChar() bool {
+	if d.skip > 0 {
+		d.skip--
+		return true
+	}
+	return false
+}
+
+// emit writes s to the text and the encapsulated HTML it is part of.
+func (d *rtfDecoder) emit(s string) {
+	d.flush()
+	if !d.state.skipText {
+		d.text.WriteString(s)
+	}
+	if !d.state.skipHTML && !d.state.htmlRTF {
+		d.html.WriteString(s)
+	}
+}
+
+// flush writes the pending bytes decoded from the code page.
+func (d *rtfDecoder) flush() {
+	if len(d.pending) == 0 {
+		return
+	}
+	s, _ := ConvertToUTF8String(d.charset, d.pending)
+	d.pending = d.pending[:0]
+	d.emit(s)
+}
+
+// rtfCharset returns the charset of the Windows code page cpg, windows-1252
+// if it is not supported.
+func rtfCharset(cpg int) string {
+	var charset string
+	switch cpg {
+	case 65001:
+		charset = "utf-8"
+	case 874:
+		charset = "windows-874"
+	default:
+		charset = "cp" + strconv.Itoa(cpg)
+	}
+	if !IsCharsetSupported(charset) {
+		return "windows-1252"
+	}
+	return CanonicalCharset(charset)
+}
+
+func isASCIILetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
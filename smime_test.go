@@ -0,0 +1,256 @@
+package enmime
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cention-sany/net/mail"
+	"github.com/stretchr/testify/assert"
+)
+
+func readSMIMEMessage(t *testing.T, filename string) *MIMEBody {
+	f, err := os.Open(filepath.Join("test-data", "smime", filename))
+	if err != nil {
+		t.Fatalf("Failed to open test data: %v", err)
+	}
+	defer f.Close()
+	m, err := ReadMIMEBody(f)
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+	return m
+}
+
+func readSMIMEPEM(t *testing.T, filename string) []byte {
+	data, err := ioutil.ReadFile(filepath.Join("test-data", "smime", filename))
+	if err != nil {
+		t.Fatalf("Failed to open test data: %v", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		t.Fatalf("No PEM data in %v", filename)
+	}
+	return block.Bytes
+}
+
+func smimeTestRoots(t *testing.T) *x509.CertPool {
+	ca, err := x509.ParseCertificate(readSMIMEPEM(t, "ca.pem"))
+	if err != nil {
+		t.Fatalf("Failed to parse certificate: %v", err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	return roots
+}
+
+func TestVerifySMIME(t *testing.T) {
+	roots := smimeTestRoots(t)
+	for _, name := range []string{"signed-detached.raw", "signed-opaque.raw", "signed-opaque-ber.raw"} {
+		m := readSMIMEMessage(t, name)
+		sig, err := m.VerifySMIME(roots)
+		if !assert.Nil(t, err, name) {
+			continue
+		}
+		if assert.Len(t, sig.Signers, 1, name) {
+			assert.Equal(t, "Alice", sig.Signers[0].Subject.CommonName, name)
+		}
+		assert.Equal(t, "text/plain", sig.Content.ContentType(), name)
+		assert.Equal(t, "This message is signed.\r\n", string(sig.Content.Content()), name)
+	}
+}
+
+func TestVerifySMIMEFailures(t *testing.T) {
+	roots := smimeTestRoots(t)
+
+	// Untrusted signer
+	m := readSMIMEMessage(t, "signed-detached.raw")
+	_, err := m.VerifySMIME(x509.NewCertPool())
+	assert.NotNil(t, err)
+
+	// Tampered signed part
+	forged, err := ReadMIMEBody(bytes.NewReader(
+		bytes.Replace(m.Raw(), []byte("is signed"), []byte("is forged"), 1)))
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+	_, err = forged.VerifySMIME(roots)
+	assert.NotNil(t, err)
+
+	// Original message not kept
+	msg, err := mail.ReadMessage(bytes.NewReader(m.Raw()))
+	if err != nil {
+		t.Fatalf("Failed to read message: %v", err)
+	}
+	m, err = ParseMIMEBody(msg)
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+	_, err = m.VerifySMIME(roots)
+	assert.Equal(t, errNoRawMessage, err)
+
+	// No signature
+	m = readSMIMEMessage(t, "encrypted-aes.raw")
+	_, err = m.VerifySMIME(roots)
+	assert.Equal(t, errNoSMIME, err)
+}
+
+func TestDecryptSMIME(t *testing.T) {
+	cert, err := x509.ParseCertificate(readSMIMEPEM(t, "alice.pem"))
+	if err != nil {
+		t.Fatalf("Failed to parse certificate: %v", err)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(readSMIMEPEM(t, "alice.key"))
+	if err != nil {
+		t.Fatalf("Failed to parse key: %v", err)
+	}
+	for _, name := range []string{"encrypted-aes.raw", "encrypted-3des.raw"} {
+		for _, c := range []*x509.Certificate{cert, nil} {
+			m := readSMIMEMessage(t, name)
+			root, err := m.DecryptSMIME(c, key.(*rsa.PrivateKey))
+			if !assert.Nil(t, err, name) {
+				continue
+			}
+			assert.Equal(t, "multipart/mixed", root.ContentType(), name)
+			text := root.FirstChild()
+			if assert.NotNil(t, text, name) {
+				assert.Equal(t, "Secret text.", string(text.Content()), name)
+				if att := text.NextSibling(); assert.NotNil(t, att, name) {
+					assert.Equal(t, "data.bin", att.FileName(), name)
+					assert.Equal(t, []byte{0, 1, 2, 3}, att.Content(), name)
+				}
+			}
+		}
+	}
+
+	// RSAES-OAEP with SHA-256
+	m := readSMIMEMessage(t, "encrypted-oaep.raw")
+	root, err := m.DecryptSMIME(cert, key.(*rsa.PrivateKey))
+	if assert.Nil(t, err) {
+		assert.Equal(t, "text/plain", root.ContentType())
+		assert.Equal(t, "Secret OAEP text.\r\n", string(root.Content()))
+	}
+
+	// Another recipient
+	other, err := x509.ParseCertificate(readSMIMEPEM(t, "ca.pem"))
+	if err != nil {
+		t.Fatalf("Failed to parse certificate: %v", err)
+	}
+	m = readSMIMEMessage(t, "encrypted-aes.raw")
+	_, err = m.DecryptSMIME(other, key.(*rsa.PrivateKey))
+	assert.NotNil(t, err)
+}
+
+func TestSignedBytes(t *testing.T) {
+	raw := "Content-Type: multipart/signed; boundary=b\n\n--b\n" +
+		"Content-Type: text/plain\n\nline\r\n--b\nContent-Type: text/plain\n\nsig\n--b--\n"
+	p, err := ParseMIME(bufio.NewReader(strings.NewReader(raw)))
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+	signed, err := signedBytes(p.FirstChild())
+	assert.Nil(t, err)
+	assert.Equal(t, "Content-Type: text/plain\r\n\r\nline", string(signed))
+
+	_, err = signedBytes(NewMIMEPart(nil, "text/plain"))
+	assert.Equal(t, errNoRawMessage, err)
+}
+
+// resignPKCS7 returns the opaque signed test message as a SignedData whose
+// signed attributes went through edit, signed again by Alice.
+func resignPKCS7(t *testing.T, edit func([]pkcs7Attribute) []pkcs7Attribute) []byte {
+	key, err := x509.ParsePKCS8PrivateKey(readSMIMEPEM(t, "alice.key"))
+	if err != nil {
+		t.Fatalf("Failed to parse key: %v", err)
+	}
+	m := readSMIMEMessage(t, "signed-opaque.raw")
+	data, err := pkcs7Content(m.Attachments[0].Content(), oidPKCS7SignedData)
+	if err != nil {
+		t.Fatalf("Failed to read PKCS #7: %v", err)
+	}
+	var sd pkcs7SignedData
+	if _, err := asn1.Unmarshal(data, &sd); err != nil {
+		t.Fatalf("Failed to read PKCS #7: %v", err)
+	}
+	si := &sd.SignerInfos[0]
+	var attrs []pkcs7Attribute
+	set := append([]byte{0x31}, si.AuthenticatedAttributes.FullBytes[1:]...)
+	if _, err := asn1.UnmarshalWithParams(set, &attrs, "set"); err != nil {
+		t.Fatalf("Failed to read PKCS #7: %v", err)
+	}
+	if set, err = asn1.MarshalWithParams(edit(attrs), "set"); err != nil {
+		t.Fatalf("Failed to write PKCS #7: %v", err)
+	}
+	hash := pkcs7Hash(si.DigestAlgorithm.Algorithm)
+	h := hash.New()
+	h.Write(set)
+	if si.EncryptedDigest, err = rsa.SignPKCS1v15(nil, key.(*rsa.PrivateKey), hash, h.Sum(nil)); err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+	si.AuthenticatedAttributes = asn1.RawValue{FullBytes: append([]byte{0xa0}, set[1:]...)}
+	if data, err = asn1.Marshal(sd); err != nil {
+		t.Fatalf("Failed to write PKCS #7: %v", err)
+	}
+	der, err := asn1.Marshal(pkcs7ContentInfo{ContentType: oidPKCS7SignedData, Content: explicitTag0(data)})
+	if err != nil {
+		t.Fatalf("Failed to write PKCS #7: %v", err)
+	}
+	return der
+}
+
+// explicitTag0 wraps b in an explicit [0] tag, which Marshal does not add to
+// a RawValue.
+func explicitTag0(b []byte) asn1.RawValue {
+	return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: b}
+}
+
+func TestVerifyPKCS7ContentType(t *testing.T) {
+	roots := smimeTestRoots(t)
+	unchanged := func(attrs []pkcs7Attribute) []pkcs7Attribute { return attrs }
+	_, content, err := VerifyPKCS7(resignPKCS7(t, unchanged), nil, roots)
+	assert.Nil(t, err)
+	assert.Contains(t, string(content), "This message is signed.")
+
+	missing := func(attrs []pkcs7Attribute) []pkcs7Attribute {
+		var kept []pkcs7Attribute
+		for _, a := range attrs {
+			if !a.Type.Equal(oidAttributeContentType) {
+				kept = append(kept, a)
+			}
+		}
+		return kept
+	}
+	_, _, err = VerifyPKCS7(resignPKCS7(t, missing), nil, roots)
+	assert.NotNil(t, err, "Content type attribute missing")
+
+	swapped := func(attrs []pkcs7Attribute) []pkcs7Attribute {
+		for i, a := range attrs {
+			if a.Type.Equal(oidAttributeContentType) {
+				v, _ := asn1.MarshalWithParams([]asn1.ObjectIdentifier{oidPKCS7EnvelopedData}, "set")
+				attrs[i].Values = asn1.RawValue{FullBytes: v}
+			}
+		}
+		return attrs
+	}
+	_, _, err = VerifyPKCS7(resignPKCS7(t, swapped), nil, roots)
+	assert.NotNil(t, err, "Content type attribute mismatched")
+}
+
+func TestBERToDERDepth(t *testing.T) {
+	nested := append(bytes.Repeat([]byte{0x30, 0x80}, 10), 0x04, 0x01, 'x')
+	nested = append(nested, bytes.Repeat([]byte{0, 0}, 10)...)
+	der, err := berToDER(nested)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0x30, 0x15}, der[:2])
+
+	_, err = berToDER(bytes.Repeat([]byte{0x30, 0x80}, 3e6))
+	assert.Equal(t, errPKCS7TooDeep, err)
+}
@@ -0,0 +1,259 @@
+package enmime
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/cention-sany/net/mail"
+	"golang.org/x/net/idna"
+)
+
+// SpoofIssue describes why the sender headers of a message look spoofed.
+type SpoofIssue string
+
+// Issues reported by SenderSpoofing
+const (
+	SpoofDisplayNameAddress SpoofIssue = "display-name-address" // Display name holds another email address
+	SpoofReplyToMismatch    SpoofIssue = "reply-to-mismatch"    // Reply-To domain differs from From domain
+	SpoofReturnPathMismatch SpoofIssue = "return-path-mismatch" // Return-Path domain differs from From domain
+	SpoofLookalikeDomain    SpoofIssue = "lookalike-domain"     // Domain resembles, but is not, a protected domain
+	SpoofMixedScriptName    SpoofIssue = "mixed-script-name"    // A word of the display name mixes scripts
+)
+
+// SpoofFinding is a single result of SenderSpoofing.
+type SpoofFinding struct {
+	Issue  SpoofIssue
+	Header string // Header the offending value was found in
+	Value  string // Offending display name or address
+	Detail string // Address or domain the value was compared with
+}
+
+// Headers whose domains are checked against the protected domains
+var spoofCheckHeaders = []string{"From", "Sender", "Reply-To"}
+
+var displayNameAddressRegexp = regexp.MustCompile(`[^\s<>"'()@,;:]+@[^\s<>"'()@,;:]+\.[^\s<>"'()@,;:]+`)
+
+// SenderSpoofing compares the From, Sender, Reply-To and Return-Path headers of
+// the message and reports display names containing another address than the
+// one they belong to, Reply-To and Return-Path domains that differ from the
+// From domain, domains that look like but are not one of the given protected
+// domains, and display names with words mixing scripts.
+func (m *MIMEBody) SenderSpoofing(protected []string) []SpoofFinding {
+	var findings []SpoofFinding
+	from, _ := m.AddressList("From")
+	var fromDomain string
+	if len(from) > 0 {
+		fromDomain = addressDomain(from[0].Address)
+	}
+
+	for _, key := range spoofCheckHeaders {
+		addrs, err := m.AddressList(key)
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			findings = append(findings, checkDisplayName(key, a)...)
+			domain := addressDomain(a.Address)
+			if f, ok := checkLookalike(key, domain, protected); ok {
+				findings = append(findings, f)
+			}
+			if key == "Reply-To" && fromDomain != "" && domain != "" &&
+				!sameRegisteredDomain(domain, fromDomain) {
+				findings = append(findings, SpoofFinding{
+					Issue:  SpoofReplyToMismatch,
+					Header: key,
+					Value:  a.Address,
+					Detail: fromDomain,
+				})
+			}
+		}
+	}
+
+	if rp := returnPathAddress(m.header.Get("Return-Path")); rp != "" {
+		domain := addressDomain(rp)
+		if f, ok := checkLookalike("Return-Path", domain, protected); ok {
+			findings = append(findings, f)
+		}
+		if fromDomain != "" && domain != "" && !sameRegisteredDomain(domain, fromDomain) {
+			findings = append(findings, SpoofFinding{
+				Issue:  SpoofReturnPathMismatch,
+				Header: "Return-Path",
+				Value:  rp,
+				Detail: fromDomain,
+			})
+		}
+	}
+	return findings
+}
+
+func checkDisplayName(key string, a *mail.Address) []SpoofFinding {
+	var findings []SpoofFinding
+	if a.Name == "" {
+		return nil
+	}
+	for _, addr := range displayNameAddressRegexp.FindAllString(a.Name, -1) {
+		if !strings.EqualFold(addr, a.Address) {
+			findings = append(findings, SpoofFinding{
+				Issue:  SpoofDisplayNameAddress,
+				Header: key,
+				Value:  a.Name,
+				Detail: a.Address,
+			})
+			break
+		}
+	}
+	for _, word := range strings.FieldsFunc(a.Name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r) && !unicode.IsMark(r)
+	}) {
+		if len(scriptsOf(word)) > 1 {
+			findings = append(findings, SpoofFinding{
+				Issue:  SpoofMixedScriptName,
+				Header: key,
+				Value:  a.Name,
+				Detail: word,
+			})
+			break
+		}
+	}
+	return findings
+}
+
+// checkLookalike compares domain with each protected domain.
+func checkLookalike(key, domain string, protected []string) (SpoofFinding, bool) {
+	if domain == "" {
+		return SpoofFinding{}, false
+	}
+	for _, p := range protected {
+		p = normalizeDomain(p)
+		if p == "" || domain == p || strings.HasSuffix(domain, "."+p) {
+			continue
+		}
+		if IsLookalikeDomain(domain, p) {
+			return SpoofFinding{
+				Issue:  SpoofLookalikeDomain,
+				Header: key,
+				Value:  domain,
+				Detail: p,
+			}, true
+		}
+	}
+	return SpoofFinding{}, false
+}
+
+// IsLookalikeDomain reports whether domain could be mistaken for protected:
+// their registered domains share the same confusable skeleton, differ by a
+// single edit, or domain embeds protected as one of its sub-domains, as in
+// paypal.com.example.net.  Identical domains are not lookalikes.
+func IsLookalikeDomain(domain, protected string) bool {
+	domain = normalizeDomain(domain)
+	protected = normalizeDomain(protected)
+	if domain == "" || protected == "" || domain == protected {
+		return false
+	}
+	rd, rp := registeredDomain(domain), registeredDomain(protected)
+	if rd == rp {
+		return false
+	}
+	if strings.HasPrefix(domain, protected+".") || strings.Contains(domain, "."+protected+".") {
+		return true
+	}
+	if domainSkeleton(rd) == domainSkeleton(rp) {
+		return true
+	}
+	// Compare the labels left of the TLD, so paypa1.com and paypal.net are
+	// caught alike.
+	ld, lp := firstLabel(rd), firstLabel(rp)
+	return len([]rune(lp)) >= 5 && editDistanceAtMostOne(ld, lp)
+}
+
+// domainSkeleton maps every character of a domain to the ASCII character it
+// looks like, so lookalike domains share the same skeleton.
+func domainSkeleton(domain string) string {
+	var b strings.Builder
+	for _, r := range domain {
+		if l, ok := confusables[r]; ok {
+			r = l
+		}
+		switch r {
+		case '0':
+			r = 'o'
+		case '1', 'i', '|':
+			r = 'l'
+		case '5':
+			r = 's'
+		}
+		b.WriteRune(r)
+	}
+	s := b.String()
+	s = strings.Replace(s, "rn", "m", -1)
+	s = strings.Replace(s, "vv", "w", -1)
+	s = strings.Replace(s, "cl", "d", -1)
+	return s
+}
+
+func firstLabel(domain string) string {
+	if i := strings.Index(domain, "."); i >= 0 {
+		return domain[:i]
+	}
+	return domain
+}
+
+// editDistanceAtMostOne reports whether a and b differ by at most one
+// insertion, deletion, substitution or transposition of adjacent runes.
+func editDistanceAtMostOne(a, b string) bool {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) < len(rb) {
+		ra, rb = rb, ra
+	}
+	if len(ra)-len(rb) > 1 {
+		return false
+	}
+	i := 0
+	for i < len(rb) && ra[i] == rb[i] {
+		i++
+	}
+	if i == len(rb) {
+		return true
+	}
+	if len(ra) != len(rb) {
+		return string(ra[i+1:]) == string(rb[i:])
+	}
+	if string(ra[i+1:]) == string(rb[i+1:]) {
+		return true
+	}
+	return i+1 < len(ra) && ra[i] == rb[i+1] && ra[i+1] == rb[i] &&
+		string(ra[i+2:]) == string(rb[i+2:])
+}
+
+func addressDomain(addr string) string {
+	i := strings.LastIndex(addr, "@")
+	if i < 0 {
+		return ""
+	}
+	return normalizeDomain(addr[i+1:])
+}
+
+// normalizeDomain lower-cases a domain and converts punycode labels to Unicode.
+func normalizeDomain(domain string) string {
+	domain = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+	if hasPunycodeLabel(domain) {
+		if d, err := idna.ToUnicode(domain); err == nil {
+			domain = d
+		}
+	}
+	return domain
+}
+
+// returnPathAddress extracts the address of a Return-Path header, which may
+// be the null path "<>".
+func returnPathAddress(v string) string {
+	v = strings.TrimSpace(v)
+	if i := strings.Index(v, "<"); i >= 0 {
+		v = v[i+1:]
+		if j := strings.Index(v, ">"); j >= 0 {
+			v = v[:j]
+		}
+	}
+	return strings.TrimSpace(v)
+}
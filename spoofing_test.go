@@ -0,0 +1,120 @@
+package enmime
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cention-sany/net/mail"
+	"github.com/stretchr/testify/assert"
+)
+
+// parseHeaderOnly builds a MIMEBody from a plain text message with the given
+// header block.
+func parseHeaderOnly(t *testing.T, header string) *MIMEBody {
+	msg, err := mail.ReadMessage(strings.NewReader(header + "\r\n\r\nbody\r\n"))
+	if err != nil {
+		t.Fatalf("Failed to read message: %v", err)
+	}
+	mime, err := ParseMIMEBody(msg)
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+	return mime
+}
+
+func TestSenderSpoofingClean(t *testing.T) {
+	mime := parseHeaderOnly(t, "From: Support <support@example.com>\r\n"+
+		"Reply-To: help@mail.example.com\r\n"+
+		"Return-Path: <bounces@example.com>")
+
+	assert.Empty(t, mime.SenderSpoofing([]string{"example.com", "paypal.com"}))
+}
+
+func TestSenderSpoofingDisplayNameAddress(t *testing.T) {
+	mime := parseHeaderOnly(t, `From: "service@paypal.com" <attacker@evil.example>`)
+
+	findings := mime.SenderSpoofing(nil)
+	if assert.Equal(t, 1, len(findings)) {
+		assert.Equal(t, SpoofDisplayNameAddress, findings[0].Issue)
+		assert.Equal(t, "From", findings[0].Header)
+		assert.Equal(t, "service@paypal.com", findings[0].Value)
+		assert.Equal(t, "attacker@evil.example", findings[0].Detail)
+	}
+
+	mime = parseHeaderOnly(t, `From: "Bob (bob@example.com)" <bob@example.com>`)
+	assert.Empty(t, mime.SenderSpoofing(nil), "Own address in display name is fine")
+}
+
+func TestSenderSpoofingDomainMismatch(t *testing.T) {
+	mime := parseHeaderOnly(t, "From: CEO <ceo@example.com>\r\n"+
+		"Reply-To: ceo.private@freemail.example\r\n"+
+		"Return-Path: <>")
+
+	findings := mime.SenderSpoofing(nil)
+	if assert.Equal(t, 1, len(findings)) {
+		assert.Equal(t, SpoofReplyToMismatch, findings[0].Issue)
+		assert.Equal(t, "ceo.private@freemail.example", findings[0].Value)
+		assert.Equal(t, "example.com", findings[0].Detail)
+	}
+
+	mime = parseHeaderOnly(t, "From: CEO <ceo@example.com>\r\n"+
+		"Return-Path: <bounce@mailer.example.net>")
+	findings = mime.SenderSpoofing(nil)
+	if assert.Equal(t, 1, len(findings)) {
+		assert.Equal(t, SpoofReturnPathMismatch, findings[0].Issue)
+		assert.Equal(t, "Return-Path", findings[0].Header)
+		assert.Equal(t, "bounce@mailer.example.net", findings[0].Value)
+	}
+}
+
+func TestSenderSpoofingLookalike(t *testing.T) {
+	mime := parseHeaderOnly(t, "From: PayPal <service@paypa1.com>\r\n"+
+		"Reply-To: service@paypal.com")
+
+	findings := mime.SenderSpoofing([]string{"paypal.com"})
+	if assert.Equal(t, 2, len(findings)) {
+		assert.Equal(t, SpoofLookalikeDomain, findings[0].Issue)
+		assert.Equal(t, "From", findings[0].Header)
+		assert.Equal(t, "paypa1.com", findings[0].Value)
+		assert.Equal(t, "paypal.com", findings[0].Detail)
+		assert.Equal(t, SpoofReplyToMismatch, findings[1].Issue)
+	}
+}
+
+func TestSenderSpoofingMixedScript(t *testing.T) {
+	mime := parseHeaderOnly(t, "From: =?utf-8?b?0KBheVBhbA==?= <service@example.com>")
+
+	findings := mime.SenderSpoofing(nil)
+	if assert.Equal(t, 1, len(findings)) {
+		assert.Equal(t, SpoofMixedScriptName, findings[0].Issue)
+		assert.Equal(t, "РayPal", findings[0].Detail)
+	}
+
+	mime = parseHeaderOnly(t, "From: =?utf-8?b?0JjQstCw0L0gSXZhbm92?= <ivan@example.com>")
+	assert.Empty(t, mime.SenderSpoofing(nil), "Words in different scripts are fine")
+}
+
+func TestIsLookalikeDomain(t *testing.T) {
+	var testTable = []struct {
+		domain, protected string
+		expect            bool
+	}{
+		{"example.com", "example.com", false},
+		{"mail.example.com", "example.com", false},
+		{"examp1e.com", "example.com", true},
+		{"exarnple.com", "example.com", true},
+		{"exampel.com", "example.com", true},
+		{"examples.com", "example.com", true},
+		{"example.net", "example.com", true},
+		{"example.com.evil.net", "example.com", true},
+		{"xn--exmple-4nf.com", "example.com", true},
+		{"другой.com", "example.com", false},
+		{"foo.com", "bar.com", false},
+		{"ibm.com", "ibn.com", false},
+	}
+
+	for _, tt := range testTable {
+		assert.Equal(t, tt.expect, IsLookalikeDomain(tt.domain, tt.protected),
+			"IsLookalikeDomain(%q, %q)", tt.domain, tt.protected)
+	}
+}
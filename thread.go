@@ -0,0 +1,284 @@
+package enmime
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Thread is a node of the conversation forest built by ThreadMessages.
+type Thread struct {
+	Message   *MIMEBody // nil for a message that is referenced but missing
+	MessageID string
+	Children  []*Thread // Replies, oldest first
+}
+
+// threadContainer is a container of the JWZ threading algorithm.
+type threadContainer struct {
+	id       string
+	msg      *MIMEBody
+	order    int
+	parent   *threadContainer
+	children []*threadContainer
+}
+
+// Subject prefixes of replies and forwards, and mailing list tags
+var subjectPrefixRegexp = regexp.MustCompile(
+	`(?i)^\s*(((re|fwd?|aw|sv|vs|antw|wg|tr|rif|odp)\s*(\[\d+\]|\(\d+\))?\s*[:：])|\[[^\]]*\])\s*`)
+
+// ThreadMessages groups msgs into conversations using Jamie Zawinski's
+// threading algorithm.  Messages are linked through their References and
+// In-Reply-To headers; root messages left over with the same base subject
+// are gathered into one thread.  A missing message that several messages
+// refer to shows up as a Thread without Message.  Threads and replies are
+// sorted by date.
+func ThreadMessages(msgs []*MIMEBody) []*Thread {
+	ids := make(map[string]*threadContainer)
+	var all []*threadContainer
+	get := func(id string) *threadContainer {
+		c := ids[id]
+		if c == nil {
+			c = &threadContainer{id: id, order: len(all)}
+			ids[id] = c
+			all = append(all, c)
+		}
+		return c
+	}
+
+	for _, m := range msgs {
+		id := m.MessageID()
+		var c *threadContainer
+		if id != "" && ids[id] != nil && ids[id].msg == nil {
+			c = ids[id]
+			c.order = len(all)
+		} else {
+			// A missing or duplicate Message-ID gets a container of its own
+			c = &threadContainer{id: id, order: len(all)}
+			all = append(all, c)
+			if id != "" && ids[id] == nil {
+				ids[id] = c
+			}
+		}
+		c.msg = m
+
+		refs := m.References()
+		if irt := m.InReplyTo(); len(irt) > 0 && (len(refs) == 0 || refs[len(refs)-1] != irt[0]) {
+			refs = append(refs, irt[0])
+		}
+		var prev *threadContainer
+		for _, ref := range refs {
+			if ref == id {
+				continue
+			}
+			rc := get(ref)
+			if prev != nil && rc.parent == nil {
+				prev.link(rc)
+			}
+			prev = rc
+		}
+		// The last reference is the parent, whatever the others said
+		if c.parent != nil {
+			c.parent.unlink(c)
+		}
+		if prev != nil {
+			prev.link(c)
+		}
+	}
+
+	var roots []*threadContainer
+	for _, c := range all {
+		if c.parent == nil {
+			roots = append(roots, c)
+		}
+	}
+	roots = pruneThreads(roots, true)
+	roots = groupBySubject(roots)
+
+	threads := make([]*Thread, len(roots))
+	sortThreads(roots)
+	for i, c := range roots {
+		threads[i] = c.thread()
+	}
+	return threads
+}
+
+// link makes child a child of c, unless that would create a loop.
+func (c *threadContainer) link(child *threadContainer) {
+	if c == child || child.parent != nil {
+		return
+	}
+	for p := c; p != nil; p = p.parent {
+		if p == child {
+			return
+		}
+	}
+	child.parent = c
+	c.children = append(c.children, child)
+}
+
+func (c *threadContainer) unlink(child *threadContainer) {
+	for i, cc := range c.children {
+		if cc == child {
+			c.children = append(c.children[:i], c.children[i+1:]...)
+			break
+		}
+	}
+	child.parent = nil
+}
+
+// pruneThreads drops containers without message nor children, and replaces
+// the containers without message by their children, except at the root when
+// that would split a thread.
+func pruneThreads(list []*threadContainer, root bool) []*threadContainer {
+	var kept []*threadContainer
+	for _, c := range list {
+		c.children = pruneThreads(c.children, false)
+		switch {
+		case c.msg != nil:
+			kept = append(kept, c)
+		case len(c.children) == 0:
+		case !root || len(c.children) == 1:
+			for _, cc := range c.children {
+				cc.parent = c.parent
+			}
+			kept = append(kept, c.children...)
+		default:
+			kept = append(kept, c)
+		}
+	}
+	return kept
+}
+
+// groupBySubject gathers root threads whose subjects only differ by reply
+// prefixes, for messages that lost their references.
+func groupBySubject(roots []*threadContainer) []*threadContainer {
+	table := make(map[string]*threadContainer)
+	for _, c := range roots {
+		subject, reply := c.subject()
+		if subject == "" {
+			continue
+		}
+		old := table[subject]
+		if old == nil {
+			table[subject] = c
+			continue
+		}
+		_, oldReply := old.subject()
+		if c.msg == nil && old.msg != nil || c.msg != nil && old.msg != nil && oldReply && !reply {
+			table[subject] = c
+		}
+	}
+
+	var result []*threadContainer
+	replaced := make(map[*threadContainer]*threadContainer)
+	for _, c := range roots {
+		subject, reply := c.subject()
+		other := table[subject]
+		if subject == "" || other == nil || other == c || replaced[c] != nil {
+			result = append(result, c)
+			continue
+		}
+		_, otherReply := other.subject()
+		switch {
+		case other.msg == nil && c.msg == nil:
+			for _, cc := range c.children {
+				cc.parent = other
+			}
+			other.children = append(other.children, c.children...)
+		case other.msg == nil:
+			other.link(c)
+		case !otherReply && reply:
+			other.link(c)
+		default:
+			// Siblings under a new container
+			holder := &threadContainer{order: other.order}
+			if r := replaced[other]; r != nil {
+				holder = r
+			} else {
+				replaced[other] = holder
+				table[subject] = holder
+				other.parent = nil
+				holder.link(other)
+			}
+			holder.link(c)
+		}
+	}
+	for i, c := range result {
+		if r := replaced[c]; r != nil {
+			result[i] = r
+		}
+	}
+	return result
+}
+
+// subject returns the base subject of the thread and whether it is a reply.
+func (c *threadContainer) subject() (string, bool) {
+	m := c.msg
+	if m == nil {
+		if len(c.children) == 0 || c.children[0].msg == nil {
+			return "", false
+		}
+		m = c.children[0].msg
+	}
+	return BaseSubject(m.GetHeader("Subject"))
+}
+
+// BaseSubject strips the reply and forward prefixes and the mailing list
+// tags of subject, reporting whether any reply or forward prefix was found.
+func BaseSubject(subject string) (string, bool) {
+	reply := false
+	for {
+		loc := subjectPrefixRegexp.FindStringSubmatchIndex(subject)
+		if loc == nil {
+			break
+		}
+		if loc[4] >= 0 {
+			reply = true
+		}
+		subject = subject[loc[1]:]
+	}
+	subject = strings.TrimSpace(subject)
+	if s := strings.TrimSuffix(strings.TrimSuffix(subject, "(fwd)"), "(Fwd)"); s != subject {
+		subject, reply = strings.TrimSpace(s), true
+	}
+	return strings.Join(strings.Fields(strings.ToLower(subject)), " "), reply
+}
+
+// date returns the date of the message of the container, or of its oldest
+// descendant if it has none.
+func (c *threadContainer) date() (time.Time, int) {
+	if c.msg != nil {
+		d, _ := c.msg.Date()
+		return d, c.order
+	}
+	var best time.Time
+	order := c.order
+	for i, cc := range c.children {
+		d, o := cc.date()
+		if i == 0 || d.Before(best) {
+			best, order = d, o
+		}
+	}
+	return best, order
+}
+
+func sortThreads(list []*threadContainer) {
+	sort.SliceStable(list, func(i, j int) bool {
+		di, oi := list[i].date()
+		dj, oj := list[j].date()
+		if !di.Equal(dj) {
+			return di.Before(dj)
+		}
+		return oi < oj
+	})
+}
+
+func (c *threadContainer) thread() *Thread {
+	t := &Thread{Message: c.msg, MessageID: c.id}
+	sortThreads(c.children)
+	for _, cc := range c.children {
+		t.Children = append(t.Children, cc.thread())
+	}
+	return t
+}
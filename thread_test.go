@@ -0,0 +1,105 @@
+package enmime
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// threadMessage builds a message for threading tests.
+func threadMessage(t *testing.T, id, subject, date, refs, inReplyTo string) *MIMEBody {
+	header := fmt.Sprintf("Subject: %s\r\nDate: %s", subject, date)
+	if id != "" {
+		header += "\r\nMessage-ID: <" + id + ">"
+	}
+	if refs != "" {
+		header += "\r\nReferences: " + refs
+	}
+	if inReplyTo != "" {
+		header += "\r\nIn-Reply-To: " + inReplyTo
+	}
+	return parseHeaderOnly(t, header)
+}
+
+// formatThreads renders a forest as "id(child child)" for comparison.
+func formatThreads(threads []*Thread) string {
+	var parts []string
+	for _, th := range threads {
+		s := th.MessageID
+		if th.Message == nil {
+			s = "[" + s + "]"
+		}
+		if len(th.Children) > 0 {
+			s += "(" + formatThreads(th.Children) + ")"
+		}
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestThreadMessages(t *testing.T) {
+	msgs := []*MIMEBody{
+		threadMessage(t, "d", "Re: Lunch", "Tue, 1 Jul 2003 12:00:00 +0000", "<a> <b>", "<b>"),
+		threadMessage(t, "a", "Lunch", "Tue, 1 Jul 2003 09:00:00 +0000", "", ""),
+		threadMessage(t, "c", "Re: Lunch", "Tue, 1 Jul 2003 11:00:00 +0000", "", "<a>"),
+		threadMessage(t, "b", "Re: Lunch", "Tue, 1 Jul 2003 10:00:00 +0000", "<a>", ""),
+		threadMessage(t, "x", "Other topic", "Mon, 30 Jun 2003 09:00:00 +0000", "", ""),
+		// Parent missing, siblings keep the placeholder
+		threadMessage(t, "m2", "Re: Meeting", "Tue, 1 Jul 2003 13:00:00 +0000", "<m1>", ""),
+		threadMessage(t, "m3", "Re: Meeting", "Tue, 1 Jul 2003 14:00:00 +0000", "<m1>", ""),
+		// Parent missing, only child is promoted
+		threadMessage(t, "p2", "Re: Party", "Tue, 1 Jul 2003 15:00:00 +0000", "<p1>", ""),
+	}
+
+	threads := ThreadMessages(msgs)
+	assert.Equal(t, "x a(b(d) c) [m1](m2 m3) p2", formatThreads(threads))
+	assert.Equal(t, msgs[1], threads[1].Message)
+}
+
+func TestThreadMessagesBySubject(t *testing.T) {
+	msgs := []*MIMEBody{
+		threadMessage(t, "r1", "Re: [list] Release plan", "Tue, 1 Jul 2003 10:00:00 +0000", "", ""),
+		threadMessage(t, "s", "[list] Release plan", "Tue, 1 Jul 2003 09:00:00 +0000", "", ""),
+		threadMessage(t, "r2", "AW: Release  plan", "Tue, 1 Jul 2003 11:00:00 +0000", "", ""),
+		threadMessage(t, "n1", "Status", "Tue, 1 Jul 2003 12:00:00 +0000", "", ""),
+		threadMessage(t, "n2", "Status", "Tue, 1 Jul 2003 13:00:00 +0000", "", ""),
+		threadMessage(t, "", "Fwd: Status", "Tue, 1 Jul 2003 14:00:00 +0000", "", ""),
+	}
+
+	threads := ThreadMessages(msgs)
+	assert.Equal(t, "s(r1 r2) [](n1 n2 )", formatThreads(threads))
+}
+
+func TestThreadMessagesLoop(t *testing.T) {
+	msgs := []*MIMEBody{
+		threadMessage(t, "a", "One", "Tue, 1 Jul 2003 09:00:00 +0000", "<b>", ""),
+		threadMessage(t, "b", "Two", "Tue, 1 Jul 2003 10:00:00 +0000", "<a>", ""),
+		threadMessage(t, "c", "Three", "Tue, 1 Jul 2003 11:00:00 +0000", "<c>", ""),
+	}
+
+	assert.Equal(t, "b(a) c", formatThreads(ThreadMessages(msgs)))
+}
+
+func TestBaseSubject(t *testing.T) {
+	var testTable = []struct {
+		input  string
+		expect string
+		reply  bool
+	}{
+		{"Hello", "hello", false},
+		{"Re: Hello", "hello", true},
+		{"RE: re[2]: Fwd: Hello", "hello", true},
+		{"[list] Re: Hello", "hello", true},
+		{"Hello (fwd)", "hello", true},
+		{"Re:Hello   world", "hello world", true},
+		{"Regarding: Hello", "regarding: hello", false},
+	}
+
+	for _, tt := range testTable {
+		subject, reply := BaseSubject(tt.input)
+		assert.Equal(t, tt.expect, subject, "Input %q", tt.input)
+		assert.Equal(t, tt.reply, reply, "Input %q", tt.input)
+	}
+}
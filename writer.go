@@ -0,0 +1,189 @@
+package enmime
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/cention-sany/mime"
+	"github.com/cention-sany/mime/quotedprintable"
+)
+
+// WriteTo writes the message to w, with its header fields and parts as they
+// are now.  What did not change since ReadMIMEBody is copied from the original
+// message byte for byte, so that signatures over it still verify.  The rest is
+// written again: multipart bodies lose their preamble and epilogue, and leaf
+// contents are encoded by their Content-Transfer-Encoding.  A message without
+// parts can only be written with its original body.
+func (m *MIMEBody) WriteTo(w io.Writer) (int64, error) {
+	mw := &mimeWriter{w: w, nl: lineBreak(m.raw)}
+	bodyStart := 0
+	if m.raw != nil {
+		bodyStart = rawHeaderEnd(m.raw, 0, len(m.raw))
+	}
+	if m.raw == nil || m.fields != nil {
+		mw.writeFields(m.HeaderFields())
+	} else {
+		mw.write(m.raw[:bodyStart])
+	}
+
+	root, _ := m.Root.(*memMIMEPart)
+	_, params, _ := mime.ParseMediaType(m.header.Get("Content-Type"))
+	switch {
+	case root != nil && strings.HasPrefix(root.contentType, "multipart/"):
+		mw.writeBody(root, params["boundary"], "")
+	case root != nil && len(m.Attachments) > 0 && m.Attachments[0].Parent() == nil:
+		// Single part message, see binMIME.  The header of the part is the
+		// header of the message.
+		if p, ok := m.Attachments[0].(*memMIMEPart); ok {
+			mw.writeBody(p, "", m.header.Get("Content-Transfer-Encoding"))
+		}
+	case m.raw != nil:
+		mw.write(m.raw[bodyStart:])
+	default:
+		return 0, errNoRawMessage
+	}
+	return mw.n, mw.err
+}
+
+// Bytes returns the message as WriteTo writes it.
+func (m *MIMEBody) Bytes() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	if _, err := m.WriteTo(buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// mimeWriter writes a message, remembering the first error like bufio.Writer.
+type mimeWriter struct {
+	w   io.Writer
+	nl  string // Line break of the message
+	n   int64
+	err error
+}
+
+func (mw *mimeWriter) write(b []byte) {
+	if mw.err != nil {
+		return
+	}
+	n, err := mw.w.Write(b)
+	mw.n += int64(n)
+	mw.err = err
+}
+
+func (mw *mimeWriter) writeString(s string) {
+	mw.write([]byte(s))
+}
+
+// writeLines writes text with its line breaks replaced by the ones of the
+// message.
+func (mw *mimeWriter) writeLines(text string) {
+	text = strings.Replace(text, "\r\n", "\n", -1)
+	if mw.nl != "\n" {
+		text = strings.Replace(text, "\n", mw.nl, -1)
+	}
+	mw.writeString(text)
+}
+
+// writeFields writes a header block with its empty line.
+func (mw *mimeWriter) writeFields(fields HeaderFields) {
+	for _, f := range fields {
+		raw := f.Raw
+		if raw == "" && f.Value != "" {
+			raw = " " + EncodeHeader(f.Name, f.Value)
+		} else if raw != "" && raw[0] != ' ' && raw[0] != '\t' {
+			raw = " " + raw
+		}
+		mw.writeLines(f.Name + ":" + raw + "\n")
+	}
+	mw.writeString(mw.nl)
+}
+
+// writePart writes the header and body of a part nested in a multipart.
+func (mw *mimeWriter) writePart(p *memMIMEPart) {
+	if header := p.RawHeader(); header != nil && p.fields == nil {
+		mw.write(header)
+	} else {
+		mw.writeFields(p.HeaderFields())
+	}
+	_, params, _ := mime.ParseMediaType(p.header.Get("Content-Type"))
+	boundary := ""
+	if !strings.HasPrefix(p.contentType, "text/") {
+		boundary = params["boundary"]
+	}
+	mw.writeBody(p, boundary, p.header.Get("Content-Transfer-Encoding"))
+}
+
+// writeBody writes the body of p, a multipart when boundary is not empty, or
+// else content encoded with cte.
+func (mw *mimeWriter) writeBody(p *memMIMEPart, boundary, cte string) {
+	if content := p.RawContent(); content != nil && !p.modified() {
+		mw.write(content)
+		return
+	}
+	if boundary == "" {
+		mw.write(encodeContent(p.content, cte, mw.nl))
+		return
+	}
+	for c := p.firstChild; c != nil; c = c.NextSibling() {
+		cp, ok := c.(*memMIMEPart)
+		if !ok {
+			mw.err = fmt.Errorf("Cannot write part of type %T", c)
+			return
+		}
+		mw.writeString("--" + boundary + mw.nl)
+		mw.writePart(cp)
+		mw.writeString(mw.nl)
+	}
+	mw.writeString("--" + boundary + "--" + mw.nl)
+}
+
+// modified tells whether the body of p has to be written again because it
+// or a part inside it changed.
+func (p *memMIMEPart) modified() bool {
+	if p.changed {
+		return true
+	}
+	for c := p.firstChild; c != nil; c = c.NextSibling() {
+		if cp, ok := c.(*memMIMEPart); !ok || cp.fields != nil || cp.modified() {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeContent applies the Content-Transfer-Encoding cte to content, with
+// nl line breaks.  Identity encodings leave the content as it is.
+func encodeContent(content []byte, cte, nl string) []byte {
+	buf := new(bytes.Buffer)
+	switch strings.ToLower(strings.TrimSpace(cte)) {
+	case "base64":
+		encoded := base64.StdEncoding.EncodeToString(content)
+		for len(encoded) > 76 {
+			buf.WriteString(encoded[:76] + nl)
+			encoded = encoded[76:]
+		}
+		buf.WriteString(encoded)
+	case "quoted-printable":
+		qp := quotedprintable.NewWriter(buf)
+		qp.Write(content)
+		qp.Close()
+		if nl != "\r\n" {
+			return bytes.Replace(buf.Bytes(), []byte("\r\n"), []byte(nl), -1)
+		}
+	default:
+		buf.Write(content)
+	}
+	return buf.Bytes()
+}
+
+// lineBreak returns the line break used by raw, CRLF if unknown.
+func lineBreak(raw []byte) string {
+	if i := bytes.IndexByte(raw, '\n'); i >= 0 && (i == 0 || raw[i-1] != '\r') {
+		return "\n"
+	}
+	return "\r\n"
+}
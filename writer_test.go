@@ -0,0 +1,177 @@
+package enmime
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cention-sany/net/mail"
+	"github.com/stretchr/testify/assert"
+)
+
+const writerTestMessage = "Received: from a.example.com by b.example.net; Mon, 2 Mar 2020 10:00:01 +0000\r\n" +
+	"From: Alice <alice@example.com>\r\n" +
+	"To: bob@example.com\r\n" +
+	"Bcc: carol@example.com\r\n" +
+	"Subject: Hello\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=b\r\n" +
+	"\r\n" +
+	"Preamble\r\n" +
+	"--b\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"\r\n" +
+	"Body\r\n" +
+	"--b\r\n" +
+	"Content-Type: application/octet-stream\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"AAECAw==\r\n" +
+	"--b--\r\n"
+
+var writerUnchangedTestTable = []string{
+	"attachment.raw",
+	"html-mime-inline.raw",
+	"mime-mixed.raw",
+	"mime-signed.raw",
+	"non-mime.raw",
+	"other-parts.raw",
+	"quoted-printable-mime.raw",
+}
+
+func TestWriteToUnchanged(t *testing.T) {
+	for _, name := range writerUnchangedTestTable {
+		raw, err := ioutil.ReadFile(filepath.Join("test-data", "mail", name))
+		if err != nil {
+			t.Fatalf("Failed to open test data: %v", err)
+		}
+		m, err := ReadMIMEBody(bytes.NewReader(raw))
+		if err != nil {
+			t.Fatalf("Failed to parse MIME: %v", err)
+		}
+		b, err := m.Bytes()
+		if assert.Nil(t, err, name) {
+			assert.Equal(t, string(raw), string(b), name)
+		}
+	}
+}
+
+func TestWriteToEditedHeader(t *testing.T) {
+	m, err := ReadMIMEBody(strings.NewReader(writerTestMessage))
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+	fields := m.HeaderFields().
+		Prepend("X-Spam-Status", "Yes, score=7.1").
+		Delete("bcc").
+		Set("Subject", "[SPAM] Grüße").
+		SetAddresses("To", []*mail.Address{{Name: "Bob Jönsson", Address: "bob@example.com"}})
+	m.SetHeaderFields(fields)
+
+	assert.Equal(t, "[SPAM] Grüße", m.GetHeader("Subject"))
+	assert.Equal(t, "Yes, score=7.1", m.GetHeader("X-Spam-Status"))
+	assert.Equal(t, "", m.GetHeader("Bcc"))
+	to, err := m.AddressList("To")
+	if assert.Nil(t, err) && assert.Len(t, to, 1) {
+		assert.Equal(t, "Bob Jönsson", to[0].Name)
+	}
+	assert.Equal(t, fields, m.HeaderFields())
+
+	b, err := m.Bytes()
+	if err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+	s := string(b)
+	assert.True(t, strings.HasPrefix(s, "X-Spam-Status: Yes, score=7.1\r\nReceived: "))
+	assert.Contains(t, s, "\r\nSubject: [SPAM] =?UTF-8?")
+	assert.NotContains(t, s, "Bcc")
+	body := writerTestMessage[strings.Index(writerTestMessage, "\r\n\r\n"):]
+	assert.True(t, strings.HasSuffix(s, body), "Body should be kept as it was")
+
+	m, err = ReadMIMEBody(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+	assert.Equal(t, "[SPAM] Grüße", m.GetHeader("Subject"))
+	assert.Equal(t, "Body", m.Text)
+}
+
+func TestWriteToEditedPart(t *testing.T) {
+	m, err := ReadMIMEBody(strings.NewReader(writerTestMessage))
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+	p := m.Root.FirstChild().NextSibling().(HeaderFieldsPart)
+	p.SetHeaderFields(p.HeaderFields().Add("Content-Disposition", `attachment; filename="data.bin"`))
+	assert.Equal(t, "attachment", p.Disposition())
+	assert.Equal(t, "data.bin", p.FileName())
+	assert.Equal(t, "application/octet-stream", p.ContentType())
+
+	b, err := m.Bytes()
+	if err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+	s := string(b)
+	assert.NotContains(t, s, "Preamble")
+	assert.Contains(t, s, "--b\r\nContent-Type: text/plain\r\n\r\nBody\r\n--b\r\n")
+	assert.Contains(t, s, "Content-Transfer-Encoding: base64\r\n"+
+		"Content-Disposition: attachment; filename=\"data.bin\"\r\n\r\nAAECAw==\r\n--b--\r\n")
+
+	m, err = ReadMIMEBody(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+	if assert.Len(t, m.Attachments, 1) {
+		assert.Equal(t, "data.bin", m.Attachments[0].FileName())
+		assert.Equal(t, []byte{0, 1, 2, 3}, m.Attachments[0].Content())
+	}
+}
+
+func TestWriteToWithoutOriginal(t *testing.T) {
+	msg, err := mail.ReadMessage(strings.NewReader(writerTestMessage))
+	if err != nil {
+		t.Fatalf("Failed to read message: %v", err)
+	}
+	m, err := ParseMIMEBody(msg)
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+	b, err := m.Bytes()
+	if err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+	m, err = ReadMIMEBody(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+	assert.Equal(t, "Hello", m.GetHeader("Subject"))
+	assert.Equal(t, "Body", m.Text)
+	p := m.Root.FirstChild().NextSibling()
+	if assert.NotNil(t, p) {
+		assert.Equal(t, []byte{0, 1, 2, 3}, p.Content())
+	}
+
+	m = parseHeaderOnly(t, "Subject: Text only")
+	_, err = m.Bytes()
+	assert.Equal(t, errNoRawMessage, err)
+}
+
+var encodeContentTestTable = []struct {
+	cte, nl string
+	content string
+	want    string
+}{
+	{"7bit", "\r\n", "a\r\nb", "a\r\nb"},
+	{"Base64", "\n", strings.Repeat("x", 60), strings.Repeat("eHh4", 19) + "\n" + strings.Repeat("eHh4", 1)},
+	{"quoted-printable", "\n", "Grüße\r\nend", "Gr=C3=BC=C3=9Fe\nend"},
+	{"quoted-printable", "\r\n", "a=b", "a=3Db"},
+}
+
+func TestEncodeContent(t *testing.T) {
+	for _, tt := range encodeContentTestTable {
+		got := encodeContent([]byte(tt.content), tt.cte, tt.nl)
+		assert.Equal(t, tt.want, string(got), tt.cte)
+	}
+}